@@ -19,6 +19,7 @@ package konnect
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 
@@ -27,12 +28,17 @@ import (
 
 // Access token claims used by Konnect.
 const (
-	IsAccessTokenClaim    = "kc.isAccessToken"
-	AuthorizedScopesClaim = "kc.authorizedScopes"
-	IsRefreshTokenClaim   = "kc.isRefreshToken"
-	RefClaim              = "kc.ref"
-	IdentityClaim         = "kc.identity"
-	IdentityProvider      = "kc.provider"
+	IsAccessTokenClaim             = "kc.isAccessToken"
+	AuthorizedScopesClaim          = "kc.authorizedScopes"
+	IsRefreshTokenClaim            = "kc.isRefreshToken"
+	IsRegistrationAccessTokenClaim = "kc.isRegistrationAccessToken"
+	RefClaim                       = "kc.ref"
+	ConsentRefClaim                = "kc.consentRef"
+	RefreshTokenFamilyClaim        = "kc.family"
+	LogonSessionIDClaim            = "kc.lsid"
+	IdentityClaim                  = "kc.identity"
+	IdentityProvider               = "kc.provider"
+	ActorClaim                     = "act"
 )
 
 // Identifier identity sub claims used by Konnect.
@@ -50,12 +56,28 @@ const (
 type AccessTokenClaims struct {
 	jwt.StandardClaims
 
+	// Audience replaces the aud claim of the standard claims, since access
+	// tokens can be issued for multiple resources.
+	Audience payload.AudienceList `json:"aud,omitempty"`
+	ClientID string               `json:"client_id,omitempty"`
+
 	IsAccessToken           bool                   `json:"kc.isAccessToken"`
 	AuthorizedScopesList    []string               `json:"kc.authorizedScopes"`
 	AuthorizedClaimsRequest *payload.ClaimsRequest `json:"kc.authorizedClaims,omitempty"`
 
 	IdentityClaims   jwt.MapClaims `json:"kc.identity"`
 	IdentityProvider string        `json:"kc.provider,omitempty"`
+
+	Actor        *ActorClaims        `json:"act,omitempty"`
+	Confirmation *ConfirmationClaims `json:"cnf,omitempty"`
+
+	// Claims of access tokens issued with the JWT profile.
+	Scope    string `json:"scope,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+
+	// JWTProfile must be set by the parser when the access token has the typ
+	// header of the JWT profile, since these have no kc.isAccessToken claim.
+	JWTProfile bool `json:"-"`
 }
 
 // Valid implements the jwt.Claims interface.
@@ -71,6 +93,20 @@ func (c AccessTokenClaims) Valid() error {
 	if c.IsAccessToken {
 		return nil
 	}
+	if c.JWTProfile {
+		// Required claims as specified at https://tools.ietf.org/html/rfc9068#section-2.2
+		switch {
+		case c.ClientID == "":
+			return errors.New("client_id claim missing")
+		case len(c.Audience) == 0:
+			return errors.New("aud claim missing")
+		case c.IssuedAt == 0:
+			return errors.New("iat claim missing")
+		case c.Id == "":
+			return errors.New("jti claim missing")
+		}
+		return nil
+	}
 	return errors.New("kc.isAccessToken claim not valid")
 }
 
@@ -81,10 +117,67 @@ func (c AccessTokenClaims) AuthorizedScopes() map[string]bool {
 	for _, scope := range c.AuthorizedScopesList {
 		authorizedScopes[scope] = true
 	}
+	if c.Scope != "" {
+		for _, scope := range strings.Split(c.Scope, " ") {
+			authorizedScopes[scope] = true
+		}
+	}
 
 	return authorizedScopes
 }
 
+// AuthorizedClientID returns the ID of the client which the accociated access
+// token was issued to. Access tokens without client_id claim have been issued
+// with the client as audience.
+func (c AccessTokenClaims) AuthorizedClientID() string {
+	if c.ClientID != "" {
+		return c.ClientID
+	}
+	if len(c.Audience) > 0 {
+		return c.Audience[0]
+	}
+
+	return ""
+}
+
+// JWTAccessTokenClaims define the claims found in access tokens issued by
+// Konnect with the JWT profile as specified at https://tools.ietf.org/html/rfc9068#section-2.2.
+// Identity claims are kept, so the tokens can be used at the userinfo endpoint.
+type JWTAccessTokenClaims struct {
+	jwt.StandardClaims
+
+	Audience payload.AudienceList `json:"aud"`
+	ClientID string               `json:"client_id"`
+	Scope    string               `json:"scope,omitempty"`
+	AuthTime int64                `json:"auth_time,omitempty"`
+	ACR      string               `json:"acr,omitempty"`
+	AMR      []string             `json:"amr,omitempty"`
+
+	AuthorizedClaimsRequest *payload.ClaimsRequest `json:"kc.authorizedClaims,omitempty"`
+
+	IdentityClaims   jwt.MapClaims `json:"kc.identity,omitempty"`
+	IdentityProvider string        `json:"kc.provider,omitempty"`
+
+	Actor        *ActorClaims        `json:"act,omitempty"`
+	Confirmation *ConfirmationClaims `json:"cnf,omitempty"`
+}
+
+// ActorClaims define the claims used to identify the acting party of a
+// delegated access token as specified at https://tools.ietf.org/html/rfc8693#section-4.1
+type ActorClaims struct {
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+
+	Actor *ActorClaims `json:"act,omitempty"`
+}
+
+// ConfirmationClaims define the claims used to bind a token to a key of the
+// client as specified at https://tools.ietf.org/html/rfc7800#section-3.1
+type ConfirmationClaims struct {
+	JKT     string `json:"jkt,omitempty"`
+	X5TS256 string `json:"x5t#S256,omitempty"`
+}
+
 // RefreshTokenClaims define the claims used by refresh tokens.
 type RefreshTokenClaims struct {
 	jwt.StandardClaims
@@ -93,9 +186,15 @@ type RefreshTokenClaims struct {
 	ApprovedScopesList    []string               `json:"kc.approvedScopes"`
 	ApprovedClaimsRequest *payload.ClaimsRequest `json:"kc.approvedClaims,omitempty"`
 	Ref                   string                 `json:"kc.ref"`
+	ConsentRef            string                 `json:"kc.consentRef,omitempty"`
+	FamilyID              string                 `json:"kc.family,omitempty"`
+	LogonSessionID        string                 `json:"kc.lsid,omitempty"`
+	ResourcesList         []string               `json:"kc.resources,omitempty"`
 
 	IdentityClaims   jwt.MapClaims `json:"kc.identity"`
 	IdentityProvider string        `json:"kc.provider,omitempty"`
+
+	Confirmation *ConfirmationClaims `json:"cnf,omitempty"`
 }
 
 // Valid implements the jwt.Claims interface.
@@ -114,6 +213,25 @@ func (c RefreshTokenClaims) Valid() error {
 	return errors.New("kc.isRefreshToken claim not valid")
 }
 
+// RegistrationAccessTokenClaims define the claims used by registration access
+// tokens of dynamic clients.
+type RegistrationAccessTokenClaims struct {
+	jwt.StandardClaims
+
+	IsRegistrationAccessToken bool `json:"kc.isRegistrationAccessToken"`
+}
+
+// Valid implements the jwt.Claims interface.
+func (c RegistrationAccessTokenClaims) Valid() error {
+	if err := c.StandardClaims.Valid(); err != nil {
+		return err
+	}
+	if c.IsRegistrationAccessToken {
+		return nil
+	}
+	return errors.New("kc.isRegistrationAccessToken claim not valid")
+}
+
 // IDClaims define the claims used with the konnect/id scope.
 type IDClaims struct {
 	// NOTE(longsleep): Always keep these claims compatible with the GitLab API
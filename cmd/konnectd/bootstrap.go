@@ -23,6 +23,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -41,6 +42,7 @@ import (
 	"stash.kopano.io/kc/konnect/encryption"
 	"stash.kopano.io/kc/konnect/identity"
 	"stash.kopano.io/kc/konnect/managers"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 	oidcProvider "stash.kopano.io/kc/konnect/oidc/provider"
 	"stash.kopano.io/kc/konnect/utils"
 )
@@ -69,6 +71,7 @@ type bootstrap struct {
 	signedOutURI             *url.URL
 	authorizationEndpointURI *url.URL
 	endSessionEndpointURI    *url.URL
+	deviceVerificationPath   string
 
 	tlsClientConfig *tls.Config
 
@@ -78,13 +81,22 @@ type bootstrap struct {
 	identifierAuthoritiesConf  string
 	identifierScopesConf       string
 
-	encryptionSecret []byte
-	signingMethod    jwt.SigningMethod
-	signingKeyID     string
-	signers          map[string]crypto.Signer
-	validators       map[string]crypto.PublicKey
+	revocationStoreFile string
+	refreshStoreFile    string
+	consentStoreFile    string
+	clientStoreFile     string
+
+	encryptionSecret      []byte
+	pairwiseSubjectSecret []byte
+	signingMethod         jwt.SigningMethod
+	signingKeyID          string
+	signers               map[string]crypto.Signer
+	validators            map[string]crypto.PublicKey
 
 	accessTokenDurationSeconds uint64
+	refreshTokenRotation       bool
+	accessTokenProfile         string
+	signMetadata               bool
 	uriBasePath                string
 
 	cfg      *config.Config
@@ -214,6 +226,20 @@ func (bs *bootstrap) initialize() error {
 		bs.encryptionSecret = rndm.GenerateRandomBytes(encryption.KeySize)
 	}
 
+	pairwiseSubjectSecretFn, _ := cmd.Flags().GetString("pairwise-subject-secret")
+	if pairwiseSubjectSecretFn == "" {
+		pairwiseSubjectSecretFn = os.Getenv("KONNECTD_PAIRWISE_SUBJECT_SECRET")
+	}
+	if pairwiseSubjectSecretFn != "" {
+		logger.WithField("file", pairwiseSubjectSecretFn).Infoln("loading pairwise subject secret from file")
+		bs.pairwiseSubjectSecret, err = ioutil.ReadFile(pairwiseSubjectSecretFn)
+		if err != nil {
+			return fmt.Errorf("failed to load pairwise subject secret from file: %v", err)
+		}
+	} else {
+		logger.Infoln("no --pairwise-subject-secret parameter, pairwise subject type is disabled")
+	}
+
 	bs.cfg.ListenAddr, _ = cmd.Flags().GetString("listen")
 	if bs.cfg.ListenAddr == "" {
 		bs.cfg.ListenAddr = os.Getenv("KONNECTD_LISTEN")
@@ -222,6 +248,45 @@ func (bs *bootstrap) initialize() error {
 		bs.cfg.ListenAddr = defaultListenAddr
 	}
 
+	bs.cfg.TLSListenAddr, _ = cmd.Flags().GetString("tls-listen")
+	if bs.cfg.TLSListenAddr != "" {
+		tlsCertFn, _ := cmd.Flags().GetString("tls-cert")
+		tlsKeyFn, _ := cmd.Flags().GetString("tls-key")
+		if tlsCertFn == "" || tlsKeyFn == "" {
+			return fmt.Errorf("tls-listen requires tls-cert and tls-key")
+		}
+		logger.WithField("file", tlsCertFn).Infoln("loading TLS certificate from file")
+		tlsCertificate, errLoad := tls.LoadX509KeyPair(tlsCertFn, tlsKeyFn)
+		if errLoad != nil {
+			return fmt.Errorf("failed to load TLS certificate: %v", errLoad)
+		}
+		bs.cfg.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{tlsCertificate},
+			MinVersion:   tls.VersionTLS12,
+			// NOTE(longsleep): Client certificates are requested but validated
+			// by the token endpoint since self signed certificates are allowed.
+			ClientAuth: tls.RequestClientCert,
+		}
+
+		tlsClientCAFn, _ := cmd.Flags().GetString("tls-client-ca")
+		if tlsClientCAFn != "" {
+			logger.WithField("file", tlsClientCAFn).Infoln("loading TLS client CA certificates from file")
+			pemBytes, errRead := ioutil.ReadFile(tlsClientCAFn)
+			if errRead != nil {
+				return fmt.Errorf("failed to load TLS client CA certificates: %v", errRead)
+			}
+			bs.cfg.TLSConfig.ClientCAs = x509.NewCertPool()
+			if !bs.cfg.TLSConfig.ClientCAs.AppendCertsFromPEM(pemBytes) {
+				return fmt.Errorf("no TLS client CA certificates found in %s", tlsClientCAFn)
+			}
+		}
+	}
+
+	bs.cfg.TLSClientCertHeader, _ = cmd.Flags().GetString("tls-client-cert-header")
+	if bs.cfg.TLSClientCertHeader != "" {
+		logger.WithField("header", bs.cfg.TLSClientCertHeader).Infoln("accepting TLS client certificates from trusted proxies")
+	}
+
 	bs.identifierClientPath, _ = cmd.Flags().GetString("identifier-client-path")
 	if bs.identifierClientPath == "" {
 		bs.identifierClientPath = os.Getenv("KONNECTD_IDENTIFIER_CLIENT_PATH")
@@ -247,6 +312,46 @@ func (bs *bootstrap) initialize() error {
 		}
 	}
 
+	bs.revocationStoreFile, _ = cmd.Flags().GetString("revocation-store-file")
+	if bs.revocationStoreFile != "" {
+		bs.revocationStoreFile, _ = filepath.Abs(bs.revocationStoreFile)
+	}
+
+	bs.consentStoreFile, _ = cmd.Flags().GetString("consent-store-file")
+	if bs.consentStoreFile != "" {
+		bs.consentStoreFile, _ = filepath.Abs(bs.consentStoreFile)
+	}
+
+	bs.clientStoreFile, _ = cmd.Flags().GetString("dynamic-client-store-file")
+	if bs.clientStoreFile != "" {
+		bs.clientStoreFile, _ = filepath.Abs(bs.clientStoreFile)
+	}
+
+	bs.refreshTokenRotation, _ = cmd.Flags().GetBool("refresh-token-rotation")
+	if bs.refreshTokenRotation {
+		logger.Infoln("refresh token rotation is enabled")
+	}
+
+	bs.refreshStoreFile, _ = cmd.Flags().GetString("refresh-token-rotation-store-file")
+	if bs.refreshStoreFile != "" {
+		bs.refreshStoreFile, _ = filepath.Abs(bs.refreshStoreFile)
+	}
+
+	bs.accessTokenProfile, _ = cmd.Flags().GetString("access-token-profile")
+	switch bs.accessTokenProfile {
+	case konnectoidc.AccessTokenProfileKonnect:
+		// breaks
+	case konnectoidc.AccessTokenProfileJWT:
+		logger.Infoln("issuing access tokens with JWT profile")
+	default:
+		return fmt.Errorf("unknown access-token-profile: %s", bs.accessTokenProfile)
+	}
+
+	bs.signMetadata, _ = cmd.Flags().GetBool("sign-metadata")
+	if bs.signMetadata {
+		logger.Infoln("metadata is served with signed_metadata")
+	}
+
 	bs.signingKeyID, _ = cmd.Flags().GetString("signing-kid")
 	if bs.signingKeyID == "" {
 		bs.signingKeyID = os.Getenv("KONNECTD_SIGNING_KID")
@@ -449,18 +554,44 @@ func (bs *bootstrap) setupOIDCProvider(ctx context.Context) (*oidcProvider.Provi
 		registrationPath = bs.makeURIPath(apiTypeKonnect, "/register")
 	}
 
+	var deviceAuthorizationPath = ""
+	var deviceVerificationURI = ""
+	if bs.deviceVerificationPath != "" {
+		// Device authorization grant requires a verification page.
+		deviceAuthorizationPath = bs.makeURIPath(apiTypeKonnect, "/device")
+		deviceVerificationURI = withSchemeAndHost(&url.URL{Path: bs.deviceVerificationPath}, bs.issuerIdentifierURI).String()
+	}
+
+	// Authorization server metadata, including path-inserted variants for the
+	// issuer path and the URI base path as specified at https://tools.ietf.org/html/rfc8414#section-3.1.
+	authorizationServerMetadataPaths := []string{"/.well-known/oauth-authorization-server"}
+	for _, path := range []string{bs.issuerIdentifierURI.EscapedPath(), bs.uriBasePath} {
+		path = strings.TrimSuffix(path, "/")
+		if path != "" {
+			authorizationServerMetadataPaths = append(authorizationServerMetadataPaths, "/.well-known/oauth-authorization-server"+path)
+		}
+	}
+
 	provider, err := oidcProvider.NewProvider(&oidcProvider.Config{
 		Config: bs.cfg,
 
-		IssuerIdentifier:       bs.issuerIdentifierURI.String(),
-		WellKnownPath:          "/.well-known/openid-configuration",
-		JwksPath:               bs.makeURIPath(apiTypeKonnect, "/jwks.json"),
-		AuthorizationPath:      bs.authorizationEndpointURI.EscapedPath(),
-		TokenPath:              bs.makeURIPath(apiTypeKonnect, "/token"),
-		UserInfoPath:           bs.makeURIPath(apiTypeKonnect, "/userinfo"),
-		EndSessionPath:         bs.endSessionEndpointURI.EscapedPath(),
-		CheckSessionIframePath: bs.makeURIPath(apiTypeKonnect, "/session/check-session.html"),
-		RegistrationPath:       registrationPath,
+		IssuerIdentifier:        bs.issuerIdentifierURI.String(),
+		WellKnownPath:           "/.well-known/openid-configuration",
+		JwksPath:                bs.makeURIPath(apiTypeKonnect, "/jwks.json"),
+		AuthorizationPath:       bs.authorizationEndpointURI.EscapedPath(),
+		TokenPath:               bs.makeURIPath(apiTypeKonnect, "/token"),
+		UserInfoPath:            bs.makeURIPath(apiTypeKonnect, "/userinfo"),
+		IntrospectionPath:       bs.makeURIPath(apiTypeKonnect, "/token/introspect"),
+		RevocationPath:          bs.makeURIPath(apiTypeKonnect, "/token/revoke"),
+		EndSessionPath:          bs.endSessionEndpointURI.EscapedPath(),
+		CheckSessionIframePath:  bs.makeURIPath(apiTypeKonnect, "/session/check-session.html"),
+		RegistrationPath:        registrationPath,
+		DeviceAuthorizationPath: deviceAuthorizationPath,
+		DeviceVerificationURI:   deviceVerificationURI,
+
+		PushedAuthorizationRequestPath: bs.makeURIPath(apiTypeKonnect, "/par"),
+
+		AuthorizationServerMetadataPaths: authorizationServerMetadataPaths,
 
 		BrowserStateCookiePath: bs.makeURIPath(apiTypeKonnect, "/session/"),
 		BrowserStateCookieName: "__Secure-KKBS", // Kopano-Konnect-Browser-State
@@ -471,6 +602,10 @@ func (bs *bootstrap) setupOIDCProvider(ctx context.Context) (*oidcProvider.Provi
 		AccessTokenDuration:  time.Duration(bs.accessTokenDurationSeconds) * time.Second,
 		IDTokenDuration:      1 * time.Hour,            // 1 Hour, must be consumed by then.
 		RefreshTokenDuration: 24 * 365 * 3 * time.Hour, // 3 Years.
+		RefreshTokenRotation: bs.refreshTokenRotation,
+		AccessTokenProfile:   bs.accessTokenProfile,
+
+		SignMetadata: bs.signMetadata,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create provider: %v", err)
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"stash.kopano.io/kc/konnect/identifier"
+	identifierBackends "stash.kopano.io/kc/konnect/identifier/backends"
+)
+
+// newConsentIdentifier creates an identifier without a logon backend, which
+// is used to provide the consent page for identity managers which do not
+// bring their own identifier.
+func newConsentIdentifier(bs *bootstrap) (*identifier.Identifier, error) {
+	consentIdentifier, err := identifier.NewIdentifier(&identifier.Config{
+		Config: bs.cfg,
+
+		BaseURI:         bs.issuerIdentifierURI,
+		PathPrefix:      strings.TrimSuffix(bs.makeURIPath(apiTypeSignin, ""), "/"),
+		StaticFolder:    bs.identifierClientPath,
+		LogonCookieName: "__Secure-KKT", // Kopano-Konnect-Token
+		ScopesConf:      bs.identifierScopesConf,
+
+		AuthorizationEndpointURI: withSchemeAndHost(bs.authorizationEndpointURI, bs.issuerIdentifierURI),
+
+		Backend: identifierBackends.NewNoneIdentifierBackend(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consent identifier: %v", err)
+	}
+	err = consentIdentifier.SetKey(bs.encryptionSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --encryption-secret parameter value for consent identifier: %v", err)
+	}
+
+	return consentIdentifier, nil
+}
@@ -65,7 +65,13 @@ func newCookieIdentityManager(bs *bootstrap) (identity.Manager, error) {
 		ScopesSupported: bs.cfg.AllowedScopes,
 	}
 
+	consentIdentifier, err := newConsentIdentifier(bs)
+	if err != nil {
+		return nil, err
+	}
+
 	cookieIdentityManager := identityManagers.NewCookieIdentityManager(identityManagerConfig, backendURI, cookieNames, 30*time.Second, bs.cfg.HTTPTransport)
+	cookieIdentityManager.SetIdentifier(consentIdentifier)
 	logger.WithFields(logrus.Fields{
 		"backend": backendURI,
 		"signIn":  bs.signInFormURI,
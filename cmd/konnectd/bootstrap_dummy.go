@@ -25,6 +25,10 @@ import (
 func newDummyIdentityManager(bs *bootstrap) (identity.Manager, error) {
 	logger := bs.cfg.Logger
 
+	if bs.authorizationEndpointURI.EscapedPath() == "" {
+		bs.authorizationEndpointURI.Path = bs.makeURIPath(apiTypeKonnect, "/authorize")
+	}
+
 	identityManagerConfig := &identity.Config{
 		Logger: logger,
 
@@ -32,7 +36,13 @@ func newDummyIdentityManager(bs *bootstrap) (identity.Manager, error) {
 	}
 
 	sub := "dummy"
+	consentIdentifier, err := newConsentIdentifier(bs)
+	if err != nil {
+		return nil, err
+	}
+
 	dummyIdentityManager := identityManagers.NewDummyIdentityManager(identityManagerConfig, sub)
+	dummyIdentityManager.SetIdentifier(consentIdentifier)
 	logger.WithField("sub", sub).Warnln("using dummy identity manager")
 
 	return dummyIdentityManager, nil
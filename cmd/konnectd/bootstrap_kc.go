@@ -56,6 +56,8 @@ func newKCIdentityManager(bs *bootstrap) (identity.Manager, error) {
 		bs.signedOutURI.Path = bs.makeURIPath(apiTypeSignin, "/goodbye")
 	}
 
+	bs.deviceVerificationPath = bs.makeURIPath(apiTypeSignin, "/device")
+
 	useGlobalSession := false
 	globalSessionUsername := os.Getenv("KOPANO_SERVER_USERNAME")
 	globalSessionPassword := os.Getenv("KOPANO_SERVER_PASSWORD")
@@ -50,6 +50,8 @@ func newLDAPIdentityManager(bs *bootstrap) (identity.Manager, error) {
 		bs.signedOutURI.Path = bs.makeURIPath(apiTypeSignin, "/goodbye")
 	}
 
+	bs.deviceVerificationPath = bs.makeURIPath(apiTypeSignin, "/device")
+
 	// Default LDAP attribute mappings.
 	attributeMapping := map[string]string{
 		ldapDefinitions.AttributeLogin:                        os.Getenv("LDAP_LOGIN_ATTRIBUTE"),
@@ -27,6 +27,12 @@ import (
 	identityClients "stash.kopano.io/kc/konnect/identity/clients"
 	identityManagers "stash.kopano.io/kc/konnect/identity/managers"
 	codeManagers "stash.kopano.io/kc/konnect/oidc/code/managers"
+	consentManagers "stash.kopano.io/kc/konnect/oidc/consent/managers"
+	deviceManagers "stash.kopano.io/kc/konnect/oidc/device/managers"
+	parManagers "stash.kopano.io/kc/konnect/oidc/par/managers"
+	refreshManagers "stash.kopano.io/kc/konnect/oidc/refresh/managers"
+	revocationManagers "stash.kopano.io/kc/konnect/oidc/revocation/managers"
+	sessionManagers "stash.kopano.io/kc/konnect/oidc/session/managers"
 )
 
 func newManagers(ctx context.Context, bs *bootstrap) (*managers.Managers, error) {
@@ -52,11 +58,69 @@ func newManagers(ctx context.Context, bs *bootstrap) (*managers.Managers, error)
 	code := codeManagers.NewMemoryMapManager(ctx)
 	mgrs.Set("code", code)
 
+	// OAuth2 device authorization manager.
+	mgrs.Set("device", deviceManagers.NewMemoryMapManager(ctx))
+
+	// OAuth2 pushed authorization request manager.
+	mgrs.Set("par", parManagers.NewMemoryMapManager(ctx))
+
+	// OIDC session manager to track clients for logout.
+	mgrs.Set("session", sessionManagers.NewMemoryMapManager(ctx))
+
+	// OAuth2 refresh token family manager for refresh token rotation.
+	if bs.refreshStoreFile != "" {
+		refresh, err := refreshManagers.NewFileManager(ctx, bs.refreshStoreFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create refresh token family manager: %v", err)
+		}
+		mgrs.Set("refresh", refresh)
+		logger.WithField("file", bs.refreshStoreFile).Infoln("refresh token families are persisted to file")
+	} else {
+		mgrs.Set("refresh", refreshManagers.NewMemoryMapManager(ctx))
+	}
+
+	// OIDC token revocation manager.
+	if bs.revocationStoreFile != "" {
+		revocation, err := revocationManagers.NewFileManager(ctx, bs.revocationStoreFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create revocation manager: %v", err)
+		}
+		mgrs.Set("revocation", revocation)
+		logger.WithField("file", bs.revocationStoreFile).Infoln("token revocations are persisted to file")
+	} else {
+		mgrs.Set("revocation", revocationManagers.NewMemoryMapManager(ctx))
+	}
+
+	// OIDC consent manager.
+	if bs.consentStoreFile != "" {
+		consent, err := consentManagers.NewFileManager(ctx, bs.consentStoreFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create consent manager: %v", err)
+		}
+		mgrs.Set("consent", consent)
+		logger.WithField("file", bs.consentStoreFile).Infoln("consents are persisted to file")
+	} else {
+		mgrs.Set("consent", consentManagers.NewMemoryMapManager(ctx))
+	}
+
 	// Identifier client registry manager.
 	clients, err := identityClients.NewRegistry(ctx, bs.issuerIdentifierURI, bs.identifierRegistrationConf, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client registry: %v", err)
 	}
+	if bs.pairwiseSubjectSecret != nil {
+		err = clients.SetPairwiseSubjectSecret(bs.pairwiseSubjectSecret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pairwise-subject-secret parameter value: %v", err)
+		}
+	}
+	if bs.clientStoreFile != "" {
+		clients.Store, err = identityClients.NewFileStore(ctx, bs.clientStoreFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dynamic client store: %v", err)
+		}
+		logger.WithField("file", bs.clientStoreFile).Infoln("dynamic client changes are persisted to file")
+	}
 	mgrs.Set("clients", clients)
 
 	// Identifier authorities registry manager.
@@ -56,11 +56,17 @@ func commandServe() *cobra.Command {
 		},
 	}
 	serveCmd.Flags().String("listen", "", fmt.Sprintf("TCP listen address (default \"%s\")", defaultListenAddr))
+	serveCmd.Flags().String("tls-listen", "", "TCP listen address for HTTPS (required for mutual TLS client authentication)")
+	serveCmd.Flags().String("tls-cert", "", "Full path to PEM encoded TLS certificate file (required with --tls-listen)")
+	serveCmd.Flags().String("tls-key", "", "Full path to PEM encoded TLS private key file (required with --tls-listen)")
+	serveCmd.Flags().String("tls-client-ca", "", "Full path to PEM encoded CA certificates file to validate TLS client certificates")
+	serveCmd.Flags().String("tls-client-cert-header", "", "HTTP header containing the URL encoded PEM client certificate when set by a trusted proxy")
 	serveCmd.Flags().String("iss", "", "OIDC issuer URL")
 	serveCmd.Flags().StringArray("signing-private-key", nil, "Full path to PEM encoded private key file (must match the --signing-method algorithm)")
 	serveCmd.Flags().String("signing-kid", "", "Value of kid field to use in created tokens (uniquely identifying the signing-private-key)")
 	serveCmd.Flags().String("validation-keys-path", "", "Full path to a folder containing PEM encoded private or public key files used for token validaton (file name without extension is used as kid)")
 	serveCmd.Flags().String("encryption-secret", "", fmt.Sprintf("Full path to a file containing a %d bytes secret key", encryption.KeySize))
+	serveCmd.Flags().String("pairwise-subject-secret", "", "Full path to a file containing a 32 to 64 bytes secret key to derive pairwise subjects (pairwise subject type is disabled if not set)")
 	serveCmd.Flags().String("signing-method", "PS256", "JWT default signing method")
 	serveCmd.Flags().String("uri-base-path", "", "Custom base path for URI endpoints")
 	serveCmd.Flags().String("sign-in-uri", "", "Custom redirection URI to sign-in form")
@@ -70,11 +76,18 @@ func commandServe() *cobra.Command {
 	serveCmd.Flags().String("identifier-client-path", "", fmt.Sprintf("Path to the identifier web client base folder (default \"%s\")", defaultIdentifierClientPath))
 	serveCmd.Flags().String("identifier-registration-conf", "", "Path to a identifier-registration.yaml configuration file")
 	serveCmd.Flags().String("identifier-scopes-conf", "", "Path to a scopes.yaml configuration file")
+	serveCmd.Flags().String("revocation-store-file", "", "Path to a file to persist revoked tokens and logon sessions (if not set, revocations are kept in memory only)")
+	serveCmd.Flags().String("consent-store-file", "", "Path to a file to persist user consents (if not set, consents are kept in memory only)")
+	serveCmd.Flags().String("dynamic-client-store-file", "", "Path to a file to persist changes to dynamic clients (if not set, changes are kept in memory only)")
 	serveCmd.Flags().Bool("insecure", false, "Disable TLS certificate and hostname validation")
 	serveCmd.Flags().StringArray("trusted-proxy", nil, "Trusted proxy IP or IP network (can be used multiple times)")
 	serveCmd.Flags().StringArray("allow-scope", nil, "Allow OAuth 2 scope (can be used multiple times, if not set default scopes are allowed)")
 	serveCmd.Flags().Bool("allow-client-guests", false, "Allow sign in of client controlled guest users")
 	serveCmd.Flags().Bool("allow-dynamic-client-registration", false, "Allow dynamic OAuth2 client registration")
+	serveCmd.Flags().String("access-token-profile", "konnect", "Access token profile (one of konnect or jwt)")
+	serveCmd.Flags().Bool("sign-metadata", false, "Include signed_metadata with all metadata values in the discovery documents")
+	serveCmd.Flags().Bool("refresh-token-rotation", false, "Issue a new refresh token with every refresh and revoke all refresh tokens of a grant when an old refresh token is reused")
+	serveCmd.Flags().String("refresh-token-rotation-store-file", "", "Path to a file to persist refresh token families for refresh token rotation (if not set, families are kept in memory only and rotated refresh tokens become invalid on restart)")
 	serveCmd.Flags().Bool("log-timestamp", true, "Prefix each log line with timestamp")
 	serveCmd.Flags().String("log-level", "info", "Log level (one of panic, fatal, error, warn, info or debug)")
 	serveCmd.Flags().Bool("with-pprof", false, "With pprof enabled")
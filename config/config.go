@@ -18,6 +18,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
 
@@ -28,6 +29,10 @@ import (
 type Config struct {
 	ListenAddr string
 
+	TLSListenAddr       string
+	TLSConfig           *tls.Config
+	TLSClientCertHeader string
+
 	WithMetrics bool
 
 	Logger        logrus.FieldLogger
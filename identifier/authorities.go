@@ -0,0 +1,45 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identifier
+
+import (
+	"context"
+)
+
+// getAuthorityInfos returns the public information of all external
+// authorities which are ready to be used to sign in.
+func (i *Identifier) getAuthorityInfos(ctx context.Context) []*AuthorityInfo {
+	var infos []*AuthorityInfo
+	for _, authority := range i.authorities.List(ctx) {
+		if !authority.IsReady() {
+			continue
+		}
+
+		name := authority.Name
+		if name == "" {
+			name = authority.ID
+		}
+		infos = append(infos, &AuthorityInfo{
+			ID:      authority.ID,
+			Name:    name,
+			Default: i.authorities.IsDefault(authority.ID),
+		})
+	}
+
+	return infos
+}
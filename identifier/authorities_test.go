@@ -0,0 +1,168 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect/identity/authorities"
+)
+
+func registerTestAuthority(t *testing.T, i *Identifier, id string, name string, isDefault bool, ready bool) {
+	discover := false
+	registration := &authorities.AuthorityRegistration{
+		ID:            id,
+		Name:          name,
+		AuthorityType: authorities.AuthorityTypeOIDC,
+		ClientID:      id + "-client",
+		Default:       isDefault,
+		Discover:      &discover,
+		Insecure:      !ready,
+
+		RawAuthorizationEndpoint: "https://" + id + ".example.com/authorize",
+	}
+	if ready {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registration.JWKS = &jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{
+				Key:   &key.PublicKey,
+				KeyID: id + "-key",
+				Use:   "sig",
+			}},
+		}
+	}
+	if err := registration.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.authorities.Register(registration); err != nil {
+		t.Fatal(err)
+	}
+	// Without metadata endpoint, initialization fails after the registration
+	// became ready with its static configuration.
+	registration.Initialize(context.Background(), logger)
+}
+
+func TestHelloAuthorities(t *testing.T) {
+	i, _ := newTestIdentifier(t)
+	registerTestAuthority(t, i, "first", "", false, true)
+	registerTestAuthority(t, i, "unready", "Unready", false, false)
+	registerTestAuthority(t, i, "second", "Second", true, true)
+
+	// Without signed in user, the ready authorities are offered for selection.
+	rr := postJSON(i.handleHello, &HelloRequest{
+		State: "test-state",
+	}, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+	var response HelloResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Success {
+		t.Errorf("hello without user must not succeed")
+	}
+
+	expected := []*AuthorityInfo{
+		{ID: "first", Name: "first"},
+		{ID: "second", Name: "Second", Default: true},
+	}
+	if len(response.Authorities) != len(expected) {
+		t.Fatalf("got %d authorities want %d", len(response.Authorities), len(expected))
+	}
+	for idx, authority := range response.Authorities {
+		if *authority != *expected[idx] {
+			t.Errorf("authority %d: got %v want %v", idx, authority, expected[idx])
+		}
+	}
+
+	// Signed in users are not offered authorities.
+	rr = postJSON(i.handleHello, &HelloRequest{
+		State: "test-state",
+	}, logonTestUser(t, i))
+	response = HelloResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if !response.Success || len(response.Authorities) > 0 {
+		t.Errorf("hello with user: got success %v and authorities %v", response.Success, response.Authorities)
+	}
+}
+
+func TestOAuth2StartWithAuthorityID(t *testing.T) {
+	i, _ := newTestIdentifier(t)
+	i.authorizationEndpointURI, _ = url.Parse("https://konnect.example.com/konnect/v1/authorize")
+	registerTestAuthority(t, i, "first", "First", true, true)
+	registerTestAuthority(t, i, "second", "Second", false, true)
+	registerTestAuthority(t, i, "unready", "Unready", false, false)
+
+	start := func(authorityID string) *url.URL {
+		query := url.Values{
+			"client_id":    {"testclient"},
+			"flow":         {FlowOIDC},
+			"authority_id": {authorityID},
+		}
+		req := httptest.NewRequest(http.MethodGet, "https://konnect.example.com/identifier/oauth2/start?"+query.Encode(), nil)
+		rr := httptest.NewRecorder()
+		i.handleOAuth2Start(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("%s: got status %v want %v", authorityID, rr.Code, http.StatusFound)
+		}
+		location, _ := url.Parse(rr.Header().Get("Location"))
+		return location
+	}
+
+	// The selected authority is used, not the default.
+	location := start("second")
+	if location.Host != "second.example.com" {
+		t.Errorf("second: redirected to %v want second.example.com", location)
+	}
+	if clientID := location.Query().Get("client_id"); clientID != "second-client" {
+		t.Errorf("second: got client_id %v want second-client", clientID)
+	}
+
+	// Unknown and unready authorities return to the authorization endpoint.
+	for _, authorityID := range []string{"unknown", "unready"} {
+		location = start(authorityID)
+		if location.Host != "konnect.example.com" {
+			t.Errorf("%s: redirected to %v want authorization endpoint", authorityID, location)
+		}
+		query := location.Query()
+		if query.Get("error") != oidc.ErrorCodeOAuth2TemporarilyUnavailable {
+			t.Errorf("%s: got error %v want %v", authorityID, query.Get("error"), oidc.ErrorCodeOAuth2TemporarilyUnavailable)
+		}
+		if _, ok := query["authority_id"]; ok {
+			t.Errorf("%s: authority_id must not be passed back: %v", authorityID, location)
+		}
+		if _, ok := query["flow"]; ok {
+			t.Errorf("%s: flow must not be passed back: %v", authorityID, location)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package backends
+
+import (
+	"context"
+	"fmt"
+
+	"stash.kopano.io/kc/konnect/identifier/meta/scopes"
+)
+
+const noneIdentifierBackendName = "identifier-none"
+
+// NoneIdentifierBackend is a backend without any users. It is used when the
+// identifier only provides its consent flow for users who are signed in by
+// other identity managers.
+type NoneIdentifierBackend struct {
+}
+
+// NewNoneIdentifierBackend creates a new NoneIdentifierBackend.
+func NewNoneIdentifierBackend() *NoneIdentifierBackend {
+	return &NoneIdentifierBackend{}
+}
+
+// RunWithContext implements the Backend interface.
+func (b *NoneIdentifierBackend) RunWithContext(ctx context.Context) error {
+	return nil
+}
+
+// Logon implements the Backend interface. Logon always fails.
+func (b *NoneIdentifierBackend) Logon(ctx context.Context, audience, username, password string) (bool, *string, *string, map[string]interface{}, error) {
+	return false, nil, nil, nil, nil
+}
+
+// ResolveUserByUsername implements the Beckend interface. No user is ever
+// found.
+func (b *NoneIdentifierBackend) ResolveUserByUsername(ctx context.Context, username string) (UserFromBackend, error) {
+	return nil, nil
+}
+
+// GetUser implements the Backend interface. No user is ever found.
+func (b *NoneIdentifierBackend) GetUser(ctx context.Context, userID string, sessionRef *string) (UserFromBackend, error) {
+	return nil, fmt.Errorf("none identifier backend has no users")
+}
+
+// RefreshSession implements the Backend interface.
+func (b *NoneIdentifierBackend) RefreshSession(ctx context.Context, userID string, sessionRef *string, claims map[string]interface{}) error {
+	return fmt.Errorf("none identifier backend has no sessions")
+}
+
+// DestroySession implements the Backend interface.
+func (b *NoneIdentifierBackend) DestroySession(ctx context.Context, sessionRef *string) error {
+	return nil
+}
+
+// UserClaims implements the Backend interface.
+func (b *NoneIdentifierBackend) UserClaims(userID string, authorizedScopes map[string]bool) map[string]interface{} {
+	return nil
+}
+
+// ScopesSupported implements the Backend interface.
+func (b *NoneIdentifierBackend) ScopesSupported() []string {
+	return nil
+}
+
+// ScopesMeta implements the Backend interface.
+func (b *NoneIdentifierBackend) ScopesMeta() *scopes.Scopes {
+	return nil
+}
+
+// Name implements the Backend interface.
+func (b *NoneIdentifierBackend) Name() string {
+	return noneIdentifierBackendName
+}
@@ -19,6 +19,8 @@ package identifier
 
 // Additional claims as used by the identifier in its own tokens.
 const (
-	SessionIDClaim  = "sid"
-	UserClaimsClaim = "claims"
+	SessionIDClaim             = "sid"
+	UserClaimsClaim            = "claims"
+	AuthenticationMethodsClaim = "amr"
+	LogonSessionIDClaim        = "lsid"
 )
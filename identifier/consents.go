@@ -0,0 +1,75 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identifier
+
+import (
+	"context"
+	"fmt"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identity/clients"
+)
+
+// getConsentSubject returns the subject which the accociated identity manager
+// uses for consents of the provided user.
+func (i *Identifier) getConsentSubject(ctx context.Context, user *IdentifiedUser) (string, error) {
+	var userID string
+	if userIDString, ok := user.Claims()[konnect.IdentifiedUserIDClaim]; ok {
+		userID, _ = userIDString.(string)
+	}
+	if userID == "" {
+		return "", fmt.Errorf("no id claim in user identity claims")
+	}
+
+	auth, found, err := i.identityManager.Fetch(ctx, userID, user.SessionRef(), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("user not found")
+	}
+
+	return auth.Subject(), nil
+}
+
+// listGrantedConsents returns the consents which the user with the provided
+// consent subject granted to clients.
+func (i *Identifier) listGrantedConsents(ctx context.Context, sub string) ([]*GrantedConsent, error) {
+	records, err := i.consents.List(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make([]*GrantedConsent, 0, len(records))
+	for _, record := range records {
+		clientDetails := &clients.Details{
+			ID: record.ClientID,
+		}
+		if registration, ok := i.clients.Get(ctx, record.ClientID); ok {
+			clientDetails.DisplayName = registration.Name
+			clientDetails.Trusted = registration.Trusted
+		}
+		granted = append(granted, &GrantedConsent{
+			ClientDetails: clientDetails,
+			Scopes:        record.ApprovedScopes,
+			UpdatedAt:     record.UpdatedAt,
+		})
+	}
+
+	return granted, nil
+}
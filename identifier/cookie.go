@@ -70,7 +70,7 @@ func (i *Identifier) setConsentCookie(rw http.ResponseWriter, cr *ConsentRequest
 		Value:  value,
 		MaxAge: 60,
 
-		Path:     i.pathPrefix + "/identifier/_/",
+		Path:     i.getConsentCookiePath(),
 		Secure:   true,
 		HttpOnly: true,
 		SameSite: http.SameSiteNoneMode,
@@ -98,7 +98,7 @@ func (i *Identifier) removeConsentCookie(rw http.ResponseWriter, req *http.Reque
 	cookie := http.Cookie{
 		Name: name,
 
-		Path:     i.pathPrefix + "/identifier/_/",
+		Path:     i.getConsentCookiePath(),
 		Secure:   true,
 		HttpOnly: true,
 		SameSite: http.SameSiteNoneMode,
@@ -110,6 +110,16 @@ func (i *Identifier) removeConsentCookie(rw http.ResponseWriter, req *http.Reque
 	return nil
 }
 
+func (i *Identifier) getConsentCookiePath() string {
+	// Consent cookies are read by the authorization endpoint, which is not
+	// necessarily below the identifier.
+	if i.authorizationEndpointURI != nil && i.authorizationEndpointURI.EscapedPath() != "" {
+		return i.authorizationEndpointURI.EscapedPath()
+	}
+
+	return i.pathPrefix + "/identifier/_/"
+}
+
 func (i *Identifier) getConsentCookieName(cr *ConsentRequest) (string, error) {
 	// Consent cookie names are based on parameters in the request.
 	hasher, err := blake2b.New256(nil)
@@ -131,6 +141,26 @@ func (i *Identifier) getConsentCookieName(cr *ConsentRequest) (string, error) {
 	return name, nil
 }
 
+func (i *Identifier) setConsentUserCookie(rw http.ResponseWriter, value string) error {
+	cookie := http.Cookie{
+		Name:   consentUserCookieName,
+		Value:  value,
+		MaxAge: int(consentUserDuration.Seconds()),
+
+		Path:     i.pathPrefix + "/identifier/_/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	}
+	http.SetCookie(rw, &cookie)
+
+	return nil
+}
+
+func (i *Identifier) getConsentUserCookie(req *http.Request) (*http.Cookie, error) {
+	return req.Cookie(consentUserCookieName)
+}
+
 func (i *Identifier) setOAuth2Cookie(rw http.ResponseWriter, state string, value string) error {
 	name, err := i.getOAuth2CookieName(state)
 	if err != nil {
@@ -24,4 +24,6 @@ const (
 	FlowOAuth = "oauth"
 	// FlowConsent is the string value for the consent flow.
 	FlowConsent = "consent"
+	// FlowDevice is the string value for the device flow.
+	FlowDevice = "device"
 )
@@ -32,6 +32,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"stash.kopano.io/kgol/oidc-go"
 
+	"stash.kopano.io/kc/konnect"
 	"stash.kopano.io/kc/konnect/identifier/meta"
 	"stash.kopano.io/kc/konnect/identifier/meta/scopes"
 	"stash.kopano.io/kc/konnect/identity/authorities"
@@ -204,6 +205,7 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 	// but its interpretation depends on the third field ($mode). The rest of the
 	// fields are mode specific.
 	params := r.Params
+	reusedLogon := false
 	for {
 		paramSize := len(params)
 		if paramSize == 0 {
@@ -211,9 +213,18 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 			break
 		}
 
-		if paramSize >= 3 && params[1] == "" && params[2] == ModeLogonUsernameEmptyPasswordCookie {
+		promptLogin := false
+		audience := ""
+		if r.Hello != nil {
+			promptLogin, _ = r.Hello.Prompts[oidc.PromptLogin]
+			audience = r.Hello.ClientID
+		}
+
+		if !promptLogin && paramSize >= 3 && params[1] == "" && params[2] == ModeLogonUsernameEmptyPasswordCookie {
 			// Special mode to allow when same user is logged in via cookie. This
 			// is used in the select account page logon flow with empty password.
+			// It is never allowed when a new authentication was requested and
+			// does not count as authentication by itself.
 			identifiedUser, cookieErr := i.GetUserFromLogonCookie(req.Context(), req, 0, true)
 			if cookieErr != nil {
 				i.logger.WithError(cookieErr).Debugln("identifier failed to decode logon cookie in logon request")
@@ -221,18 +232,13 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 			if identifiedUser != nil {
 				if identifiedUser.Username() == params[0] {
 					user = identifiedUser
+					user.amr = []string{konnectoidc.AMRValueCookie}
+					reusedLogon = true
 					break
 				}
 			}
 		}
 
-		promptLogin := false
-		audience := ""
-		if r.Hello != nil {
-			promptLogin, _ = r.Hello.Prompts[oidc.PromptLogin]
-			audience = r.Hello.ClientID
-		}
-
 		if !promptLogin {
 			// SSO support - check if request passed through a trusted proxy.
 			trusted, _ := utils.IsRequestFromTrustedSource(req, i.Config.Config.TrustedProxyIPs, i.Config.Config.TrustedProxyNets)
@@ -250,6 +256,9 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 
 						// Success, use resolved user.
 						user = resolvedUser
+						if user != nil {
+							user.amr = []string{konnectoidc.AMRValueWindowsIntegrated}
+						}
 					}
 					break
 				}
@@ -275,6 +284,9 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 				return
 			}
 			user = logonedUser
+			if user != nil {
+				user.amr = []string{konnectoidc.AMRValuePassword}
+			}
 
 		default:
 			i.logger.Debugln("identifier unknown logon mode: %v", params[2])
@@ -298,8 +310,10 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 		i.logger.WithError(err).Debugln("identifier failed to update user data in logon request")
 	}
 
-	// Set logon time.
-	user.logonAt = time.Now()
+	// Set logon time, unless an existing logon was reused.
+	if !reusedLogon || user.logonAt.IsZero() {
+		user.logonAt = time.Now()
+	}
 
 	if r.Hello != nil {
 		hello, errHello := i.newHelloResponse(rw, req, r.Hello, user)
@@ -410,6 +424,103 @@ func (i *Identifier) handleConsent(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (i *Identifier) handleDevice(rw http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	var r DeviceRequest
+	err := decoder.Decode(&r)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode device request")
+		i.ErrorPage(rw, http.StatusBadRequest, "", "failed to decode request JSON")
+		return
+	}
+
+	addNoCacheResponseHeaders(rw.Header())
+
+	user, err := i.GetUserFromLogonCookie(req.Context(), req, 0, true)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode logon cookie in device request")
+	}
+	if user == nil {
+		i.ErrorPage(rw, http.StatusForbidden, "", "not signed in")
+		return
+	}
+
+	record, found := i.deviceManager.Lookup(r.UserCode)
+	if !found {
+		// Unknown or expired user code.
+		rw.Header().Set("Kopano-Konnect-State", r.State)
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := &DeviceResponse{
+		State:   r.State,
+		Success: true,
+	}
+
+	switch {
+	case !r.Confirm:
+		// Return details for the consent.
+		clientDetails, lookupErr := i.clients.Lookup(req.Context(), record.ClientID, "", &url.URL{}, "", true)
+		if lookupErr != nil {
+			i.logger.WithError(lookupErr).Debugln("identifier failed to lookup client for device request")
+			i.ErrorPage(rw, http.StatusBadRequest, "", lookupErr.Error())
+			return
+		}
+		response.Scopes = record.Scopes
+		response.ClientDetails = clientDetails
+		response.Meta = &meta.Meta{
+			Scopes: scopes.NewScopesFromIDs(record.Scopes, i.meta.Scopes),
+		}
+
+	case !r.Allow:
+		err = i.deviceManager.Deny(r.UserCode)
+
+	default:
+		var userID string
+		if userIDString, ok := user.Claims()[konnect.IdentifiedUserIDClaim]; ok {
+			userID, _ = userIDString.(string)
+		}
+		if userID == "" {
+			err = fmt.Errorf("no id claim in user identity claims")
+			break
+		}
+
+		consent := &Consent{
+			Allow:    true,
+			RawScope: r.RawScope,
+		}
+		approvedScopes, _ := consent.Scopes(record.Scopes)
+
+		// Bind the device authorization to the signed in user.
+		auth, userFound, fetchErr := i.identityManager.Fetch(req.Context(), userID, user.SessionRef(), approvedScopes, nil)
+		if fetchErr != nil {
+			err = fetchErr
+			break
+		}
+		if !userFound {
+			err = fmt.Errorf("user not found")
+			break
+		}
+		if loggedOn, logonAt := user.LoggedOn(); loggedOn {
+			auth.SetAuthTime(logonAt)
+		}
+		auth.SetAuthenticationMethods(user.AuthenticationMethods())
+
+		err = i.deviceManager.Approve(r.UserCode, auth)
+	}
+	if err != nil {
+		i.logger.WithError(err).Errorln("identifier device request failed")
+		i.ErrorPage(rw, http.StatusInternalServerError, "", "failed to process device request")
+		return
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		i.logger.WithError(err).Errorln("device request failed writing response")
+	}
+}
+
 func (i *Identifier) handleHello(rw http.ResponseWriter, req *http.Request) {
 	decoder := json.NewDecoder(req.Body)
 	var r HelloRequest
@@ -434,7 +545,7 @@ func (i *Identifier) handleHello(rw http.ResponseWriter, req *http.Request) {
 		i.ErrorPage(rw, http.StatusBadRequest, "", err.Error())
 		return
 	}
-	if !response.Success {
+	if !response.Success && len(response.Authorities) == 0 {
 		rw.Header().Set("Kopano-Konnect-State", response.State)
 		rw.WriteHeader(http.StatusNoContent)
 		return
@@ -446,7 +557,7 @@ func (i *Identifier) handleHello(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (i Identifier) newHelloResponse(rw http.ResponseWriter, req *http.Request, r *HelloRequest, identifiedUser *IdentifiedUser) (*HelloResponse, error) {
+func (i *Identifier) newHelloResponse(rw http.ResponseWriter, req *http.Request, r *HelloRequest, identifiedUser *IdentifiedUser) (*HelloResponse, error) {
 	var err error
 	response := &HelloResponse{
 		State: r.State,
@@ -490,6 +601,21 @@ handleHelloLoop:
 			}
 		}
 
+		// Check user who was signed in by another identity manager and is sent
+		// here for consent.
+		if r.Flow == FlowConsent {
+			consentUser, consentUserErr := i.GetUserFromConsentUserCookie(req.Context(), req)
+			if consentUserErr != nil {
+				i.logger.WithError(consentUserErr).Debugln("identifier failed to decode consent user cookie in hello")
+			}
+			if consentUser != nil {
+				response.Username = consentUser.Username()
+				response.DisplayName = consentUser.Name()
+				response.Success = true
+				break
+			}
+		}
+
 		// Check frontend proxy injected auth (Eg. Kerberos/NTLM).
 		// TODO(longsleep): Add request validation before accepting incoming header.
 		forwardedUser := req.Header.Get("X-Forwarded-User")
@@ -503,6 +629,8 @@ handleHelloLoop:
 	}
 
 	if !response.Success {
+		// Offer available external authorities for selection.
+		response.Authorities = i.getAuthorityInfos(req.Context())
 		return response, nil
 	}
 
@@ -551,6 +679,199 @@ handleHelloLoop:
 	return response, nil
 }
 
+func (i *Identifier) handleSessions(rw http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	var r SessionsRequest
+	err := decoder.Decode(&r)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode sessions request")
+		i.ErrorPage(rw, http.StatusBadRequest, "", "failed to decode request JSON")
+		return
+	}
+
+	addNoCacheResponseHeaders(rw.Header())
+
+	user, err := i.GetUserFromLogonCookie(req.Context(), req, 0, true)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode logon cookie in sessions request")
+	}
+	if user == nil {
+		i.ErrorPage(rw, http.StatusForbidden, "", "not signed in")
+		return
+	}
+
+	response := &SessionsResponse{
+		State:    r.State,
+		Success:  true,
+		Sessions: i.listLogonSessions(user.Subject()),
+	}
+	for _, session := range response.Sessions {
+		if session.ID == user.logonSessionID {
+			session.Current = true
+		}
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		i.logger.WithError(err).Errorln("sessions request failed writing response")
+	}
+}
+
+func (i *Identifier) handleSessionsRevoke(rw http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	var r SessionsRequest
+	err := decoder.Decode(&r)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode sessions revoke request")
+		i.ErrorPage(rw, http.StatusBadRequest, "", "failed to decode request JSON")
+		return
+	}
+
+	addNoCacheResponseHeaders(rw.Header())
+
+	ctx := req.Context()
+	user, err := i.GetUserFromLogonCookie(ctx, req, 0, false)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode logon cookie in sessions revoke request")
+	}
+	if user == nil {
+		i.ErrorPage(rw, http.StatusForbidden, "", "not signed in")
+		return
+	}
+
+	if !i.revokeLogonSession(ctx, user.Subject(), r.ID) {
+		// Unknown or already revoked session.
+		rw.Header().Set("Kopano-Konnect-State", r.State)
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.ID == user.logonSessionID {
+		// Revoking the current session signs out. The backend session is
+		// already destroyed, thus no user is passed here.
+		err = i.UnsetLogonCookie(ctx, nil, rw)
+		if err != nil {
+			i.logger.WithError(err).Errorln("identifier failed to set logoff ticket")
+			i.ErrorPage(rw, http.StatusInternalServerError, "", "failed to set logoff ticket")
+			return
+		}
+	}
+
+	response := &StateResponse{
+		State:   r.State,
+		Success: true,
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		i.logger.WithError(err).Errorln("sessions revoke request failed writing response")
+	}
+}
+
+func (i *Identifier) handleConsents(rw http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	var r ConsentsRequest
+	err := decoder.Decode(&r)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode consents request")
+		i.ErrorPage(rw, http.StatusBadRequest, "", "failed to decode request JSON")
+		return
+	}
+
+	addNoCacheResponseHeaders(rw.Header())
+
+	ctx := req.Context()
+	user, err := i.GetUserFromLogonCookie(ctx, req, 0, true)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode logon cookie in consents request")
+	}
+	if user == nil {
+		i.ErrorPage(rw, http.StatusForbidden, "", "not signed in")
+		return
+	}
+
+	response := &ConsentsResponse{
+		State:   r.State,
+		Success: true,
+	}
+
+	sub, err := i.getConsentSubject(ctx, user)
+	if err == nil {
+		response.Consents, err = i.listGrantedConsents(ctx, sub)
+	}
+	if err != nil {
+		i.logger.WithError(err).Errorln("identifier consents request failed")
+		i.ErrorPage(rw, http.StatusInternalServerError, "", "failed to process consents request")
+		return
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		i.logger.WithError(err).Errorln("consents request failed writing response")
+	}
+}
+
+func (i *Identifier) handleConsentsRevoke(rw http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	var r ConsentsRequest
+	err := decoder.Decode(&r)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode consents revoke request")
+		i.ErrorPage(rw, http.StatusBadRequest, "", "failed to decode request JSON")
+		return
+	}
+	if r.ClientID == "" {
+		i.ErrorPage(rw, http.StatusBadRequest, "", "missing client_id")
+		return
+	}
+
+	addNoCacheResponseHeaders(rw.Header())
+
+	ctx := req.Context()
+	user, err := i.GetUserFromLogonCookie(ctx, req, 0, true)
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode logon cookie in consents revoke request")
+	}
+	if user == nil {
+		i.ErrorPage(rw, http.StatusForbidden, "", "not signed in")
+		return
+	}
+
+	sub, err := i.getConsentSubject(ctx, user)
+	if err != nil {
+		i.logger.WithError(err).Errorln("identifier consents revoke request failed")
+		i.ErrorPage(rw, http.StatusInternalServerError, "", "failed to process consents revoke request")
+		return
+	}
+
+	if record, found := i.consents.Get(ctx, sub, r.ClientID); !found || record.Revoked() {
+		// Unknown or already revoked consent.
+		rw.Header().Set("Kopano-Konnect-State", r.State)
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Revoking the consent changes its ref, which invalidates all refresh
+	// tokens of the client for this user. The backend session is shared by
+	// all clients of the user and thus left alone.
+	err = i.consents.Revoke(ctx, sub, r.ClientID)
+	if err != nil {
+		i.logger.WithError(err).Errorln("identifier failed to revoke consent")
+		i.ErrorPage(rw, http.StatusInternalServerError, "", "failed to revoke consent")
+		return
+	}
+
+	response := &StateResponse{
+		State:   r.State,
+		Success: true,
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		i.logger.WithError(err).Errorln("consents revoke request failed writing response")
+	}
+}
+
 func (i *Identifier) handleOAuth2Start(rw http.ResponseWriter, req *http.Request) {
 	err := req.ParseForm()
 	if err != nil {
@@ -587,6 +908,7 @@ func (i *Identifier) newOAuth2Start(rw http.ResponseWriter, req *http.Request, a
 		uri, _ := url.Parse(i.authorizationEndpointURI.String())
 		query, _ := url.ParseQuery(req.URL.RawQuery)
 		query.Del("flow")
+		query.Del("authority_id")
 		query.Set("error", typedErr.ErrorID)
 		query.Set("error_description", "identifier failed to authenticate")
 		uri.RawQuery = query.Encode()
@@ -773,8 +1095,9 @@ func (i *Identifier) newOAuth2Cb(rw http.ResponseWriter, req *http.Request) {
 			i.logger.WithError(err).Debugln("identifier failed to update user data in oauth2 cb request")
 		}
 
-		// Set logon time.
+		// Set logon time and method.
 		user.logonAt = time.Now()
+		user.amr = []string{konnectoidc.AMRValueFederated}
 
 		err = i.SetUserToLogonCookie(req.Context(), rw, user)
 		if err != nil {
@@ -795,6 +1118,7 @@ func (i *Identifier) newOAuth2Cb(rw http.ResponseWriter, req *http.Request) {
 	uri, _ := url.Parse(i.authorizationEndpointURI.String())
 	query, _ := url.ParseQuery(sd.RawQuery)
 	query.Del("flow")
+	query.Del("authority_id")
 	query.Set("prompt", oidc.PromptNone)
 
 	switch typedErr := err.(type) {
@@ -0,0 +1,451 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/device"
+
+	deviceManagers "stash.kopano.io/kc/konnect/oidc/device/managers"
+	revocationManagers "stash.kopano.io/kc/konnect/oidc/revocation/managers"
+)
+
+func postJSON(handler http.HandlerFunc, v interface{}, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(v)
+	req := httptest.NewRequest(http.MethodPost, "https://konnect.example.com/identifier/_/", bytes.NewReader(body))
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	return rr
+}
+
+func postLogon(i *Identifier, lr *LogonRequest, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	return postJSON(i.handleLogon, lr, cookies)
+}
+
+func logonTestUser(t *testing.T, i *Identifier) []*http.Cookie {
+	rr := postLogon(i, &LogonRequest{
+		Params: []string{testUsername, testPassword, ModeLogonUsernamePassword},
+	}, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("password logon failed with status %d", rr.Code)
+	}
+
+	return rr.Result().Cookies()
+}
+
+func userFromLogonResponse(t *testing.T, i *Identifier, rr *httptest.ResponseRecorder) *IdentifiedUser {
+	req := httptest.NewRequest(http.MethodPost, "https://konnect.example.com/identifier/_/hello", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	user, err := i.GetUserFromLogonCookie(req.Context(), req, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil {
+		t.Fatal("no user in logon cookie")
+	}
+
+	return user
+}
+
+func TestLogonWithEmptyPasswordCookieMode(t *testing.T) {
+	i, _ := newTestIdentifier(t)
+
+	rr := postLogon(i, &LogonRequest{
+		Params: []string{testUsername, testPassword, ModeLogonUsernamePassword},
+	}, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("password logon failed with status %d", rr.Code)
+	}
+	passwordUser := userFromLogonResponse(t, i, rr)
+	if !reflect.DeepEqual(passwordUser.AuthenticationMethods(), []string{konnectoidc.AMRValuePassword}) {
+		t.Fatalf("unexpected amr after password logon: %v", passwordUser.AuthenticationMethods())
+	}
+	_, passwordLogonAt := passwordUser.LoggedOn()
+	cookies := rr.Result().Cookies()
+
+	// Let time pass, so a reset logon time would be noticed.
+	time.Sleep(1100 * time.Millisecond)
+
+	tests := []struct {
+		name     string
+		params   []string
+		hello    *HelloRequest
+		cookies  []*http.Cookie
+		expected int
+	}{
+		{"without cookie", []string{testUsername, "", ModeLogonUsernameEmptyPasswordCookie}, nil, nil, http.StatusNoContent},
+		{"other user", []string{"bob", "", ModeLogonUsernameEmptyPasswordCookie}, nil, cookies, http.StatusNoContent},
+		{"prompt login", []string{testUsername, "", ModeLogonUsernameEmptyPasswordCookie}, &HelloRequest{RawPrompt: oidc.PromptLogin}, cookies, http.StatusNoContent},
+		{"with cookie", []string{testUsername, "", ModeLogonUsernameEmptyPasswordCookie}, nil, cookies, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		rr := postLogon(i, &LogonRequest{
+			Params: test.params,
+			Hello:  test.hello,
+		}, test.cookies)
+		if rr.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, rr.Code)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		user := userFromLogonResponse(t, i, rr)
+		if !reflect.DeepEqual(user.AuthenticationMethods(), []string{konnectoidc.AMRValueCookie}) {
+			t.Errorf("%s: expected cookie amr, got %v", test.name, user.AuthenticationMethods())
+		}
+		if _, logonAt := user.LoggedOn(); !logonAt.Equal(passwordLogonAt) {
+			t.Errorf("%s: expected logon time %v to be kept, got %v", test.name, passwordLogonAt, logonAt)
+		}
+	}
+}
+
+func TestConsentsRevoke(t *testing.T) {
+	ctx := context.Background()
+	i, backend := newTestIdentifier(t)
+	cookies := logonTestUser(t, i)
+
+	for _, clientID := range []string{"client1", "client2"} {
+		if _, err := i.consents.Approve(ctx, testUserID, clientID, map[string]bool{"openid": true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		clientID string
+		cookies  []*http.Cookie
+		expected int
+		consents int
+	}{
+		{"not signed in", "client1", nil, http.StatusForbidden, 2},
+		{"granted consent", "client1", cookies, http.StatusOK, 1},
+		{"revoked consent", "client1", cookies, http.StatusNoContent, 1},
+		{"unknown consent", "client3", cookies, http.StatusNoContent, 1},
+	}
+
+	for _, test := range tests {
+		rr := postJSON(i.handleConsentsRevoke, &ConsentsRequest{ClientID: test.clientID}, test.cookies)
+		if rr.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, rr.Code)
+		}
+
+		rr = postJSON(i.handleConsents, &ConsentsRequest{}, cookies)
+		var response ConsentsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(response.Consents) != test.consents {
+			t.Errorf("%s: expected %d consents, got %d", test.name, test.consents, len(response.Consents))
+		}
+	}
+
+	if len(backend.destroyedSessions) > 0 {
+		t.Errorf("consent revoke destroyed the shared backend session: %v", backend.destroyedSessions)
+	}
+}
+
+func listTestSessions(t *testing.T, i *Identifier, cookies []*http.Cookie) []*LogonSession {
+	rr := postJSON(i.handleSessions, &SessionsRequest{}, cookies)
+	if rr.Code != http.StatusOK {
+		return nil
+	}
+	var response SessionsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response.Sessions
+}
+
+func TestSessionsRevoke(t *testing.T) {
+	i, backend := newTestIdentifier(t)
+	var revoked []string
+	i.OnRevokeLogonSession(func(ctx context.Context, logonSessionID string) error {
+		revoked = append(revoked, logonSessionID)
+		return nil
+	})
+
+	// Two logons, eg. on different devices.
+	cookiesA := logonTestUser(t, i)
+	cookiesB := logonTestUser(t, i)
+
+	sessions := listTestSessions(t, i, cookiesA)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	var idA, idB string
+	for _, session := range sessions {
+		if session.Current {
+			idA = session.ID
+		} else {
+			idB = session.ID
+		}
+	}
+	if idA == "" || idB == "" {
+		t.Fatalf("expected current and other session, got %v", sessions)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		cookies  []*http.Cookie
+		expected int
+	}{
+		{"not signed in", idB, nil, http.StatusForbidden},
+		{"unknown session", "unknown", cookiesA, http.StatusNoContent},
+		{"other session", idB, cookiesA, http.StatusOK},
+		{"revoked session", idB, cookiesA, http.StatusNoContent},
+		{"with revoked session", idA, cookiesB, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		rr := postJSON(i.handleSessionsRevoke, &SessionsRequest{ID: test.id}, test.cookies)
+		if rr.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, rr.Code)
+		}
+	}
+
+	if !reflect.DeepEqual(revoked, []string{idB}) {
+		t.Errorf("expected revoke hook for %v, got %v", idB, revoked)
+	}
+	if len(backend.destroyedSessions) != 1 {
+		t.Errorf("expected backend session to be destroyed once, got %v", backend.destroyedSessions)
+	}
+	if sessions := listTestSessions(t, i, cookiesA); len(sessions) != 1 || sessions[0].ID != idA {
+		t.Errorf("expected only the current session to be listed, got %v", sessions)
+	}
+
+	// Forget all logon sessions, as after a restart. The revocation is
+	// persisted and thus still known.
+	i.logonSessions = cmap.New()
+	if sessions := listTestSessions(t, i, cookiesB); sessions != nil {
+		t.Errorf("revoked logon session accepted after restart: %v", sessions)
+	}
+	if sessions := listTestSessions(t, i, cookiesA); len(sessions) != 1 {
+		t.Errorf("expected current session after restart, got %v", sessions)
+	}
+}
+
+func TestSessionsRevokeWithRevocationStoreFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, err := ioutil.TempFile("", "konnect-revocations-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	defer os.Remove(f.Name())
+
+	newIdentifierWithRevocationStoreFile := func() *Identifier {
+		i, _ := newTestIdentifier(t)
+		i.revocations, err = revocationManagers.NewFileManager(ctx, f.Name(), logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return i
+	}
+
+	i := newIdentifierWithRevocationStoreFile()
+	cookiesA := logonTestUser(t, i)
+	cookiesB := logonTestUser(t, i)
+	var idB string
+	for _, session := range listTestSessions(t, i, cookiesA) {
+		if !session.Current {
+			idB = session.ID
+		}
+	}
+	if rr := postJSON(i.handleSessionsRevoke, &SessionsRequest{ID: idB}, cookiesA); rr.Code != http.StatusOK {
+		t.Fatalf("revoke failed with status %d", rr.Code)
+	}
+
+	// Logon sessions are kept in memory only, thus a restarted identifier
+	// does not know them. The revocation is persisted in the revocation store
+	// file and thus still known.
+	i = newIdentifierWithRevocationStoreFile()
+	if sessions := listTestSessions(t, i, cookiesB); sessions != nil {
+		t.Errorf("revoked logon session accepted after restart: %v", sessions)
+	}
+	sessions := listTestSessions(t, i, cookiesA)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("expected current session to be tracked again after restart, got %v", sessions)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i, _ := newTestIdentifier(t)
+	i.deviceManager = deviceManagers.NewMemoryMapManager(ctx)
+	err := i.clients.Register(&clients.ClientRegistration{
+		ID:           "deviceclient",
+		RedirectURIs: []string{"https://device.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := logonTestUser(t, i)
+
+	create := func() (string, *device.Record) {
+		record := &device.Record{
+			ClientID: "deviceclient",
+			Scopes:   map[string]bool{oidc.ScopeOpenID: true, oidc.ScopeEmail: true},
+		}
+		deviceCode, createErr := i.deviceManager.Create(record)
+		if createErr != nil {
+			t.Fatal(createErr)
+		}
+		// Allow polling without waiting for the interval.
+		record.Interval = 0
+		return deviceCode, record
+	}
+
+	deviceCode, record := create()
+	userCode := device.FormatUserCode(record.UserCode)
+	tests := []struct {
+		name     string
+		request  *DeviceRequest
+		cookies  []*http.Cookie
+		expected int
+	}{
+		{"not signed in", &DeviceRequest{UserCode: userCode}, nil, http.StatusForbidden},
+		{"unknown user code", &DeviceRequest{UserCode: "XXXX-XXXX"}, cookies, http.StatusNoContent},
+		{"details", &DeviceRequest{UserCode: userCode}, cookies, http.StatusOK},
+		{"allow", &DeviceRequest{UserCode: userCode, Confirm: true, Allow: true, RawScope: oidc.ScopeOpenID}, cookies, http.StatusOK},
+		{"already allowed", &DeviceRequest{UserCode: userCode, Confirm: true, Allow: true}, cookies, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		rr := postJSON(i.handleDevice, test.request, test.cookies)
+		if rr.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, rr.Code)
+			continue
+		}
+		if test.name == "details" {
+			var response DeviceResponse
+			if err = json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if response.ClientDetails == nil || response.ClientDetails.ID != "deviceclient" || !response.Scopes[oidc.ScopeEmail] {
+				t.Errorf("%s: unexpected response %v", test.name, rr.Body.String())
+			}
+		}
+	}
+
+	approved, err := i.deviceManager.Poll(deviceCode)
+	if err != nil {
+		t.Fatalf("poll after allow: %v", err)
+	}
+	if approved.Auth.Subject() != testUserID {
+		t.Errorf("approved for %v, want %v", approved.Auth.Subject(), testUserID)
+	}
+	if scopes := approved.Auth.AuthorizedScopes(); !scopes[oidc.ScopeOpenID] || scopes[oidc.ScopeEmail] {
+		t.Errorf("unexpected approved scopes %v", scopes)
+	}
+
+	deviceCode, record = create()
+	rr := postJSON(i.handleDevice, &DeviceRequest{UserCode: record.UserCode, Confirm: true}, cookies)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("deny: expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if _, err = i.deviceManager.Poll(deviceCode); err != device.ErrDenied {
+		t.Errorf("poll after deny: got %v want %v", err, device.ErrDenied)
+	}
+}
+
+func TestHelloConsentUser(t *testing.T) {
+	i, _ := newTestIdentifier(t)
+	i.authorizationEndpointURI, _ = url.Parse("https://konnect.example.com/konnect/v1/authorize")
+	err := i.clients.Register(&clients.ClientRegistration{
+		ID:           "consentclient",
+		RedirectURIs: []string{"https://client.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Users signed in by another identity manager are passed to the consent
+	// flow with the consent user cookie.
+	rr := httptest.NewRecorder()
+	err = i.SetUserToConsentUserCookie(context.Background(), rr, &IdentifiedUser{
+		sub:         "bob-id",
+		username:    "bob",
+		displayName: "Bob",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+
+	tests := []struct {
+		flow    string
+		success bool
+	}{
+		{FlowConsent, true},
+		{FlowOIDC, false},
+	}
+	for _, test := range tests {
+		rr = postJSON(i.handleHello, &HelloRequest{
+			State:          "test-state",
+			Flow:           test.flow,
+			RawScope:       "openid",
+			ClientID:       "consentclient",
+			RawRedirectURI: "https://client.example.com/cb",
+		}, cookies)
+
+		var response HelloResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Success != test.success {
+			t.Errorf("%s: got success %v want %v (status %d)", test.flow, response.Success, test.success, rr.Code)
+		}
+		if !test.success {
+			continue
+		}
+		if response.Username != "bob" || response.DisplayName != "Bob" {
+			t.Errorf("%s: got user %v (%v) want bob (Bob)", test.flow, response.Username, response.DisplayName)
+		}
+		if response.Next != FlowConsent {
+			t.Errorf("%s: got next %v want %v", test.flow, response.Next, FlowConsent)
+		}
+	}
+}
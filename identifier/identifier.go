@@ -25,13 +25,16 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/deckarep/golang-set"
 	"github.com/gorilla/mux"
+	"github.com/orcaman/concurrent-map"
 	"github.com/sirupsen/logrus"
 	jose "gopkg.in/square/go-jose.v2"
 	jwt "gopkg.in/square/go-jose.v2/jwt"
+	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect"
 	"stash.kopano.io/kc/konnect/identifier/backends"
@@ -41,6 +44,9 @@ import (
 	"stash.kopano.io/kc/konnect/identity/authorities"
 	"stash.kopano.io/kc/konnect/identity/clients"
 	"stash.kopano.io/kc/konnect/managers"
+	"stash.kopano.io/kc/konnect/oidc/consent"
+	"stash.kopano.io/kc/konnect/oidc/device"
+	"stash.kopano.io/kc/konnect/oidc/revocation"
 	"stash.kopano.io/kc/konnect/utils"
 )
 
@@ -51,6 +57,11 @@ import (
 // cookie.
 var audienceMarker = jwt.Audience([]string{"2019012201"})
 
+const (
+	consentUserCookieName = "__Secure-KKCU" // Kopano-Konnect-Consent-User
+	consentUserDuration   = 10 * time.Minute
+)
+
 // Identifier defines a identification login area with its endpoints using
 // a Kopano Core server as backend logon provider.
 type Identifier struct {
@@ -72,11 +83,22 @@ type Identifier struct {
 	clients     *clients.Registry
 	authorities *authorities.Registry
 
+	identityManager identity.Manager
+	deviceManager   device.Manager
+	consents        consent.Manager
+	revocations     revocation.Manager
+
+	// Logon sessions are only kept in memory, see LogonSession.
+	logonSessions      cmap.ConcurrentMap
+	logonSessionsMutex sync.Mutex
+
 	meta *meta.Meta
 
 	onSetLogonCallbacks   []func(ctx context.Context, rw http.ResponseWriter, user identity.User) error
 	onUnsetLogonCallbacks []func(ctx context.Context, rw http.ResponseWriter) error
 
+	onRevokeLogonSessionCallbacks []func(ctx context.Context, logonSessionID string) error
+
 	logger logrus.FieldLogger
 }
 
@@ -112,9 +134,13 @@ func NewIdentifier(c *Config) (*Identifier, error) {
 
 		backend: c.Backend,
 
+		logonSessions: cmap.New(),
+
 		onSetLogonCallbacks:   make([]func(ctx context.Context, rw http.ResponseWriter, user identity.User) error, 0),
 		onUnsetLogonCallbacks: make([]func(ctx context.Context, rw http.ResponseWriter) error, 0),
 
+		onRevokeLogonSessionCallbacks: make([]func(ctx context.Context, logonSessionID string) error, 0),
+
 		logger: c.Config.Logger,
 	}
 
@@ -133,6 +159,10 @@ func NewIdentifier(c *Config) (*Identifier, error) {
 func (i *Identifier) RegisterManagers(mgrs *managers.Managers) error {
 	i.clients = mgrs.Must("clients").(*clients.Registry)
 	i.authorities = mgrs.Must("authorities").(*authorities.Registry)
+	i.identityManager = mgrs.Must("identity").(identity.Manager)
+	i.deviceManager = mgrs.Must("device").(device.Manager)
+	i.consents = mgrs.Must("consent").(consent.Manager)
+	i.revocations = mgrs.Must("revocation").(revocation.Manager)
 
 	if service, ok := i.backend.(managers.ServiceUsesManagers); ok {
 		err := service.RegisterManagers(mgrs)
@@ -155,18 +185,26 @@ func (i *Identifier) AddRoutes(ctx context.Context, router *mux.Router) {
 	r.Handle("/chooseaccount", i).Methods(http.MethodGet)
 	r.Handle("/consent", i).Methods(http.MethodGet)
 	r.Handle("/welcome", i).Methods(http.MethodGet)
+	r.Handle("/device", i).Methods(http.MethodGet)
 	r.Handle("/goodbye", i).Methods(http.MethodGet)
 	r.Handle("/index.html", i).Methods(http.MethodGet) // For service worker.
 	r.Handle("/identifier/_/logon", i.secureHandler(http.HandlerFunc(i.handleLogon))).Methods(http.MethodPost)
 	r.Handle("/identifier/_/logoff", i.secureHandler(http.HandlerFunc(i.handleLogoff))).Methods(http.MethodPost)
 	r.Handle("/identifier/_/hello", i.secureHandler(http.HandlerFunc(i.handleHello))).Methods(http.MethodPost)
 	r.Handle("/identifier/_/consent", i.secureHandler(http.HandlerFunc(i.handleConsent))).Methods(http.MethodPost)
+	r.Handle("/identifier/_/device", i.secureHandler(http.HandlerFunc(i.handleDevice))).Methods(http.MethodPost)
+	r.Handle("/identifier/_/sessions", i.secureHandler(http.HandlerFunc(i.handleSessions))).Methods(http.MethodPost)
+	r.Handle("/identifier/_/sessions/revoke", i.secureHandler(http.HandlerFunc(i.handleSessionsRevoke))).Methods(http.MethodPost)
+	r.Handle("/identifier/_/consents", i.secureHandler(http.HandlerFunc(i.handleConsents))).Methods(http.MethodPost)
+	r.Handle("/identifier/_/consents/revoke", i.secureHandler(http.HandlerFunc(i.handleConsentsRevoke))).Methods(http.MethodPost)
 	r.Handle("/identifier/oauth2/start", http.HandlerFunc(i.handleOAuth2Start)).Methods(http.MethodGet)
 	r.Handle("/identifier/oauth2/cb", http.HandlerFunc(i.handleOAuth2Cb)).Methods(http.MethodGet)
 
 	if i.backend != nil {
 		i.backend.RunWithContext(ctx)
 	}
+
+	go i.runLogonSessionsCleanup(ctx)
 }
 
 // ServeHTTP implements the http.Handler interface.
@@ -249,6 +287,13 @@ func (i *Identifier) SetUserToLogonCookie(ctx context.Context, rw http.ResponseW
 	}
 	// User defined claims.
 	userClaims[UserClaimsClaim] = user.claims
+	// Authentication method references of the logon.
+	if len(user.amr) > 0 {
+		userClaims[AuthenticationMethodsClaim] = user.amr
+	}
+	// Logon session, so the logon can be listed and revoked.
+	user.logonSessionID = rndm.GenerateRandomString(32)
+	userClaims[LogonSessionIDClaim] = user.logonSessionID
 
 	// Serialize and encrypt cookie value.
 	serialized, err := jwt.Encrypted(i.encrypter).Claims(claims).Claims(userClaims).CompactSerialize()
@@ -261,6 +306,7 @@ func (i *Identifier) SetUserToLogonCookie(ctx context.Context, rw http.ResponseW
 	if err != nil {
 		return err
 	}
+	i.trackLogonSession(nil, user)
 	// Trigger callbacks.
 	for _, f := range i.onSetLogonCallbacks {
 		err = f(ctx, rw, user)
@@ -280,8 +326,9 @@ func (i *Identifier) UnsetLogonCookie(ctx context.Context, user *IdentifiedUser,
 	if err != nil {
 		return err
 	}
-	// Destroy backend user session if any.
+	// End logon session and destroy backend user session if any.
 	if user != nil {
+		i.endLogonSession(user)
 		if sessionRef := user.SessionRef(); sessionRef != nil {
 			err = i.backend.DestroySession(ctx, sessionRef)
 			if err != nil {
@@ -366,6 +413,15 @@ func (i *Identifier) GetUserFromLogonCookie(ctx context.Context, req *http.Reque
 		}
 	}
 
+	// Ignore logons of revoked logon sessions, before touching any backend
+	// session.
+	if v, _ := userClaims[LogonSessionIDClaim]; v != nil {
+		user.logonSessionID = v.(string)
+		if i.isLogonSessionRevoked(user) {
+			return nil, nil
+		}
+	}
+
 	// Get and refresh session via claim.
 	if v, _ := userClaims[SessionIDClaim]; v != nil {
 		sessionRef := v.(string)
@@ -392,6 +448,17 @@ func (i *Identifier) GetUserFromLogonCookie(ctx context.Context, req *http.Reque
 	if v, _ := userClaims[UserClaimsClaim]; v != nil {
 		user.claims = v.(map[string]interface{})
 	}
+	if v, _ := userClaims[AuthenticationMethodsClaim]; v != nil {
+		for _, method := range v.([]interface{}) {
+			if methodString, ok := method.(string); ok {
+				user.amr = append(user.amr, methodString)
+			}
+		}
+	}
+	if !i.trackLogonSession(req, user) {
+		// Ignore logons of revoked logon sessions.
+		return nil, nil
+	}
 
 	return user, nil
 }
@@ -486,6 +553,81 @@ func (i *Identifier) GetConsentFromConsentCookie(ctx context.Context, rw http.Re
 	return &consent, nil
 }
 
+// SetUserToConsentUserCookie serializes the provided user, who was signed in
+// by an identity manager other than the accociated Identifier, into an
+// encrypted string and sets it as cookie on the provided http.ResponseWriter.
+// This allows that user to pass the consent flow of the accociated Identifier.
+func (i *Identifier) SetUserToConsentUserCookie(ctx context.Context, rw http.ResponseWriter, user identity.User) error {
+	now := time.Now()
+	claims := jwt.Claims{
+		Audience: audienceMarker,
+		Subject:  user.Subject(),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(consentUserDuration)),
+	}
+	userClaims := make(map[string]interface{})
+	if userWithUsername, ok := user.(identity.UserWithUsername); ok {
+		userClaims[konnect.IdentifiedUsernameClaim] = userWithUsername.Username()
+	} else if userWithEmail, ok := user.(identity.UserWithEmail); ok {
+		userClaims[konnect.IdentifiedUsernameClaim] = userWithEmail.Email()
+	}
+	if userWithName, ok := user.(interface{ Name() string }); ok {
+		userClaims[konnect.IdentifiedDisplayNameClaim] = userWithName.Name()
+	}
+
+	serialized, err := jwt.Encrypted(i.encrypter).Claims(claims).Claims(userClaims).CompactSerialize()
+	if err != nil {
+		return err
+	}
+
+	return i.setConsentUserCookie(rw, serialized)
+}
+
+// GetUserFromConsentUserCookie looks up the consent user cookie from the
+// provided request, parses it and returns the user found in the cookie payload
+// data. The returned user is only good to be shown in the consent flow.
+func (i *Identifier) GetUserFromConsentUserCookie(ctx context.Context, req *http.Request) (*IdentifiedUser, error) {
+	cookie, err := i.getConsentUserCookie(req)
+	if err != nil {
+		if err == http.ErrNoCookie {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	token, err := jwt.ParseEncrypted(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.Claims
+	var userClaims map[string]interface{}
+	if err = token.Claims(i.recipient.Key, &claims, &userClaims); err != nil {
+		return nil, err
+	}
+	if err = claims.Validate(jwt.Expected{
+		Audience: audienceMarker,
+		Time:     time.Now(),
+	}); err != nil {
+		return nil, nil
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid subject in consent user token")
+	}
+
+	user := &IdentifiedUser{
+		sub: claims.Subject,
+	}
+	if v, _ := userClaims[konnect.IdentifiedUsernameClaim]; v != nil {
+		user.username, _ = v.(string)
+	}
+	if v, _ := userClaims[konnect.IdentifiedDisplayNameClaim]; v != nil {
+		user.displayName, _ = v.(string)
+	}
+
+	return user, nil
+}
+
 // SetStateToOAuth2StateCookie serializses the provided StateRequest and sets it
 // as cookie on the provided ReponseWriter.
 func (i *Identifier) SetStateToOAuth2StateCookie(ctx context.Context, rw http.ResponseWriter, sd *StateData) error {
@@ -533,6 +675,15 @@ func (i *Identifier) GetStateFromOAuth2StateCookie(ctx context.Context, rw http.
 	return sd, nil
 }
 
+// ConsentFormURI returns the URI of the accociated Identifier's web app page
+// which starts the consent flow.
+func (i *Identifier) ConsentFormURI() *url.URL {
+	u, _ := url.Parse(i.baseURI.String())
+	u.Path = i.pathPrefix + "/identifier"
+
+	return u
+}
+
 // Name returns the active identifiers backend's name.
 func (i *Identifier) Name() string {
 	return i.backend.Name()
@@ -571,3 +722,10 @@ func (i *Identifier) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseW
 	i.onUnsetLogonCallbacks = append(i.onUnsetLogonCallbacks, cb)
 	return nil
 }
+
+// OnRevokeLogonSession implements a way to register hooks whenever a logon
+// session is revoked at the accociated Identifier.
+func (i *Identifier) OnRevokeLogonSession(cb func(ctx context.Context, logonSessionID string) error) error {
+	i.onRevokeLogonSessionCallbacks = append(i.onRevokeLogonSessionCallbacks, cb)
+	return nil
+}
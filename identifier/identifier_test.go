@@ -0,0 +1,180 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identifier
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/config"
+	"stash.kopano.io/kc/konnect/identifier/backends"
+	"stash.kopano.io/kc/konnect/identifier/meta/scopes"
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/authorities"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+
+	consentManagers "stash.kopano.io/kc/konnect/oidc/consent/managers"
+	revocationManagers "stash.kopano.io/kc/konnect/oidc/revocation/managers"
+)
+
+var logger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.TextFormatter{DisableColors: true},
+	Level:     logrus.DebugLevel,
+}
+
+const (
+	testUsername = "alice"
+	testPassword = "secret"
+	testUserID   = "alice-id"
+)
+
+type testBackendUser struct {
+	sub      string
+	username string
+}
+
+func (u *testBackendUser) Subject() string {
+	return u.sub
+}
+
+func (u *testBackendUser) Username() string {
+	return u.username
+}
+
+func (u *testBackendUser) BackendClaims() map[string]interface{} {
+	return map[string]interface{}{
+		konnect.IdentifiedUserIDClaim: u.username + "-id",
+	}
+}
+
+// testBackend is an identifier backend which knows a single user and
+// records the sessions it destroys.
+type testBackend struct {
+	destroyedSessions []string
+}
+
+func (b *testBackend) RunWithContext(ctx context.Context) error {
+	return nil
+}
+
+func (b *testBackend) Logon(ctx context.Context, audience, username, password string) (bool, *string, *string, map[string]interface{}, error) {
+	if username != testUsername || password != testPassword {
+		return false, nil, nil, nil, nil
+	}
+	sub := testUsername + "-sub"
+	sessionRef := "session-" + audience
+	return true, &sub, &sessionRef, (&testBackendUser{sub, username}).BackendClaims(), nil
+}
+
+func (b *testBackend) GetUser(ctx context.Context, userID string, sessionRef *string) (backends.UserFromBackend, error) {
+	return &testBackendUser{testUsername + "-sub", testUsername}, nil
+}
+
+func (b *testBackend) ResolveUserByUsername(ctx context.Context, username string) (backends.UserFromBackend, error) {
+	if username != testUsername {
+		return nil, nil
+	}
+	return &testBackendUser{testUsername + "-sub", testUsername}, nil
+}
+
+func (b *testBackend) RefreshSession(ctx context.Context, userID string, sessionRef *string, claims map[string]interface{}) error {
+	return nil
+}
+
+func (b *testBackend) DestroySession(ctx context.Context, sessionRef *string) error {
+	b.destroyedSessions = append(b.destroyedSessions, *sessionRef)
+	return nil
+}
+
+func (b *testBackend) UserClaims(userID string, authorizedScopes map[string]bool) map[string]interface{} {
+	return nil
+}
+
+func (b *testBackend) ScopesSupported() []string {
+	return nil
+}
+
+func (b *testBackend) ScopesMeta() *scopes.Scopes {
+	return nil
+}
+
+func (b *testBackend) Name() string {
+	return "test"
+}
+
+// testIdentityManager is an identity manager which only knows how to fetch
+// users. All other methods panic.
+type testIdentityManager struct {
+	identity.Manager
+}
+
+func (im *testIdentityManager) Fetch(ctx context.Context, userID string, sessionRef *string, scopes map[string]bool, requestedClaimsMaps []*payload.ClaimsRequestMap) (identity.AuthRecord, bool, error) {
+	return identity.NewAuthRecord(im, userID, scopes, nil, nil), true, nil
+}
+
+func newTestIdentifier(t *testing.T) (*Identifier, *testBackend) {
+	staticFolder, err := ioutil.TempDir("", "konnect-identifier-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The index.html is read on creation, so the folder is not needed after.
+	defer os.RemoveAll(staticFolder)
+	err = ioutil.WriteFile(filepath.Join(staticFolder, "index.html"), []byte("<html></html>"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseURI, _ := url.Parse("https://konnect.example.com")
+	backend := &testBackend{}
+	i, err := NewIdentifier(&Config{
+		Config: &config.Config{
+			Logger: logger,
+		},
+
+		BaseURI:         baseURI,
+		StaticFolder:    staticFolder,
+		LogonCookieName: "__Secure-KKT",
+
+		Backend: backend,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = i.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	i.clients, _ = clients.NewRegistry(ctx, nil, "", logger)
+	i.authorities, _ = authorities.NewRegistry(ctx, "", logger)
+	i.identityManager = &testIdentityManager{}
+	i.consents = consentManagers.NewMemoryMapManager(ctx)
+	i.revocations = revocationManagers.NewMemoryMapManager(ctx)
+
+	return i, backend
+}
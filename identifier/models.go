@@ -106,6 +106,16 @@ type HelloResponse struct {
 	Scopes        map[string]bool  `json:"scopes,omitempty"`
 	ClientDetails *clients.Details `json:"client,omitempty"`
 	Meta          *meta.Meta       `json:"meta,omitempty"`
+
+	Authorities []*AuthorityInfo `json:"authorities,omitempty"`
+}
+
+// An AuthorityInfo holds the public information of an external authority
+// which a user can select to sign in with.
+type AuthorityInfo struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Default bool   `json:"default,omitempty"`
 }
 
 // A StateRequest is a general request with a state.
@@ -139,6 +149,60 @@ type ConsentRequest struct {
 	Nonce          string `json:"flow_nonce"`
 }
 
+// A DeviceRequest is the request data as sent to the device endpoint.
+type DeviceRequest struct {
+	State    string `json:"state"`
+	UserCode string `json:"user_code"`
+	Confirm  bool   `json:"confirm"`
+	Allow    bool   `json:"allow"`
+	RawScope string `json:"scope"`
+}
+
+// A DeviceResponse holds a response as sent by the device endpoint.
+type DeviceResponse struct {
+	Success bool   `json:"success"`
+	State   string `json:"state"`
+
+	Scopes        map[string]bool  `json:"scopes,omitempty"`
+	ClientDetails *clients.Details `json:"client,omitempty"`
+	Meta          *meta.Meta       `json:"meta,omitempty"`
+}
+
+// A SessionsRequest is the request data as sent to the sessions endpoints.
+type SessionsRequest struct {
+	State string `json:"state"`
+	ID    string `json:"id"`
+}
+
+// A SessionsResponse holds a response as sent by the sessions endpoint.
+type SessionsResponse struct {
+	Success bool   `json:"success"`
+	State   string `json:"state"`
+
+	Sessions []*LogonSession `json:"sessions"`
+}
+
+// A ConsentsRequest is the request data as sent to the consents endpoints.
+type ConsentsRequest struct {
+	State    string `json:"state"`
+	ClientID string `json:"client_id"`
+}
+
+// A ConsentsResponse holds a response as sent by the consents endpoint.
+type ConsentsResponse struct {
+	Success bool   `json:"success"`
+	State   string `json:"state"`
+
+	Consents []*GrantedConsent `json:"consents"`
+}
+
+// A GrantedConsent is a consent which the user granted to a client.
+type GrantedConsent struct {
+	ClientDetails *clients.Details `json:"client"`
+	Scopes        []string         `json:"scopes"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
 // Consent is the data received and sent to allow or cancel consent flows.
 type Consent struct {
 	Allow    bool   `json:"allow"`
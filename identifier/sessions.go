@@ -0,0 +1,225 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identifier
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	logonSessionIdleDuration = 30 * 24 * time.Hour
+
+	// Logon cookies do not expire by themselves, thus revoked logon sessions
+	// are remembered for a long time.
+	logonSessionRevocationDuration = 365 * 24 * time.Hour
+)
+
+// A LogonSession is a logon of a user at the identifier, as identified by the
+// logon session ID in the user's logon cookie.
+//
+// Logon sessions are kept in memory only and are not shared between multiple
+// instances. After a restart, a logon session is tracked again when its logon
+// cookie is used next. Revocations of logon sessions are persisted with the
+// revocation manager instead, so a revoked logon cookie stays rejected.
+type LogonSession struct {
+	ID         string    `json:"id"`
+	LogonAt    time.Time `json:"logon_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Current    bool      `json:"current,omitempty"`
+
+	sub        string
+	sessionRef *string
+	revoked    bool
+	expiresAt  time.Time
+}
+
+// trackLogonSession records the logon session of the provided user, creating
+// the session if it does not exist. It returns false if the logon session was
+// revoked.
+func (i *Identifier) trackLogonSession(req *http.Request, user *IdentifiedUser) bool {
+	if user.logonSessionID == "" {
+		return true
+	}
+
+	i.logonSessionsMutex.Lock()
+	defer i.logonSessionsMutex.Unlock()
+
+	now := time.Now()
+	var session *LogonSession
+	if stored, found := i.logonSessions.Get(user.logonSessionID); found {
+		session = stored.(*LogonSession)
+		if session.revoked || session.sub != user.Subject() {
+			return false
+		}
+	} else {
+		_, logonAt := user.LoggedOn()
+		session = &LogonSession{
+			ID:      user.logonSessionID,
+			LogonAt: logonAt,
+
+			sub:        user.Subject(),
+			sessionRef: user.SessionRef(),
+		}
+		i.logonSessions.Set(session.ID, session)
+	}
+	session.LastSeenAt = now
+	session.expiresAt = now.Add(logonSessionIdleDuration)
+	if req != nil {
+		session.UserAgent = req.UserAgent()
+	}
+
+	return true
+}
+
+// isLogonSessionRevoked returns true if the logon session of the provided user
+// was revoked. Revocations are persisted with the revocation manager, so they
+// are known even when the logon session itself is not.
+func (i *Identifier) isLogonSessionRevoked(user *IdentifiedUser) bool {
+	if user.logonSessionID == "" {
+		return false
+	}
+	if i.revocations.IsRevoked(user.logonSessionID) {
+		return true
+	}
+
+	i.logonSessionsMutex.Lock()
+	defer i.logonSessionsMutex.Unlock()
+
+	stored, found := i.logonSessions.Get(user.logonSessionID)
+	if !found {
+		return false
+	}
+	session := stored.(*LogonSession)
+
+	return session.revoked || session.sub != user.Subject()
+}
+
+// endLogonSession marks the logon session of the provided user as revoked,
+// for example when the user signs out. The backend session is left alone.
+func (i *Identifier) endLogonSession(user *IdentifiedUser) {
+	if user.logonSessionID == "" {
+		return
+	}
+
+	i.logonSessionsMutex.Lock()
+	if stored, found := i.logonSessions.Get(user.logonSessionID); found {
+		stored.(*LogonSession).revoked = true
+	}
+	i.logonSessionsMutex.Unlock()
+
+	i.persistLogonSessionRevocation(user.logonSessionID)
+}
+
+// persistLogonSessionRevocation records the revocation of the logon session
+// with the provided ID with the revocation manager. Refresh tokens which were
+// issued in the logon session are checked against the same record.
+func (i *Identifier) persistLogonSessionRevocation(id string) {
+	if err := i.revocations.Revoke(id, time.Now().Add(logonSessionRevocationDuration)); err != nil {
+		i.logger.WithError(err).Errorln("failed to persist logon session revocation")
+	}
+}
+
+// listLogonSessions returns the active logon sessions of the user with the
+// provided subject, sorted with the most recently seen first.
+func (i *Identifier) listLogonSessions(sub string) []*LogonSession {
+	i.logonSessionsMutex.Lock()
+	defer i.logonSessionsMutex.Unlock()
+
+	now := time.Now()
+	sessions := make([]*LogonSession, 0)
+	for entry := range i.logonSessions.IterBuffered() {
+		stored := entry.Val.(*LogonSession)
+		if stored.sub != sub || stored.revoked || stored.expiresAt.Before(now) {
+			continue
+		}
+		session := *stored
+		sessions = append(sessions, &session)
+	}
+	sort.Slice(sessions, func(a, b int) bool {
+		return sessions[a].LastSeenAt.After(sessions[b].LastSeenAt)
+	})
+
+	return sessions
+}
+
+// revokeLogonSession revokes the logon session with the provided ID of the
+// user with the provided subject and destroys its backend session. The
+// revocation is persisted, so its logon cookie is no longer accepted. Hooks
+// are triggered, so that the sessions and tokens of clients which were signed
+// in with the logon session end as well. It returns false if no such session
+// was found.
+func (i *Identifier) revokeLogonSession(ctx context.Context, sub string, id string) bool {
+	i.logonSessionsMutex.Lock()
+	stored, found := i.logonSessions.Get(id)
+	if !found || stored.(*LogonSession).sub != sub || stored.(*LogonSession).revoked {
+		i.logonSessionsMutex.Unlock()
+		return false
+	}
+	session := stored.(*LogonSession)
+	session.revoked = true
+	i.logonSessionsMutex.Unlock()
+
+	i.persistLogonSessionRevocation(id)
+
+	if session.sessionRef != nil {
+		if err := i.backend.DestroySession(ctx, session.sessionRef); err != nil {
+			i.logger.WithError(err).Warnln("failed to destroy session on logon session revoke")
+		}
+	}
+
+	// Trigger callbacks.
+	for _, f := range i.onRevokeLogonSessionCallbacks {
+		if err := f(ctx, id); err != nil {
+			i.logger.WithError(err).Warnln("logon session revoke callback failed")
+		}
+	}
+
+	return true
+}
+
+func (i *Identifier) purgeExpiredLogonSessions() {
+	var expired []string
+	now := time.Now()
+	i.logonSessionsMutex.Lock()
+	for entry := range i.logonSessions.IterBuffered() {
+		if entry.Val.(*LogonSession).expiresAt.Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, id := range expired {
+		i.logonSessions.Remove(id)
+	}
+	i.logonSessionsMutex.Unlock()
+}
+
+func (i *Identifier) runLogonSessionsCleanup(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			i.purgeExpiredLogonSessions()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
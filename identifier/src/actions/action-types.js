@@ -15,6 +15,12 @@ export const REQUEST_CONSENT_CANCEL = 'REQUEST_CONSENT_CANCEL';
 export const EXECUTE_CONSENT = 'EXECUTE_CONSENT';
 export const RECEIVE_CONSENT = 'RECEIVE_CONSENT';
 
+export const REQUEST_DEVICE = 'REQUEST_DEVICE';
+export const REQUEST_DEVICE_ALLOW = 'REQUEST_DEVICE_ALLOW';
+export const REQUEST_DEVICE_CANCEL = 'REQUEST_DEVICE_CANCEL';
+export const EXECUTE_DEVICE = 'EXECUTE_DEVICE';
+export const RECEIVE_DEVICE = 'RECEIVE_DEVICE';
+
 export const REQUEST_LOGOFF = 'REQUEST_LOGOFF';
 export const EXECUTE_LOGOFF = 'EXECUTE_LOGOFF';
 export const RECEIVE_LOGOFF = 'RECEIVE_LOGOFF';
@@ -11,6 +11,7 @@ import {
   ERROR_LOGIN_VALIDATE_MISSINGUSERNAME,
   ERROR_LOGIN_VALIDATE_MISSINGPASSWORD,
   ERROR_LOGIN_FAILED,
+  ERROR_DEVICE_INVALID_CODE,
   ERROR_HTTP_UNEXPECTED_RESPONSE_STATUS,
   ERROR_HTTP_UNEXPECTED_RESPONSE_STATE
 } from '../errors';
@@ -68,6 +69,27 @@ export function receiveConsent(logon) {
   };
 }
 
+export function requestDevice(confirm=false, allow=false) {
+  let type = types.REQUEST_DEVICE;
+  if (confirm) {
+    type = allow ? types.REQUEST_DEVICE_ALLOW : types.REQUEST_DEVICE_CANCEL;
+  }
+
+  return {
+    type
+  };
+}
+
+export function receiveDevice(device) {
+  const { success, errors } = device;
+
+  return {
+    type: types.RECEIVE_DEVICE,
+    success,
+    errors
+  };
+}
+
 export function executeLogon(username, password, mode=ModeLogonUsernamePassword) {
   return function(dispatch, getState) {
     dispatch(requestLogon(username, password));
@@ -202,6 +224,60 @@ export function executeConsent(allow=false, scope='') {
   };
 }
 
+export function executeDevice(userCode, confirm=false, allow=false, scope='') {
+  return function(dispatch) {
+    dispatch(requestDevice(confirm, allow));
+
+    const r = withClientRequestState({
+      user_code: userCode, // eslint-disable-line camelcase
+      confirm,
+      allow,
+      scope
+    });
+    return axios.post('./identifier/_/device', r, {
+      headers: {
+        'Kopano-Konnect-XSRF': '1'
+      }
+    }).then(response => {
+      switch (response.status) {
+        case 200:
+          // success.
+          return response.data;
+        case 204:
+          // invalid or expired user code.
+          return {
+            success: false,
+            state: response.headers['kopano-konnect-state'],
+            errors: {
+              http: new Error(ERROR_DEVICE_INVALID_CODE)
+            }
+          };
+        default:
+          // error.
+          throw new ExtendedError(ERROR_HTTP_UNEXPECTED_RESPONSE_STATUS, response);
+      }
+    }).then(response => {
+      if (response.state !== r.state) {
+        throw new ExtendedError(ERROR_HTTP_UNEXPECTED_RESPONSE_STATE, response);
+      }
+
+      dispatch(receiveDevice(response));
+      return Promise.resolve(response);
+    }).catch(error => {
+      error = handleAxiosError(error);
+      const errors = {
+        http: error
+      };
+
+      dispatch(receiveValidateLogon(errors));
+      return {
+        success: false,
+        errors: errors
+      };
+    });
+  };
+}
+
 export function validateUsernamePassword(username, password, isSignedIn) {
   return function(dispatch) {
     return new Promise((resolve, reject) => {
@@ -270,6 +346,14 @@ export function advanceLogonFlow(success, history, done=false, extraQuery={}) {
 
         break;
 
+      case 'device':
+        if (!done) {
+          history.replace(`/device${history.location.search}${history.location.hash}`);
+          return;
+        }
+
+        break;
+
       default:
         // Legacy stupid modes.
         if (q.continue && q.continue.indexOf(document.location.origin) === 0) {
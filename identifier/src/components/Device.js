@@ -0,0 +1,330 @@
+import React, { Component } from 'react';
+import PropTypes from 'prop-types';
+import { connect } from 'react-redux';
+
+import renderIf from 'render-if';
+import queryString from 'query-string';
+import { FormattedMessage } from 'react-intl';
+
+import { withStyles } from '@material-ui/core/styles';
+import Button from '@material-ui/core/Button';
+import CircularProgress from '@material-ui/core/CircularProgress';
+import green from '@material-ui/core/colors/green';
+import TextField from '@material-ui/core/TextField';
+import Typography from '@material-ui/core/Typography';
+import DialogActions from '@material-ui/core/DialogActions';
+
+import { executeDevice, receiveValidateLogon } from '../actions/login-actions';
+import { ErrorMessage } from '../errors';
+import { REQUEST_DEVICE, REQUEST_DEVICE_ALLOW } from '../actions/action-types';
+import ClientDisplayName from './ClientDisplayName';
+import ScopesList from './ScopesList';
+
+const styles = theme => ({
+  button: {
+    margin: theme.spacing.unit,
+    minWidth: 100
+  },
+  buttonProgress: {
+    color: green[500],
+    position: 'absolute',
+    top: '50%',
+    left: '50%',
+    marginTop: -12,
+    marginLeft: -12
+  },
+  subHeader: {
+    marginBottom: theme.spacing.unit * 2
+  },
+  scopesList: {
+    marginBottom: theme.spacing.unit * 2
+  },
+  wrapper: {
+    marginTop: theme.spacing.unit * 2,
+    position: 'relative',
+    display: 'inline-block'
+  },
+  message: {
+    marginTop: theme.spacing.unit * 2,
+    marginBottom: theme.spacing.unit * 2
+  }
+});
+
+class Device extends Component {
+  state = {
+    userCode: '',
+    device: null,
+    done: null
+  };
+
+  componentDidMount() {
+    const { dispatch, hello, query, pathPrefix } = this.props;
+    if (!hello || !hello.state) {
+      // Sign in first, the logon flow returns here afterwards.
+      const q = Object.assign({}, query, {flow: 'device'});
+      window.location.replace(`${pathPrefix}/identifier?${queryString.stringify(q)}`);
+      return;
+    }
+
+    dispatch(receiveValidateLogon({})); // XXX(longsleep): hack to reset loading and errors.
+
+    if (query.user_code) {
+      this.setState({
+        userCode: query.user_code
+      }, this.lookup);
+    }
+  }
+
+  handleChange = (event) => {
+    this.setState({
+      userCode: event.target.value
+    });
+  }
+
+  lookup = (event) => {
+    if (event) {
+      event.preventDefault();
+    }
+
+    const { dispatch } = this.props;
+    const { userCode } = this.state;
+    if (!userCode) {
+      return;
+    }
+
+    dispatch(executeDevice(userCode)).then((response) => {
+      if (response.success) {
+        this.setState({
+          device: response
+        });
+      }
+    });
+  }
+
+  action = (allow=false, scopes={}) => (event) => {
+    event.preventDefault();
+
+    if (allow === undefined) {
+      return;
+    }
+
+    // Convert all scopes which are true to a scope value.
+    const scope = Object.keys(scopes).filter(scope => {
+      return !!scopes[scope];
+    }).join(' ');
+
+    const { dispatch } = this.props;
+    const { userCode } = this.state;
+    dispatch(executeDevice(userCode, true, allow, scope)).then((response) => {
+      if (response.success) {
+        this.setState({
+          done: allow ? 'allowed' : 'denied'
+        });
+      }
+    });
+  }
+
+  renderUserCode() {
+    const { classes, loading, errors } = this.props;
+    const { userCode } = this.state;
+
+    return (
+      <form action="" onSubmit={this.lookup}>
+        <Typography variant="subtitle1" gutterBottom>
+          <FormattedMessage
+            id="konnect.device.userCode.message"
+            defaultMessage="Enter the code shown on your device.">
+          </FormattedMessage>
+        </Typography>
+        <TextField
+          label={<FormattedMessage id="konnect.device.userCode.label" defaultMessage="Code"></FormattedMessage>}
+          error={!!errors.http}
+          fullWidth
+          margin="normal"
+          autoFocus
+          autoComplete="off"
+          value={userCode}
+          onChange={this.handleChange}
+          disabled={!!loading}
+        />
+        <DialogActions>
+          <div className={classes.wrapper}>
+            <Button
+              type="submit"
+              color="primary"
+              variant="contained"
+              className={classes.button}
+              disabled={!!loading || !userCode}
+              onClick={this.lookup}
+            >
+              <FormattedMessage id="konnect.device.continueButton.label" defaultMessage="Continue"></FormattedMessage>
+            </Button>
+            {loading === REQUEST_DEVICE && <CircularProgress size={24} className={classes.buttonProgress} />}
+          </div>
+        </DialogActions>
+
+        {renderIf(errors.http)(() => (
+          <Typography variant="subtitle2" color="error" className={classes.message}>
+            <ErrorMessage error={errors.http}></ErrorMessage>
+          </Typography>
+        ))}
+      </form>
+    );
+  }
+
+  renderConsent() {
+    const { classes, loading, errors } = this.props;
+    const { device } = this.state;
+
+    const client = device.client || {};
+    const scopes = device.scopes || {};
+    const meta = device.meta || {};
+
+    return (
+      <div>
+        <Typography variant="subtitle1" gutterBottom>
+          <FormattedMessage
+            id="konnect.device.consent.message"
+            defaultMessage="{clientDisplayName} on your device wants to"
+            values={{clientDisplayName: <em><ClientDisplayName client={client}/></em>}}
+          ></FormattedMessage>
+        </Typography>
+        <ScopesList dense disablePadding className={classes.scopesList} scopes={scopes} meta={meta.scopes}></ScopesList>
+
+        <Typography variant="subtitle1" gutterBottom>
+          <FormattedMessage
+            id="konnect.consent.question"
+            defaultMessage="Allow {clientDisplayName} to do this?"
+            values={{
+              clientDisplayName: <em><ClientDisplayName client={client}/></em>
+            }}
+          ></FormattedMessage>
+        </Typography>
+        <Typography color="secondary">
+          <FormattedMessage
+            id="konnect.device.consent.consequence"
+            defaultMessage="By clicking Allow, you sign in on the device and allow it to use your information.">
+          </FormattedMessage>
+        </Typography>
+
+        <form action="" onSubmit={this.action(undefined, scopes)}>
+          <DialogActions>
+            <div className={classes.wrapper}>
+              <Button
+                color="secondary"
+                className={classes.button}
+                disabled={!!loading}
+                onClick={this.action(false, scopes)}
+              >
+                <FormattedMessage id="konnect.consent.cancelButton.label" defaultMessage="Cancel"></FormattedMessage>
+              </Button>
+              {(loading && loading !== REQUEST_DEVICE_ALLOW) &&
+                <CircularProgress size={24} className={classes.buttonProgress} />}
+            </div>
+            <div className={classes.wrapper}>
+              <Button
+                type="submit"
+                color="primary"
+                variant="contained"
+                className={classes.button}
+                disabled={!!loading}
+                onClick={this.action(true, scopes)}
+              >
+                <FormattedMessage id="konnect.consent.allowButton.label" defaultMessage="Allow"></FormattedMessage>
+              </Button>
+              {loading === REQUEST_DEVICE_ALLOW && <CircularProgress size={24} className={classes.buttonProgress} />}
+            </div>
+          </DialogActions>
+
+          {renderIf(errors.http)(() => (
+            <Typography variant="subtitle2" color="error" className={classes.message}>
+              <ErrorMessage error={errors.http}></ErrorMessage>
+            </Typography>
+          ))}
+        </form>
+      </div>
+    );
+  }
+
+  renderDone() {
+    const { done } = this.state;
+
+    return (
+      <Typography variant="subtitle1" gutterBottom>
+        {done === 'allowed' ?
+          <FormattedMessage
+            id="konnect.device.done.allowed"
+            defaultMessage="Your device is now signed in. You can close this window and return to your device.">
+          </FormattedMessage> :
+          <FormattedMessage
+            id="konnect.device.done.denied"
+            defaultMessage="The request of your device has been denied. You can close this window.">
+          </FormattedMessage>
+        }
+      </Typography>
+    );
+  }
+
+  render() {
+    const { classes, hello } = this.props;
+    const { device, done } = this.state;
+
+    if (!hello || !hello.state) {
+      return null;
+    }
+
+    let content;
+    if (done) {
+      content = this.renderDone();
+    } else if (device) {
+      content = this.renderConsent();
+    } else {
+      content = this.renderUserCode();
+    }
+
+    return (
+      <div>
+        <Typography variant="h5" component="h3">
+          <FormattedMessage
+            id="konnect.device.headline"
+            defaultMessage="Hi {displayName}"
+            values={{displayName: hello.displayName}}>
+          </FormattedMessage>
+        </Typography>
+        <Typography variant="subtitle1" className={classes.subHeader}>
+          {hello.username}
+        </Typography>
+
+        {content}
+      </div>
+    );
+  }
+}
+
+Device.propTypes = {
+  classes: PropTypes.object.isRequired,
+
+  loading: PropTypes.string.isRequired,
+  errors: PropTypes.object.isRequired,
+  hello: PropTypes.object,
+  query: PropTypes.object.isRequired,
+  pathPrefix: PropTypes.string.isRequired,
+
+  dispatch: PropTypes.func.isRequired,
+  history: PropTypes.object.isRequired
+};
+
+const mapStateToProps = (state) => {
+  const { hello, query, pathPrefix } = state.common;
+  const { loading, errors } = state.login;
+
+  return {
+    loading: loading,
+    errors,
+    hello,
+    query,
+    pathPrefix
+  };
+};
+
+export default connect(mapStateToProps)(withStyles(styles)(Device));
@@ -4,6 +4,7 @@ import { connect } from 'react-redux';
 
 import renderIf from 'render-if';
 import { FormattedMessage } from 'react-intl';
+import queryString from 'query-string';
 
 import { withStyles } from '@material-ui/core/styles';
 import Button from '@material-ui/core/Button';
@@ -40,6 +41,12 @@ const styles = theme => ({
     marginTop: theme.spacing.unit * 2,
     marginBottom: theme.spacing.unit * 2
   },
+  authorities: {
+    marginTop: theme.spacing.unit * 2
+  },
+  authorityButton: {
+    marginTop: theme.spacing.unit
+  },
   input: {
     // NOTE(longsleep): These styles here allow JavaScript events to trigger
     // when the browser auto fills form elements. They require additional
@@ -92,7 +99,8 @@ class Login extends Component {
   }
 
   render() {
-    const { loading, errors, classes, username } = this.props;
+    const { loading, errors, classes, username, hello } = this.props;
+    const authorities = (hello && hello.details && hello.details.authorities) || [];
 
     const inputProps = {
       username: {
@@ -176,10 +184,44 @@ class Login extends Component {
             </Typography>
           ))}
         </form>
+
+        {renderIf(authorities.length > 0)(() => (
+          <div className={classes.authorities}>
+            {authorities.map(authority => (
+              <Button
+                key={authority.id}
+                fullWidth
+                variant="outlined"
+                className={classes.authorityButton}
+                disabled={!!loading}
+                href={this.authorityStartURI(authority)}
+              >
+                <FormattedMessage
+                  id="konnect.login.authorityButton.label"
+                  defaultMessage="Sign in with {name}"
+                  values={{name: authority.name}}>
+                </FormattedMessage>
+              </Button>
+            ))}
+          </div>
+        ))}
       </div>
     );
   }
 
+  authorityStartURI(authority) {
+    const { flow, query, pathPrefix } = this.props;
+
+    const q = Object.assign({}, query, {
+      authority_id: authority.id // eslint-disable-line camelcase
+    });
+    if (flow) {
+      q.flow = flow;
+    }
+
+    return `${pathPrefix}/identifier/oauth2/start?${queryString.stringify(q)}`;
+  }
+
   handleChange(name) {
     return event => {
       this.props.dispatch(updateInput(name, event.target.value));
@@ -206,7 +248,9 @@ Login.propTypes = {
   password: PropTypes.string.isRequired,
   errors: PropTypes.object.isRequired,
   hello: PropTypes.object,
+  flow: PropTypes.string.isRequired,
   query: PropTypes.object.isRequired,
+  pathPrefix: PropTypes.string.isRequired,
 
   dispatch: PropTypes.func.isRequired,
   history: PropTypes.object.isRequired
@@ -214,7 +258,7 @@ Login.propTypes = {
 
 const mapStateToProps = (state) => {
   const { loading, username, password, errors} = state.login;
-  const { hello, query } = state.common;
+  const { hello, flow, query, pathPrefix } = state.common;
 
   return {
     loading,
@@ -222,7 +266,9 @@ const mapStateToProps = (state) => {
     password,
     errors,
     hello,
-    query
+    flow,
+    query,
+    pathPrefix
   };
 };
 
@@ -10,6 +10,7 @@ import ResponsiveScreen from './ResponsiveScreen';
 import Login from './Login';
 import Chooseaccount from './Chooseaccount';
 import Consent from './Consent';
+import Device from './Device';
 import RedirectWithQuery from './RedirectWithQuery';
 
 import { executeHello } from '../actions/common-actions';
@@ -32,6 +33,7 @@ class Loginscreen extends React.PureComponent {
           <Route path="/identifier" exact component={Login}></Route>
           <Route path="/chooseaccount" exact component={Chooseaccount}></Route>
           <Route path="/consent" exact component={Consent}></Route>
+          <Route path="/device" exact component={Device}></Route>
           <RedirectWithQuery target="/identifier"/>
         </Switch>
       </ResponsiveScreen>
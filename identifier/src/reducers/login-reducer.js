@@ -6,6 +6,10 @@ import {
   REQUEST_CONSENT_ALLOW,
   REQUEST_CONSENT_CANCEL,
   RECEIVE_CONSENT,
+  REQUEST_DEVICE,
+  REQUEST_DEVICE_ALLOW,
+  REQUEST_DEVICE_CANCEL,
+  RECEIVE_DEVICE,
   UPDATE_INPUT
 } from '../actions/action-types';
 
@@ -24,6 +28,9 @@ function loginReducer(state = {
 
     case REQUEST_CONSENT_ALLOW:
     case REQUEST_CONSENT_CANCEL:
+    case REQUEST_DEVICE:
+    case REQUEST_DEVICE_ALLOW:
+    case REQUEST_DEVICE_CANCEL:
     case REQUEST_LOGON:
       return Object.assign({}, state, {
         loading: action.type,
@@ -40,6 +47,12 @@ function loginReducer(state = {
       }
       return state;
 
+    case RECEIVE_DEVICE:
+      return Object.assign({}, state, {
+        errors: action.errors ? action.errors : {},
+        loading: ''
+      });
+
     case RECEIVE_LOGOFF:
       return Object.assign({}, state, {
         username: '',
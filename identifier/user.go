@@ -48,7 +48,9 @@ type IdentifiedUser struct {
 	sessionRef *string
 	claims     map[string]interface{}
 
-	logonAt time.Time
+	logonAt        time.Time
+	amr            []string
+	logonSessionID string
 }
 
 // Subject returns the associated users subject field. The subject is the main
@@ -134,6 +136,17 @@ func (u *IdentifiedUser) LoggedOn() (bool, time.Time) {
 	return !u.logonAt.IsZero(), u.logonAt
 }
 
+// AuthenticationMethods returns the authentication method references of the
+// accociated users logon.
+func (u *IdentifiedUser) AuthenticationMethods() []string {
+	return u.amr
+}
+
+// LogonSessionID returns the ID of the accociated users logon session.
+func (u *IdentifiedUser) LogonSessionID() string {
+	return u.logonSessionID
+}
+
 // SessionRef returns the accociated users underlaying session reference.
 func (u *IdentifiedUser) SessionRef() *string {
 	return u.sessionRef
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identity
+
+import (
+	"stash.kopano.io/kc/konnect/oidc/payload"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+)
+
+// acrLevels maps the authentication context class reference values known to
+// Konnect to their level. Higher levels satisfy lower levels.
+var acrLevels = map[string]int{
+	konnectoidc.ACRValueNone:         0,
+	konnectoidc.ACRValueSingleFactor: 1,
+}
+
+// ACRFromAMR returns the authentication context class reference value which
+// is reached with the provided authentication method references.
+func ACRFromAMR(amr []string) string {
+	for _, method := range amr {
+		switch method {
+		case konnectoidc.AMRValuePassword:
+			fallthrough
+		case konnectoidc.AMRValueWindowsIntegrated:
+			fallthrough
+		case konnectoidc.AMRValueFederated:
+			return konnectoidc.ACRValueSingleFactor
+		}
+	}
+
+	return konnectoidc.ACRValueNone
+}
+
+// MatchACR returns the requested authentication context class reference value
+// with the highest level which is satisfied by the provided acr and true. If
+// none of the known requested values is satisfied, the provided acr and false
+// is returned. Unknown requested values are ignored and the provided acr is
+// returned with true if no known values are requested at all.
+func MatchACR(acr string, requested []string) (string, bool) {
+	level, ok := acrLevels[acr]
+	if !ok {
+		level = -1
+	}
+
+	matched := ""
+	matchedLevel := -1
+	known := false
+	for _, value := range requested {
+		requestedLevel, ok := acrLevels[value]
+		if !ok {
+			continue
+		}
+		known = true
+		if requestedLevel <= level && requestedLevel > matchedLevel {
+			matched = value
+			matchedLevel = requestedLevel
+		}
+	}
+
+	if matched != "" {
+		return matched, true
+	}
+
+	return acr, !known
+}
+
+// SatisfiesRequestedACR checks the authentication context class reference
+// which is reached by the provided authentication method references against
+// the values requested by the provided authentication request. It returns
+// true if the request is satisfied and true if the request requires the acr
+// as essential claim.
+func SatisfiesRequestedACR(ar *payload.AuthenticationRequest, amr []string) (bool, bool) {
+	requested, essential := ar.RequestedACRValues()
+	if len(requested) == 0 {
+		return true, false
+	}
+
+	_, satisfied := MatchACR(ACRFromAMR(amr), requested)
+	return satisfied, essential
+}
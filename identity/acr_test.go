@@ -0,0 +1,68 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package identity
+
+import (
+	"testing"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+)
+
+func TestACRFromAMR(t *testing.T) {
+	tests := []struct {
+		amr      []string
+		expected string
+	}{
+		{nil, konnectoidc.ACRValueNone},
+		{[]string{konnectoidc.AMRValueCookie}, konnectoidc.ACRValueNone},
+		{[]string{konnectoidc.AMRValuePassword}, konnectoidc.ACRValueSingleFactor},
+		{[]string{konnectoidc.AMRValueWindowsIntegrated}, konnectoidc.ACRValueSingleFactor},
+		{[]string{konnectoidc.AMRValueFederated}, konnectoidc.ACRValueSingleFactor},
+		{[]string{konnectoidc.AMRValueCookie, konnectoidc.AMRValuePassword}, konnectoidc.ACRValueSingleFactor},
+	}
+
+	for _, test := range tests {
+		if acr := ACRFromAMR(test.amr); acr != test.expected {
+			t.Errorf("amr %v: expected acr %q, got %q", test.amr, test.expected, acr)
+		}
+	}
+}
+
+func TestMatchACR(t *testing.T) {
+	tests := []struct {
+		acr       string
+		requested []string
+		expected  string
+		satisfied bool
+	}{
+		{konnectoidc.ACRValueNone, nil, konnectoidc.ACRValueNone, true},
+		{konnectoidc.ACRValueNone, []string{"urn:unknown"}, konnectoidc.ACRValueNone, true},
+		{konnectoidc.ACRValueNone, []string{konnectoidc.ACRValueSingleFactor}, konnectoidc.ACRValueNone, false},
+		{konnectoidc.ACRValueSingleFactor, []string{konnectoidc.ACRValueSingleFactor}, konnectoidc.ACRValueSingleFactor, true},
+		{konnectoidc.ACRValueSingleFactor, []string{konnectoidc.ACRValueNone}, konnectoidc.ACRValueNone, true},
+		{konnectoidc.ACRValueSingleFactor, []string{konnectoidc.ACRValueNone, konnectoidc.ACRValueSingleFactor}, konnectoidc.ACRValueSingleFactor, true},
+		{"urn:unknown", []string{konnectoidc.ACRValueNone}, "urn:unknown", false},
+	}
+
+	for _, test := range tests {
+		acr, satisfied := MatchACR(test.acr, test.requested)
+		if acr != test.expected || satisfied != test.satisfied {
+			t.Errorf("acr %q requested %v: expected %q/%v, got %q/%v", test.acr, test.requested, test.expected, test.satisfied, acr, satisfied)
+		}
+	}
+}
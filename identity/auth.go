@@ -40,4 +40,7 @@ type AuthRecord interface {
 
 	LoggedOn() (bool, time.Time)
 	SetAuthTime(time.Time)
+
+	AuthenticationMethods() []string
+	SetAuthenticationMethods([]string)
 }
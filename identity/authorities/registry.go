@@ -34,6 +34,7 @@ type Registry struct {
 
 	defaultID   string
 	authorities map[string]*AuthorityRegistration
+	ids         []string
 
 	logger logrus.FieldLogger
 }
@@ -64,7 +65,10 @@ func NewRegistry(ctx context.Context, registrationConfFilepath string, logger lo
 	var defaultAuthority *AuthorityRegistration
 	for _, authority := range registryData.Authorities {
 		validateErr := authority.Validate()
-		registerErr := r.Register(authority)
+		var registerErr error
+		if validateErr == nil {
+			registerErr = r.Register(authority)
+		}
 		fields := logrus.Fields{
 			"id":                 authority.ID,
 			"client_id":          authority.ClientID,
@@ -84,15 +88,12 @@ func NewRegistry(ctx context.Context, registrationConfFilepath string, logger lo
 			logger.WithError(registerErr).WithFields(fields).Warnln("skipped registration of invalid authority")
 			continue
 		}
-		if authority.Default || defaultAuthority == nil {
-			if defaultAuthority == nil || !defaultAuthority.Default {
+		if authority.Default {
+			if defaultAuthority == nil {
 				defaultAuthority = authority
 			} else {
-				logger.Warnln("ignored default authority flag since already have a default")
+				logger.WithFields(fields).Warnln("ignored default authority flag since already have a default")
 			}
-		} else {
-			// TODO(longsleep): Implement authority selection.
-			logger.Warnln("non-default additional authorities are not supported yet")
 		}
 
 		go func() {
@@ -105,12 +106,10 @@ func NewRegistry(ctx context.Context, registrationConfFilepath string, logger lo
 	}
 
 	if defaultAuthority != nil {
-		if defaultAuthority.Default {
-			r.defaultID = defaultAuthority.ID
-			logger.WithField("id", defaultAuthority.ID).Infoln("using external default authority")
-		} else {
-			logger.Warnln("non-default authorities are not supported yet")
-		}
+		logger.WithField("id", defaultAuthority.ID).Infoln("using external default authority")
+	}
+	if count := len(r.ids); count > 0 {
+		logger.WithField("count", count).Infoln("external authorities available for selection")
 	}
 
 	return r, nil
@@ -153,7 +152,14 @@ func (r *Registry) Register(authority *AuthorityRegistration) error {
 
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	if _, exists := r.authorities[authority.ID]; !exists {
+		r.ids = append(r.ids, authority.ID)
+	}
 	r.authorities[authority.ID] = authority
+	if authority.Default && r.defaultID == "" {
+		// First registered default authority becomes the default.
+		r.defaultID = authority.ID
+	}
 
 	return nil
 }
@@ -212,6 +218,37 @@ func (r *Registry) Get(ctx context.Context, authorityID string) (*AuthorityRegis
 
 // Default returns the default authority from the associated registry if any.
 func (r *Registry) Default(ctx context.Context) *Details {
-	authority, _ := r.Lookup(ctx, r.defaultID)
+	r.mutex.RLock()
+	defaultID := r.defaultID
+	r.mutex.RUnlock()
+
+	authority, _ := r.Lookup(ctx, defaultID)
 	return authority
 }
+
+// List returns the authority Details of all authorities of the associated
+// registry in the order they were registered.
+func (r *Registry) List(ctx context.Context) []*Details {
+	r.mutex.RLock()
+	ids := make([]string, len(r.ids))
+	copy(ids, r.ids)
+	r.mutex.RUnlock()
+
+	authorities := make([]*Details, 0, len(ids))
+	for _, id := range ids {
+		if authority, err := r.Lookup(ctx, id); err == nil {
+			authorities = append(authorities, authority)
+		}
+	}
+
+	return authorities
+}
+
+// IsDefault returns true if the provided authority ID is the ID of the default
+// authority of the associated registry.
+func (r *Registry) IsDefault(authorityID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return authorityID != "" && authorityID == r.defaultID
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package authorities
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.TextFormatter{DisableColors: true},
+	Level:     logrus.DebugLevel,
+}
+
+const testRegistrationConf = `
+authorities:
+  - id: first
+    client_id: first-client
+    authority_type: oidc
+    discover: false
+    insecure: true
+    authorization_endpoint: https://first.example.com/authorize
+  - id: second
+    client_id: second-client
+    name: Second
+    authority_type: oidc
+    default: yes
+    discover: false
+    insecure: true
+    authorization_endpoint: https://second.example.com/authorize
+  - id: invalid
+    client_id: invalid-client
+    authority_type: oidc
+    discover: false
+    insecure: true
+    authorization_endpoint: http://invalid.example.com/authorize
+  - id: third
+    client_id: third-client
+    authority_type: oidc
+    default: yes
+    discover: false
+    insecure: true
+    authorization_endpoint: https://third.example.com/authorize
+`
+
+func TestNewRegistryWithMultipleAuthorities(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, err := ioutil.TempFile("", "konnect-authorities-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(testRegistrationConf); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := NewRegistry(ctx, f.Name(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid authorities are skipped and the order is kept.
+	list := r.List(ctx)
+	expected := []string{"first", "second", "third"}
+	if len(list) != len(expected) {
+		t.Fatalf("got %d authorities want %d", len(list), len(expected))
+	}
+	for idx, authority := range list {
+		if authority.ID != expected[idx] {
+			t.Errorf("authority %d: got %v want %v", idx, authority.ID, expected[idx])
+		}
+	}
+	if _, err = r.Lookup(ctx, "invalid"); err == nil {
+		t.Errorf("invalid authority was registered")
+	}
+
+	// The first authority with default flag is the default.
+	if authority := r.Default(ctx); authority == nil || authority.ID != "second" {
+		t.Errorf("got default authority %v want second", authority)
+	}
+	for _, id := range expected {
+		if isDefault := r.IsDefault(id); isDefault != (id == "second") {
+			t.Errorf("%s: got default %v", id, isDefault)
+		}
+	}
+	if r.IsDefault("") {
+		t.Errorf("empty authority id must not be default")
+	}
+
+	// Registering again replaces the registration at its position.
+	err = r.Register(&AuthorityRegistration{
+		ID:            "first",
+		Name:          "First",
+		ClientID:      "first-client",
+		AuthorityType: AuthorityTypeOIDC,
+		Default:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list = r.List(ctx)
+	if len(list) != len(expected) || list[0].ID != "first" || list[0].Name != "First" {
+		t.Errorf("re-registration changed the list: %v", list)
+	}
+	if r.IsDefault("first") {
+		t.Errorf("re-registration with default flag replaced the default")
+	}
+}
@@ -35,6 +35,7 @@ type authRecord struct {
 
 	user     PublicUser
 	authTime time.Time
+	amr      []string
 }
 
 // NewAuthRecord returns a implementation of identity.AuthRecord holding
@@ -127,3 +128,13 @@ func (r *authRecord) LoggedOn() (bool, time.Time) {
 func (r *authRecord) SetAuthTime(authTime time.Time) {
 	r.authTime = authTime
 }
+
+// AuthenticationMethods implements the identity.AuthRecord interface.
+func (r *authRecord) AuthenticationMethods() []string {
+	return r.amr
+}
+
+// SetAuthenticationMethods implements the identity.AuthRecord interface.
+func (r *authRecord) SetAuthenticationMethods(amr []string) {
+	r.amr = amr
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mendsley/gojwk"
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kc/konnect/utils"
+)
+
+// fileStoreRecord is the persisted form of a memoryStoreRecord. It carries
+// the client registration fields which are not part of the registration's
+// JSON representation explicitly.
+type fileStoreRecord struct {
+	Registration *ClientRegistration `json:"registration,omitempty"`
+
+	Secret     string          `json:"secret,omitempty"`
+	IDIssuedAt int64           `json:"id_issued_at,omitempty"`
+	Origins    []string        `json:"origins,omitempty"`
+	RawJWKS    json.RawMessage `json:"jwks,omitempty"`
+
+	Deleted   bool  `json:"deleted,omitempty"`
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// fileStore implements a Store which keeps the changes of dynamic clients in
+// memory and persists them to a JSON file on every change, so changed and
+// deleted dynamic clients survive restarts.
+type fileStore struct {
+	*memoryStore
+
+	fn     string
+	mutex  sync.Mutex
+	logger logrus.FieldLogger
+}
+
+// NewFileStore creates a new Store which persists its data to the provided
+// file name. Existing records are loaded from the file if it exists.
+func NewFileStore(ctx context.Context, fn string, logger logrus.FieldLogger) (Store, error) {
+	s := &fileStore{
+		memoryStore: newMemoryStore(),
+
+		fn:     fn,
+		logger: logger,
+	}
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.purgeExpired() > 0 {
+					if saveErr := s.save(); saveErr != nil {
+						s.logger.WithError(saveErr).Errorln("failed to save client store file after purge")
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *fileStore) load() error {
+	entries := make(map[string]*fileStoreRecord)
+	if _, err := utils.ReadJSONFile(s.fn, &entries); err != nil {
+		return fmt.Errorf("failed to load client store file: %v", err)
+	}
+
+	now := time.Now()
+	for clientID, entry := range entries {
+		expiresAt := time.Unix(entry.ExpiresAt, 0)
+		if expiresAt.Before(now) {
+			continue
+		}
+		record := &memoryStoreRecord{
+			deleted:   entry.Deleted,
+			expiresAt: expiresAt,
+		}
+		if !entry.Deleted {
+			if entry.Registration == nil {
+				return fmt.Errorf("failed to load client store file: missing registration for client %v", clientID)
+			}
+			client := entry.Registration
+			client.ID = clientID
+			client.Secret = entry.Secret
+			client.Dynamic = true
+			client.IDIssuedAt = entry.IDIssuedAt
+			client.SecretExpiresAt = entry.ExpiresAt
+			client.Origins = entry.Origins
+			if entry.RawJWKS != nil {
+				jwks, err := gojwk.Unmarshal(entry.RawJWKS)
+				if err != nil {
+					return fmt.Errorf("failed to load client store file jwks for client %v: %v", clientID, err)
+				}
+				client.JWKS = &gojwk.Key{
+					Keys: jwks.Keys,
+				}
+			}
+			record.client = client
+		}
+		s.records[clientID] = record
+	}
+
+	return nil
+}
+
+func (s *fileStore) save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := make(map[string]*fileStoreRecord)
+	s.memoryStore.mutex.RLock()
+	for clientID, record := range s.records {
+		entry := &fileStoreRecord{
+			Deleted:   record.deleted,
+			ExpiresAt: record.expiresAt.Unix(),
+		}
+		if client := record.client; client != nil {
+			entry.Registration = client
+			entry.Secret = client.Secret
+			entry.IDIssuedAt = client.IDIssuedAt
+			entry.Origins = client.Origins
+			if client.JWKS != nil {
+				rawJWKS, err := json.Marshal(client.JWKS)
+				if err != nil {
+					s.memoryStore.mutex.RUnlock()
+					return fmt.Errorf("failed to encode jwks for client %v: %v", clientID, err)
+				}
+				entry.RawJWKS = rawJWKS
+			}
+		}
+		entries[clientID] = entry
+	}
+	s.memoryStore.mutex.RUnlock()
+
+	return utils.WriteJSONFile(s.fn, entries)
+}
+
+// Set stores the provided client registration and persists the result to the
+// accociated file.
+func (s *fileStore) Set(ctx context.Context, client *ClientRegistration) error {
+	err := s.memoryStore.Set(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	err = s.save()
+	if err != nil {
+		return fmt.Errorf("failed to save client store file: %v", err)
+	}
+
+	return nil
+}
+
+// Delete marks the provided client registration as deleted and persists the
+// result to the accociated file.
+func (s *fileStore) Delete(ctx context.Context, client *ClientRegistration) error {
+	err := s.memoryStore.Delete(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	err = s.save()
+	if err != nil {
+		return fmt.Errorf("failed to save client store file: %v", err)
+	}
+
+	return nil
+}
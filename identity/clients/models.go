@@ -23,13 +23,17 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/mendsley/gojwk"
 	"golang.org/x/crypto/blake2b"
 	_ "gopkg.in/yaml.v2" // Make sure we have yaml.
+	"stash.kopano.io/kgol/oidc-go"
 	"stash.kopano.io/kgol/rndm"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 )
 
 // Constat data used with dynamic stateless clients.
@@ -48,9 +52,13 @@ type ClientRegistration struct {
 	ID     string `yaml:"id" json:"-"`
 	Secret string `yaml:"secret" json:"-"`
 
-	Trusted       bool     `yaml:"trusted" json:"-"`
-	TrustedScopes []string `yaml:"trusted_scopes" json:"-"`
-	Insecure      bool     `yaml:"insecure" json:"-"`
+	Trusted          bool     `yaml:"trusted" json:"-"`
+	TrustedScopes    []string `yaml:"trusted_scopes" json:"-"`
+	AllowedScopes    []string `yaml:"allowed_scopes" json:"-"`
+	AllowedResources []string `yaml:"allowed_resources" json:"-"`
+	Insecure         bool     `yaml:"insecure" json:"-"`
+
+	AccessTokenProfile string `yaml:"access_token_profile" json:"-"`
 
 	Dynamic         bool  `yaml:"-" json:"-"`
 	IDIssuedAt      int64 `yaml:"-" json:"-"`
@@ -60,6 +68,7 @@ type ClientRegistration struct {
 	Name            string   `yaml:"name" json:"name,omitempty"`
 	URI             string   `yaml:"uri"  json:"uri,omitempty"`
 	GrantTypes      []string `yaml:"grant_types,flow" json:"grant_types,omitempty"`
+	ResponseTypes   []string `yaml:"response_types,flow" json:"response_types,omitempty"`
 	ApplicationType string   `yaml:"application_type"  json:"application_type,omitempty"`
 
 	RedirectURIs []string `yaml:"redirect_uris,flow" json:"redirect_uris,omitempty"`
@@ -73,15 +82,105 @@ type ClientRegistration struct {
 	RawTokenEndpointAuthMethod     string `yaml:"token_endpoint_auth_method" json:"token_endpoint_auth_method,omitempty"`
 	RawTokenEndpointAuthSigningAlg string `yaml:"token_endpoint_auth_signing_alg"  json:"token_endpoint_auth_signing_alg,omitempty"`
 
+	RawAuthorizationSignedResponseAlg string `yaml:"authorization_signed_response_alg" json:"authorization_signed_response_alg,omitempty"`
+
+	RawUserInfoEncryptedResponseAlg string `yaml:"userinfo_encrypted_response_alg" json:"userinfo_encrypted_response_alg,omitempty"`
+	RawUserInfoEncryptedResponseEnc string `yaml:"userinfo_encrypted_response_enc" json:"userinfo_encrypted_response_enc,omitempty"`
+
 	PostLogoutRedirectURIs []string `yaml:"post_logout_redirect_uris,flow" json:"post_logout_redirect_uris,omitempty"`
+
+	BackChannelLogoutURI             string `yaml:"backchannel_logout_uri" json:"backchannel_logout_uri,omitempty"`
+	BackChannelLogoutSessionRequired bool   `yaml:"backchannel_logout_session_required" json:"backchannel_logout_session_required,omitempty"`
+
+	FrontChannelLogoutURI             string `yaml:"frontchannel_logout_uri" json:"frontchannel_logout_uri,omitempty"`
+	FrontChannelLogoutSessionRequired bool   `yaml:"frontchannel_logout_session_required" json:"frontchannel_logout_session_required,omitempty"`
+
+	RequirePushedAuthorizationRequests bool `yaml:"require_pushed_authorization_requests" json:"require_pushed_authorization_requests,omitempty"`
+
+	SubjectType         string `yaml:"subject_type" json:"subject_type,omitempty"`
+	SectorIdentifierURI string `yaml:"sector_identifier_uri" json:"sector_identifier_uri,omitempty"`
+
+	TLSClientAuthSubjectDN                string `yaml:"tls_client_auth_subject_dn" json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANDNS                   string `yaml:"tls_client_auth_san_dns" json:"tls_client_auth_san_dns,omitempty"`
+	TLSClientAuthSANURI                   string `yaml:"tls_client_auth_san_uri" json:"tls_client_auth_san_uri,omitempty"`
+	TLSClientAuthSANIP                    string `yaml:"tls_client_auth_san_ip" json:"tls_client_auth_san_ip,omitempty"`
+	TLSClientAuthSANEmail                 string `yaml:"tls_client_auth_san_email" json:"tls_client_auth_san_email,omitempty"`
+	TLSClientCertificateBoundAccessTokens bool   `yaml:"tls_client_certificate_bound_access_tokens" json:"tls_client_certificate_bound_access_tokens,omitempty"`
 }
 
 // Validate validates the associated client registration data and returns error
 // if the data is not valid.
 func (cr *ClientRegistration) Validate() error {
+	switch cr.AccessTokenProfile {
+	case "", konnectoidc.AccessTokenProfileKonnect, konnectoidc.AccessTokenProfileJWT:
+		// breaks
+	default:
+		return fmt.Errorf("unknown access_token_profile: %s", cr.AccessTokenProfile)
+	}
+
+	switch cr.SubjectType {
+	case "", oidc.SubjectIDPublic:
+		// breaks
+	case oidc.SubjectIDPairwise:
+		if _, err := cr.SectorIdentifier(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown subject_type: %s", cr.SubjectType)
+	}
+
 	return nil
 }
 
+// IsAllowedResource returns true if the provided resource is in the list of
+// allowed resources of the accociated client registration.
+func (cr *ClientRegistration) IsAllowedResource(resource string) bool {
+	for _, allowedResource := range cr.AllowedResources {
+		if allowedResource == resource {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EncryptionKey looks up the key to be used for encryption with the provided
+// JWE key management algorithm from the accociated client registration and
+// returns its kid and public key part. Keys which are registered for other use
+// than encryption, for another algorithm or which are of a key type not usable
+// with the provided algorithm are ignored.
+func (cr *ClientRegistration) EncryptionKey(alg string) (string, crypto.PublicKey, error) {
+	if cr.JWKS == nil {
+		return "", nil, fmt.Errorf("no client keys registered")
+	}
+
+	var kty string
+	switch {
+	case strings.HasPrefix(alg, "RSA"):
+		kty = "RSA"
+	case strings.HasPrefix(alg, "ECDH-ES"):
+		kty = "EC"
+	default:
+		return "", nil, fmt.Errorf("unsupported encryption alg")
+	}
+
+	for _, k := range cr.JWKS.Keys {
+		if k.Use != "" && k.Use != "enc" {
+			continue
+		}
+		if k.Kty != kty || (k.Alg != "" && k.Alg != alg) {
+			continue
+		}
+		key, err := k.DecodePublicKey()
+		if err != nil {
+			return "", nil, err
+		}
+		return k.Kid, key, nil
+	}
+
+	return "", nil, fmt.Errorf("no client encryption key registered")
+}
+
 // Secure looks up the a matching key from the accociated client registration
 // and returns its public key part as a secured client.
 func (cr *ClientRegistration) Secure(rawKid interface{}) (*Secured, error) {
@@ -180,6 +279,47 @@ func (cr *ClientRegistration) SetDynamic(ctx context.Context, creator func(ctx c
 	return nil
 }
 
+// UpdateDynamic fills in the identity of the accociated dynamic client
+// registration into the provided update so it can replace the accociated
+// registration. The client secret is bound to the client name, thus it is
+// renewed when the name changes. The provided client secret is kept for the
+// renewal if not empty, otherwise a new client secret is created and returned.
+func (cr *ClientRegistration) UpdateDynamic(update *ClientRegistration, clientSecret string) (string, error) {
+	if !cr.Dynamic {
+		return "", fmt.Errorf("not a dynamic client")
+	}
+
+	var secret []byte
+	if clientSecret != "" {
+		if valid, err := cr.validateSecret(clientSecret); !valid {
+			return "", fmt.Errorf("invalid client_secret: %v", err)
+		}
+		secret, _ = base64.RawURLEncoding.DecodeString(clientSecret)
+	}
+
+	update.ID = cr.ID
+	update.Secret = cr.Secret
+	update.Dynamic = true
+	update.IDIssuedAt = cr.IDIssuedAt
+	update.SecretExpiresAt = cr.SecretExpiresAt
+
+	if update.Name == cr.Name {
+		return "", nil
+	}
+
+	sub, newSecret, err := update.makeSecret(secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to make dynamic client secret: %v", err)
+	}
+	update.Secret = sub
+	if secret != nil {
+		// Client keeps its secret.
+		return "", nil
+	}
+
+	return newSecret, nil
+}
+
 func (cr *ClientRegistration) makeSecret(secret []byte) (string, string, error) {
 	// Create random secret. HMAC the client name with it to get the subject.
 	if secret == nil {
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/mendsley/gojwk"
+)
+
+func encodeTestKeyInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestEncryptionKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK := func(kid string, use string, alg string) *gojwk.Key {
+		return &gojwk.Key{
+			Kid: kid,
+			Use: use,
+			Alg: alg,
+			Kty: "RSA",
+			N:   encodeTestKeyInt(rsaKey.N),
+			E:   encodeTestKeyInt(big.NewInt(int64(rsaKey.E))),
+		}
+	}
+	ecJWK := func(kid string, use string, alg string) *gojwk.Key {
+		return &gojwk.Key{
+			Kid: kid,
+			Use: use,
+			Alg: alg,
+			Kty: "EC",
+			Crv: "P-256",
+			X:   encodeTestKeyInt(ecKey.X),
+			Y:   encodeTestKeyInt(ecKey.Y),
+		}
+	}
+
+	tests := []struct {
+		name string
+		keys []*gojwk.Key
+		alg  string
+		kid  string
+	}{
+		{"rsa", []*gojwk.Key{rsaJWK("rsa-sig", "sig", ""), ecJWK("ec-enc", "enc", ""), rsaJWK("rsa-enc", "enc", "")}, "RSA-OAEP", "rsa-enc"},
+		{"ec", []*gojwk.Key{rsaJWK("rsa-enc", "enc", ""), ecJWK("ec-enc", "enc", "")}, "ECDH-ES", "ec-enc"},
+		{"alg match", []*gojwk.Key{rsaJWK("rsa-oaep", "enc", "RSA-OAEP"), rsaJWK("rsa-oaep-256", "enc", "RSA-OAEP-256")}, "RSA-OAEP-256", "rsa-oaep-256"},
+		{"alg mismatch", []*gojwk.Key{ecJWK("ec-enc", "enc", "ECDH-ES")}, "ECDH-ES+A128KW", ""},
+		{"sig only", []*gojwk.Key{rsaJWK("rsa-sig", "sig", "")}, "RSA-OAEP", ""},
+		{"unset use", []*gojwk.Key{ecJWK("ec", "", "")}, "ECDH-ES", "ec"},
+		{"unsupported alg", []*gojwk.Key{rsaJWK("rsa-enc", "enc", "")}, "A128KW", ""},
+	}
+	for _, test := range tests {
+		cr := &ClientRegistration{
+			JWKS: &gojwk.Key{
+				Keys: test.keys,
+			},
+		}
+		kid, key, err := cr.EncryptionKey(test.alg)
+		if test.kid == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got key %v", test.name, kid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if kid != test.kid {
+			t.Errorf("%s: got kid %v want %v", test.name, kid, test.kid)
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if test.alg[:3] != "RSA" {
+				t.Errorf("%s: got RSA key for %v", test.name, test.alg)
+			}
+		case *ecdsa.PublicKey:
+			if test.alg[:4] != "ECDH" {
+				t.Errorf("%s: got EC key for %v", test.name, test.alg)
+			}
+		default:
+			t.Errorf("%s: unexpected key type %T", test.name, key)
+		}
+	}
+}
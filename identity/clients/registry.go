@@ -32,6 +32,9 @@ import (
 	"stash.kopano.io/kgol/oidc-go"
 )
 
+// ErrClientNotFound is the error returned when a client is not known.
+var ErrClientNotFound = errors.New("client not found")
+
 // Registry implements the registry for registered clients.
 type Registry struct {
 	mutex sync.RWMutex
@@ -39,9 +42,13 @@ type Registry struct {
 	trustedURI *url.URL
 	clients    map[string]*ClientRegistration
 
+	pairwiseSubjectSecret []byte
+
 	StatelessCreator   func(ctx context.Context, signingMethod jwt.SigningMethod, claims jwt.Claims) (string, error)
 	StatelessValidator func(token *jwt.Token) (interface{}, error)
 
+	Store Store
+
 	logger logrus.FieldLogger
 }
 
@@ -66,12 +73,12 @@ func NewRegistry(ctx context.Context, trustedURI *url.URL, registrationConfFilep
 		trustedURI: trustedURI,
 		clients:    make(map[string]*ClientRegistration),
 
+		Store: NewMemoryStore(ctx),
+
 		logger: logger,
 	}
 
 	for _, client := range registryData.Clients {
-		validateErr := client.Validate()
-		registerErr := r.Register(client)
 		fields := logrus.Fields{
 			"client_id":          client.ID,
 			"with_client_secret": client.Secret != "",
@@ -82,11 +89,15 @@ func NewRegistry(ctx context.Context, trustedURI *url.URL, registrationConfFilep
 			"origins":            client.Origins,
 		}
 
+		validateErr := client.Validate()
+		if validateErr == nil {
+			validateErr = client.ValidateSectorIdentifierURI(ctx)
+		}
 		if validateErr != nil {
 			logger.WithError(validateErr).WithFields(fields).Warnln("skipped registration of invalid client entry")
 			continue
 		}
-		if registerErr != nil {
+		if registerErr := r.Register(client); registerErr != nil {
 			logger.WithError(registerErr).WithFields(fields).Warnln("skipped registration of invalid client")
 			continue
 		}
@@ -162,6 +173,10 @@ func (r *Registry) Register(client *ClientRegistration) error {
 // Validate checks if the provided client registration data complies to the
 // provided parameters and returns error when it does not.
 func (r *Registry) Validate(client *ClientRegistration, clientSecret string, redirectURIString string, originURIString string, withoutSecret bool) error {
+	if client.SubjectType == oidc.SubjectIDPairwise && !r.PairwiseSubjectsSupported() {
+		return ErrPairwiseSubjectsNotSupported
+	}
+
 	if client.ApplicationType == oidc.ApplicationTypeWeb {
 		if originURIString != "" && (!client.Insecure || len(client.Origins) > 0) {
 			// Compare originURI if it was given.
@@ -243,7 +258,7 @@ func (r *Registry) Lookup(ctx context.Context, clientID string, clientSecret str
 
 	// Lookup dynamic clients when it makes sense.
 	if dynamic && registration == nil {
-		registration, _ = r.getDynamicClient(clientID)
+		registration, _ = r.getDynamicClient(ctx, clientID)
 	}
 
 	if registration != nil {
@@ -296,13 +311,52 @@ func (r *Registry) Get(ctx context.Context, clientID string) (*ClientRegistratio
 	if ok {
 		return registration, true
 	}
+	if !strings.HasPrefix(clientID, DynamicStatelessClientIDPrefix) {
+		return nil, false
+	}
+
+	return r.getDynamicClient(ctx, clientID)
+}
+
+// Update replaces the registration of the dynamic client with the ID of the
+// provided client registration in the accociated registry's store.
+func (r *Registry) Update(ctx context.Context, client *ClientRegistration) error {
+	if !client.Dynamic {
+		return errors.New("not a dynamic client")
+	}
+	if r.Store == nil {
+		return errors.New("no dynamic client store")
+	}
+
+	return r.Store.Set(ctx, client)
+}
+
+// Delete removes the provided dynamic client registration from the accociated
+// registry. Deleted clients are no longer returned by Get and Lookup.
+func (r *Registry) Delete(ctx context.Context, client *ClientRegistration) error {
+	if !client.Dynamic {
+		return errors.New("not a dynamic client")
+	}
+	if r.Store == nil {
+		return errors.New("no dynamic client store")
+	}
 
-	return r.getDynamicClient(clientID)
+	return r.Store.Delete(ctx, client)
 }
 
-func (r *Registry) getDynamicClient(clientID string) (*ClientRegistration, bool) {
+func (r *Registry) getDynamicClient(ctx context.Context, clientID string) (*ClientRegistration, bool) {
 	var registration *ClientRegistration
 
+	// Changes to dynamic clients take precedence over the stateless data.
+	if r.Store != nil {
+		if r.Store.IsDeleted(ctx, clientID) {
+			return nil, false
+		}
+		if stored, ok := r.Store.Get(ctx, clientID); ok {
+			return stored, true
+		}
+	}
+
 	tokenString := clientID[len(DynamicStatelessClientIDPrefix):]
 	if token, err := jwt.ParseWithClaims(tokenString, &RegistrationClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if r.StatelessValidator == nil {
@@ -316,6 +370,8 @@ func (r *Registry) getDynamicClient(clientID string) (*ClientRegistration, bool)
 			registration.ID = clientID
 			registration.Secret = claims.StandardClaims.Subject
 			registration.Dynamic = true
+			registration.IDIssuedAt = claims.StandardClaims.IssuedAt
+			registration.SecretExpiresAt = claims.StandardClaims.ExpiresAt
 		}
 	}
 
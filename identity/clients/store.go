@@ -0,0 +1,139 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store is a interface defining a store which persists changes to dynamic
+// clients. Dynamic clients are stateless until they are changed.
+type Store interface {
+	Set(ctx context.Context, client *ClientRegistration) error
+	Get(ctx context.Context, clientID string) (*ClientRegistration, bool)
+	Delete(ctx context.Context, client *ClientRegistration) error
+	IsDeleted(ctx context.Context, clientID string) bool
+}
+
+type memoryStoreRecord struct {
+	client    *ClientRegistration
+	deleted   bool
+	expiresAt time.Time
+}
+
+// memoryStore implements a Store which keeps the changes of dynamic clients in
+// memory until the changed clients expire.
+type memoryStore struct {
+	mutex   sync.RWMutex
+	records map[string]*memoryStoreRecord
+}
+
+// NewMemoryStore creates a new Store which keeps its data in memory.
+func NewMemoryStore(ctx context.Context) Store {
+	s := newMemoryStore()
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		records: make(map[string]*memoryStoreRecord),
+	}
+}
+
+func (s *memoryStore) purgeExpired() int {
+	purged := 0
+	now := time.Now()
+	s.mutex.Lock()
+	for clientID, record := range s.records {
+		if record.expiresAt.Before(now) {
+			delete(s.records, clientID)
+			purged++
+		}
+	}
+	s.mutex.Unlock()
+
+	return purged
+}
+
+// Set stores the provided client registration.
+func (s *memoryStore) Set(ctx context.Context, client *ClientRegistration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if record, ok := s.records[client.ID]; ok && record.deleted {
+		return ErrClientNotFound
+	}
+	s.records[client.ID] = &memoryStoreRecord{
+		client:    client,
+		expiresAt: time.Unix(client.SecretExpiresAt, 0),
+	}
+
+	return nil
+}
+
+// Get returns the stored client registration for the provided client ID.
+func (s *memoryStore) Get(ctx context.Context, clientID string) (*ClientRegistration, bool) {
+	s.mutex.RLock()
+	record, ok := s.records[clientID]
+	s.mutex.RUnlock()
+	if !ok || record.deleted || record.expiresAt.Before(time.Now()) {
+		return nil, false
+	}
+
+	return record.client, true
+}
+
+// Delete marks the provided client registration as deleted.
+func (s *memoryStore) Delete(ctx context.Context, client *ClientRegistration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.records[client.ID] = &memoryStoreRecord{
+		deleted:   true,
+		expiresAt: time.Unix(client.SecretExpiresAt, 0),
+	}
+
+	return nil
+}
+
+// IsDeleted returns true if the client registration with the provided client
+// ID was deleted.
+func (s *memoryStore) IsDeleted(ctx context.Context, clientID string) bool {
+	s.mutex.RLock()
+	record, ok := s.records[clientID]
+	s.mutex.RUnlock()
+
+	return ok && record.deleted
+}
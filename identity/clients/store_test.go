@@ -0,0 +1,131 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDynamicClient(id string, expiresAt time.Time) *ClientRegistration {
+	return &ClientRegistration{
+		ID:              DynamicStatelessClientIDPrefix + id,
+		Secret:          id + "-secret",
+		Dynamic:         true,
+		IDIssuedAt:      time.Now().Unix(),
+		SecretExpiresAt: expiresAt.Unix(),
+
+		Name:         id,
+		RedirectURIs: []string{"https://" + id + ".example.com/cb"},
+		Origins:      []string{"https://" + id + ".example.com"},
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempDir, err := ioutil.TempDir("", "konnect-clients-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	fn := filepath.Join(tempDir, "clients.json")
+
+	s, err := NewFileStore(ctx, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := newTestDynamicClient("updated", time.Now().Add(time.Hour))
+	deleted := newTestDynamicClient("deleted", time.Now().Add(time.Hour))
+	expired := newTestDynamicClient("expired", time.Now().Add(-time.Minute))
+	for _, client := range []*ClientRegistration{updated, deleted, expired} {
+		if err = s.Set(ctx, client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(ctx, deleted); err != ErrClientNotFound {
+		t.Errorf("set of deleted client must fail with %v, got %v", ErrClientNotFound, err)
+	}
+
+	// Load the file into a new store to check persistence.
+	reloaded, err := NewFileStore(ctx, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clientID  string
+		found     bool
+		isDeleted bool
+	}{
+		{updated.ID, true, false},
+		{deleted.ID, false, true},
+		{expired.ID, false, false},
+		{DynamicStatelessClientIDPrefix + "unknown", false, false},
+	}
+	for _, test := range tests {
+		client, found := reloaded.Get(ctx, test.clientID)
+		if found != test.found {
+			t.Errorf("client %v found mismatch, got %v, expected %v", test.clientID, found, test.found)
+		}
+		if isDeleted := reloaded.IsDeleted(ctx, test.clientID); isDeleted != test.isDeleted {
+			t.Errorf("client %v deleted mismatch, got %v, expected %v", test.clientID, isDeleted, test.isDeleted)
+		}
+		if !found {
+			continue
+		}
+		if client.ID != updated.ID || client.Secret != updated.Secret || !client.Dynamic {
+			t.Errorf("client %v identity not restored: %+v", test.clientID, client)
+		}
+		if client.IDIssuedAt != updated.IDIssuedAt || client.SecretExpiresAt != updated.SecretExpiresAt {
+			t.Errorf("client %v timestamps not restored: %+v", test.clientID, client)
+		}
+		if client.Name != updated.Name || len(client.RedirectURIs) != 1 || client.RedirectURIs[0] != updated.RedirectURIs[0] {
+			t.Errorf("client %v registration not restored: %+v", test.clientID, client)
+		}
+		if len(client.Origins) != 1 || client.Origins[0] != updated.Origins[0] {
+			t.Errorf("client %v origins not restored: %v", test.clientID, client.Origins)
+		}
+	}
+}
+
+func TestRegistryWithoutStore(t *testing.T) {
+	ctx := context.Background()
+
+	r := &Registry{}
+	client := newTestDynamicClient("nostore", time.Now().Add(time.Hour))
+
+	if _, ok := r.Get(ctx, client.ID); ok {
+		t.Errorf("unexpected dynamic client without store and validator")
+	}
+	if err := r.Update(ctx, client); err == nil {
+		t.Errorf("update without store must fail")
+	}
+	if err := r.Delete(ctx, client); err == nil {
+		t.Errorf("delete without store must fail")
+	}
+}
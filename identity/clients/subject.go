@@ -0,0 +1,190 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"stash.kopano.io/kgol/oidc-go"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/utils"
+)
+
+// ErrPairwiseSubjectsNotSupported is the error returned for clients with the
+// pairwise subject type when no pairwise subject secret is set.
+var ErrPairwiseSubjectsNotSupported = errors.New("pairwise subject type not supported")
+
+const (
+	minPairwiseSubjectSecretSize = 32
+
+	sectorIdentifierURITimeout = 10 * time.Second
+)
+
+// SectorIdentifier returns the sector identifier of the accociated client
+// registration as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#PairwiseAlg. It is
+// the host of the sector_identifier_uri if set and otherwise the host of the
+// registered redirect URIs, which then all must use the same host.
+func (cr *ClientRegistration) SectorIdentifier() (string, error) {
+	if cr.SectorIdentifierURI != "" {
+		uri, err := url.Parse(cr.SectorIdentifierURI)
+		if err != nil || uri.Scheme != "https" || uri.Host == "" {
+			return "", errors.New("invalid sector_identifier_uri")
+		}
+
+		return uri.Host, nil
+	}
+
+	host := ""
+	for _, uriString := range cr.RedirectURIs {
+		uri, err := url.Parse(uriString)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse redirect_uris: %v", err)
+		}
+		if host != "" && uri.Host != host {
+			return "", errors.New("sector_identifier_uri required with multiple redirect_uris hosts")
+		}
+		host = uri.Host
+	}
+	if host == "" {
+		return "", errors.New("no sector identifier")
+	}
+
+	return host, nil
+}
+
+// ValidateSectorIdentifierURI fetches the sector_identifier_uri of the
+// accociated client registration if any and validates that it contains all
+// registered redirect URIs as specified at
+// https://openid.net/specs/openid-connect-registration-1_0.html#SectorIdentifierValidation.
+// The fetch is bounded by a timeout, since it blocks startup and registration.
+func (cr *ClientRegistration) ValidateSectorIdentifierURI(ctx context.Context) error {
+	if cr.SectorIdentifierURI == "" {
+		return nil
+	}
+	if _, err := cr.SectorIdentifier(); err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, cr.SectorIdentifierURI, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	ctx, cancel := context.WithTimeout(ctx, sectorIdentifierURITimeout)
+	defer cancel()
+
+	response, err := utils.DefaultHTTPClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to fetch sector_identifier_uri: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected sector_identifier_uri response status: %d", response.StatusCode)
+	}
+
+	var sectorRedirectURIs []string
+	err = json.NewDecoder(response.Body).Decode(&sectorRedirectURIs)
+	if err != nil {
+		return fmt.Errorf("failed to parse sector_identifier_uri response: %v", err)
+	}
+
+	sectorRedirectURIsMap := make(map[string]bool)
+	for _, uriString := range sectorRedirectURIs {
+		sectorRedirectURIsMap[uriString] = true
+	}
+	for _, uriString := range cr.RedirectURIs {
+		if !sectorRedirectURIsMap[uriString] {
+			return fmt.Errorf("redirect_uri not in sector_identifier_uri: %s", uriString)
+		}
+	}
+
+	return nil
+}
+
+// SetPairwiseSubjectSecret sets the provided secret as the key which is used
+// to derive pairwise subjects. Clients with the pairwise subject type are
+// refused as long as no secret is set.
+func (r *Registry) SetPairwiseSubjectSecret(secret []byte) error {
+	if len(secret) < minPairwiseSubjectSecretSize || len(secret) > blake2b.Size {
+		return fmt.Errorf("invalid pairwise subject secret size - must be between %d and %d bytes", minPairwiseSubjectSecretSize, blake2b.Size)
+	}
+
+	r.mutex.Lock()
+	r.pairwiseSubjectSecret = secret
+	r.mutex.Unlock()
+
+	return nil
+}
+
+// PairwiseSubjectsSupported returns true if the accociated registry has a
+// secret to derive pairwise subjects.
+func (r *Registry) PairwiseSubjectsSupported() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.pairwiseSubjectSecret) > 0
+}
+
+// PublicSubject returns the subject identifier of the provided subject as it
+// is presented to the client identified by the provided client ID, following
+// the subject type of the clients registration as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#SubjectIDTypes.
+func (r *Registry) PublicSubject(ctx context.Context, clientID string, sub string) (string, error) {
+	registration, _ := r.Get(ctx, clientID)
+	if registration == nil || registration.SubjectType != oidc.SubjectIDPairwise {
+		return sub, nil
+	}
+
+	sectorIdentifier, err := registration.SectorIdentifier()
+	if err != nil {
+		return "", err
+	}
+
+	r.mutex.RLock()
+	secret := r.pairwiseSubjectSecret
+	r.mutex.RUnlock()
+	if len(secret) == 0 {
+		return "", ErrPairwiseSubjectsNotSupported
+	}
+
+	hasher, err := blake2b.New512(secret)
+	if err != nil {
+		return "", err
+	}
+
+	hasher.Write([]byte(konnectoidc.KonnectPairwiseSubjectSaltV1))
+	hasher.Write([]byte(sectorIdentifier))
+	hasher.Write([]byte(" "))
+	hasher.Write([]byte(sub))
+
+	// Use the same URL safe encoding as for public subjects.
+	s := base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+	return s + "@konnect", nil
+}
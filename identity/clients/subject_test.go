@@ -0,0 +1,190 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"stash.kopano.io/kgol/oidc-go"
+)
+
+var logger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.TextFormatter{DisableColors: true},
+	Level:     logrus.DebugLevel,
+}
+
+func newTestPairwiseRegistry(ctx context.Context, t *testing.T) *Registry {
+	r, err := NewRegistry(ctx, nil, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range []*ClientRegistration{
+		{ID: "public", RedirectURIs: []string{"https://a.example.com/cb"}},
+		{ID: "pairwise-a1", SubjectType: oidc.SubjectIDPairwise, RedirectURIs: []string{"https://a.example.com/cb"}},
+		{ID: "pairwise-a2", SubjectType: oidc.SubjectIDPairwise, RedirectURIs: []string{"https://a.example.com/other"}},
+		{ID: "pairwise-b", SubjectType: oidc.SubjectIDPairwise, RedirectURIs: []string{"https://b.example.com/cb"}},
+	} {
+		if err = r.Register(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return r
+}
+
+func TestSetPairwiseSubjectSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		size  int
+		valid bool
+	}{
+		{0, false},
+		{16, false},
+		{32, true},
+		{64, true},
+		{65, false},
+	}
+	for _, test := range tests {
+		r := newTestPairwiseRegistry(ctx, t)
+		err := r.SetPairwiseSubjectSecret(make([]byte, test.size))
+		if (err == nil) != test.valid {
+			t.Errorf("secret size %d: got err %v, want valid %v", test.size, err, test.valid)
+		}
+		if r.PairwiseSubjectsSupported() != test.valid {
+			t.Errorf("secret size %d: pairwise subjects supported mismatch", test.size)
+		}
+	}
+}
+
+func TestPairwiseSubjectsRequireSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := newTestPairwiseRegistry(ctx, t)
+
+	if _, err := r.PublicSubject(ctx, "pairwise-a1", "user"); err != ErrPairwiseSubjectsNotSupported {
+		t.Errorf("expected pairwise subject to be refused without secret, got %v", err)
+	}
+	redirectURI, _ := url.Parse("https://a.example.com/cb")
+	if _, err := r.Lookup(ctx, "pairwise-a1", "", redirectURI, "", true); err != ErrPairwiseSubjectsNotSupported {
+		t.Errorf("expected pairwise client lookup to be refused without secret, got %v", err)
+	}
+	if sub, err := r.PublicSubject(ctx, "public", "user"); err != nil || sub != "user" {
+		t.Errorf("expected public subject without secret, got %v %v", sub, err)
+	}
+}
+
+func TestPairwiseSubjects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := newTestPairwiseRegistry(ctx, t)
+	if err := r.SetPairwiseSubjectSecret([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+
+	subjects := make(map[string]string)
+	for _, clientID := range []string{"public", "pairwise-a1", "pairwise-a2", "pairwise-b"} {
+		sub, err := r.PublicSubject(ctx, clientID, "user")
+		if err != nil {
+			t.Fatalf("%s: %v", clientID, err)
+		}
+		subjects[clientID] = sub
+	}
+
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"pairwise-a1", "pairwise-a2", true},
+		{"pairwise-a1", "pairwise-b", false},
+		{"pairwise-a1", "public", false},
+	}
+	for _, test := range tests {
+		if (subjects[test.a] == subjects[test.b]) != test.equal {
+			t.Errorf("%s and %s: subjects %q and %q, want equal %v", test.a, test.b, subjects[test.a], subjects[test.b], test.equal)
+		}
+	}
+	if subjects["public"] != "user" {
+		t.Errorf("public client got subject %q", subjects["public"])
+	}
+}
+
+func TestNewRegistryRegistersOnlyValidClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The sector identifier URI is served with a certificate which is not
+	// trusted, so its validation fails.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`["https://sector.example.com/cb"]`))
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "konnect-clients-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	fn := filepath.Join(tempDir, "identifier-registration.yaml")
+	err = ioutil.WriteFile(fn, []byte(`clients:
+  - id: valid
+    redirect_uris: ["https://valid.example.com/cb"]
+  - id: invalid-subject-type
+    subject_type: unknown
+    redirect_uris: ["https://invalid.example.com/cb"]
+  - id: invalid-sector
+    subject_type: pairwise
+    sector_identifier_uri: `+server.URL+`
+    redirect_uris: ["https://sector.example.com/cb"]
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRegistry(ctx, nil, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clientID   string
+		registered bool
+	}{
+		{"valid", true},
+		{"invalid-subject-type", false},
+		{"invalid-sector", false},
+	}
+	for _, test := range tests {
+		if _, ok := r.Get(ctx, test.clientID); ok != test.registered {
+			t.Errorf("client %s: got registered %v want %v", test.clientID, ok, test.registered)
+		}
+	}
+}
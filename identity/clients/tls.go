@@ -0,0 +1,103 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"bytes"
+	"crypto/x509"
+	"net"
+	"strings"
+)
+
+// MatchTLSClientCertificate returns true if the provided certificate matches
+// the tls_client_auth subject metadata of the associated client registration
+// as specified at https://tools.ietf.org/html/rfc8705#section-2.1.2. The
+// certificate chain must have been validated before.
+func (cr *ClientRegistration) MatchTLSClientCertificate(certificate *x509.Certificate) bool {
+	switch {
+	case cr.TLSClientAuthSubjectDN != "":
+		return certificate.Subject.String() == cr.TLSClientAuthSubjectDN
+
+	case cr.TLSClientAuthSANDNS != "":
+		for _, name := range certificate.DNSNames {
+			if strings.EqualFold(name, cr.TLSClientAuthSANDNS) {
+				return true
+			}
+		}
+
+	case cr.TLSClientAuthSANURI != "":
+		for _, uri := range certificate.URIs {
+			if uri.String() == cr.TLSClientAuthSANURI {
+				return true
+			}
+		}
+
+	case cr.TLSClientAuthSANIP != "":
+		ip := net.ParseIP(cr.TLSClientAuthSANIP)
+		if ip == nil {
+			return false
+		}
+		for _, address := range certificate.IPAddresses {
+			if address.Equal(ip) {
+				return true
+			}
+		}
+
+	case cr.TLSClientAuthSANEmail != "":
+		for _, email := range certificate.EmailAddresses {
+			if email == cr.TLSClientAuthSANEmail {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// MatchSelfSignedTLSClientCertificate returns true if the public key of the
+// provided certificate is one of the keys registered with the associated
+// client registration as specified at https://tools.ietf.org/html/rfc8705#section-2.2.
+func (cr *ClientRegistration) MatchSelfSignedTLSClientCertificate(certificate *x509.Certificate) bool {
+	if cr.JWKS == nil {
+		return false
+	}
+
+	certificateKey, err := x509.MarshalPKIXPublicKey(certificate.PublicKey)
+	if err != nil {
+		return false
+	}
+
+	for _, k := range cr.JWKS.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.DecodePublicKey()
+		if err != nil {
+			continue
+		}
+		registeredKey, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(certificateKey, registeredKey) {
+			return true
+		}
+	}
+
+	return false
+}
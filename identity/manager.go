@@ -46,3 +46,10 @@ type Manager interface {
 	OnSetLogon(func(ctx context.Context, rw http.ResponseWriter, user User) error) error
 	OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter) error) error
 }
+
+// ManagerWithLogonSessions is a Manager which supports the revocation of
+// the logon sessions of its users.
+type ManagerWithLogonSessions interface {
+	Manager
+	OnRevokeLogonSession(func(ctx context.Context, logonSessionID string) error) error
+}
@@ -31,13 +31,17 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"stash.kopano.io/kgol/oidc-go"
-	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identifier"
 	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
 	"stash.kopano.io/kc/konnect/managers"
+	"stash.kopano.io/kc/konnect/oidc/consent"
 	"stash.kopano.io/kc/konnect/oidc/payload"
 	"stash.kopano.io/kc/konnect/version"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 )
 
 const cookieIdentityManagerName = "cookie"
@@ -56,6 +60,9 @@ type CookieIdentityManager struct {
 	client *http.Client
 
 	encryptionManager *EncryptionManager
+	consents          consent.Manager
+	clients           *clients.Registry
+	identifier        *identifier.Identifier
 }
 
 // NewCookieIdentityManager creates a new CookieIdentityManager from the
@@ -100,10 +107,21 @@ func NewCookieIdentityManager(c *identity.Config, backendURI *url.URL, cookieNam
 // RegisterManagers registers the provided managers,
 func (im *CookieIdentityManager) RegisterManagers(mgrs *managers.Managers) error {
 	im.encryptionManager = mgrs.Must("encryption").(*EncryptionManager)
+	im.consents = mgrs.Must("consent").(consent.Manager)
+	im.clients = mgrs.Must("clients").(*clients.Registry)
 
+	if im.identifier != nil {
+		return im.identifier.RegisterManagers(mgrs)
+	}
 	return nil
 }
 
+// SetIdentifier sets the provided identifier to provide the consent flow for
+// users of the accociated CookieIdentityManager.
+func (im *CookieIdentityManager) SetIdentifier(i *identifier.Identifier) {
+	im.identifier = i
+}
+
 type cookieUser struct {
 	raw   string
 	name  string
@@ -279,6 +297,14 @@ func (im *CookieIdentityManager) Authenticate(ctx context.Context, rw http.Respo
 		if err != nil {
 			return nil, err
 		}
+
+		// Cookie logons never satisfy an essential acr beyond the cookie re-use.
+		if satisfied, essential := identity.SatisfiesRequestedACR(ar, []string{konnectoidc.AMRValueCookie}); !satisfied && essential {
+			if ar.Prompts[oidc.PromptNone] == true {
+				return nil, ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "CookieIdentityManager: acr not satisfied")
+			}
+			err = ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "CookieIdentityManager: acr step-up required")
+		}
 	}
 
 	if err != nil {
@@ -288,6 +314,7 @@ func (im *CookieIdentityManager) Authenticate(ctx context.Context, rw http.Respo
 
 	auth := identity.NewAuthRecord(im, user.Subject(), nil, nil, nil)
 	auth.SetUser(user)
+	auth.SetAuthenticationMethods([]string{konnectoidc.AMRValueCookie})
 
 	return auth, nil
 }
@@ -305,17 +332,36 @@ func (im *CookieIdentityManager) Authorize(ctx context.Context, rw http.Response
 		// Let all other prompt values pass.
 	}
 
-	// Fastpath for known clients.
-	switch ar.ClientID {
-	default:
-		// TODO(longsleep): Implement previous consent checks via backend.
+	clientDetails, err := im.clients.Lookup(ctx, ar.ClientID, "", ar.RedirectURI, "", true)
+	if err != nil {
+		return nil, ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, err.Error())
+	}
+
+	// If not trusted, always force consent.
+	if clientDetails.Trusted {
 		approvedScopes = ar.Scopes
+	} else {
+		promptConsent = true
+	}
+
+	// Check given consent.
+	consented := false
+	if im.identifier != nil {
+		consentedScopes, consentErr := getConsentFromIdentifier(ctx, rw, req, ar, im.identifier)
+		if consentErr != nil {
+			return auth, consentErr
+		}
+		if consentedScopes != nil {
+			promptConsent = false
+			consented = true
+			approvedScopes = consentedScopes
+		}
 	}
 
 	// Offline access validation.
 	// http://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess
 	if ok, _ := ar.Scopes[oidc.ScopeOfflineAccess]; ok {
-		if !promptConsent {
+		if !promptConsent && !consented {
 			// Ensure that the prompt parameter contains consent unless
 			// other conditions for processing the request permitting offline
 			// access to the requested resources are in place; unless one or
@@ -328,15 +374,18 @@ func (im *CookieIdentityManager) Authorize(ctx context.Context, rw http.Response
 			im.logger.Warnf("CookieIdentityManager: offline_access requested but not supported, removed offline_access scope")
 			delete(ar.Scopes, oidc.ScopeOfflineAccess)
 		}
+		delete(approvedScopes, oidc.ScopeOfflineAccess)
 	}
 
 	if promptConsent {
 		if ar.Prompts[oidc.PromptNone] == true {
 			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required")
 		}
+		if im.identifier == nil {
+			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required, but no consent page available")
+		}
 
-		// TODO(longsleep): Implement permissions page / consent prompt.
-		return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required")
+		return nil, requestConsentFromIdentifier(ctx, rw, req, ar, auth, im.identifier)
 	}
 
 	auth.AuthorizeScopes(approvedScopes)
@@ -352,10 +401,7 @@ func (im *CookieIdentityManager) EndSession(ctx context.Context, rw http.Respons
 
 // ApproveScopes implements the Backend interface.
 func (im *CookieIdentityManager) ApproveScopes(ctx context.Context, sub string, audience string, approvedScopes map[string]bool) (string, error) {
-	ref := rndm.GenerateRandomString(32)
-
-	// TODO(longsleep): Store generated ref with provided data.
-	return ref, nil
+	return im.consents.Approve(ctx, sub, audience, approvedScopes)
 }
 
 // ApprovedScopes implements the Backend interface.
@@ -364,7 +410,7 @@ func (im *CookieIdentityManager) ApprovedScopes(ctx context.Context, sub string,
 		return nil, fmt.Errorf("SimplePasswdBackend: invalid ref")
 	}
 
-	return nil, nil
+	return getApprovedScopes(ctx, im.consents, sub, audience, ref)
 }
 
 // Fetch implements the identity.Manager interface.
@@ -462,6 +508,9 @@ func (im *CookieIdentityManager) ClaimsSupported(claims []string) []string {
 
 // AddRoutes implements the identity.Manager interface.
 func (im *CookieIdentityManager) AddRoutes(ctx context.Context, router *mux.Router) {
+	if im.identifier != nil {
+		im.identifier.AddRoutes(ctx, router)
+	}
 }
 
 // OnSetLogon implements the identity.Manager interface.
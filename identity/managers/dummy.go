@@ -26,11 +26,13 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"stash.kopano.io/kgol/oidc-go"
-	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identifier"
 	"stash.kopano.io/kc/konnect/identity"
-
+	"stash.kopano.io/kc/konnect/identity/clients"
+	"stash.kopano.io/kc/konnect/managers"
+	"stash.kopano.io/kc/konnect/oidc/consent"
 	"stash.kopano.io/kc/konnect/oidc/payload"
 )
 
@@ -42,6 +44,10 @@ type DummyIdentityManager struct {
 	sub string
 
 	scopesSupported []string
+
+	consents   consent.Manager
+	clients    *clients.Registry
+	identifier *identifier.Identifier
 }
 
 // NewDummyIdentityManager creates a new DummyIdentityManager from the
@@ -59,6 +65,23 @@ func NewDummyIdentityManager(c *identity.Config, sub string) *DummyIdentityManag
 	return im
 }
 
+// RegisterManagers registers the provided managers,
+func (im *DummyIdentityManager) RegisterManagers(mgrs *managers.Managers) error {
+	im.consents = mgrs.Must("consent").(consent.Manager)
+	im.clients = mgrs.Must("clients").(*clients.Registry)
+
+	if im.identifier != nil {
+		return im.identifier.RegisterManagers(mgrs)
+	}
+	return nil
+}
+
+// SetIdentifier sets the provided identifier to provide the consent flow for
+// users of the accociated DummyIdentityManager.
+func (im *DummyIdentityManager) SetIdentifier(i *identifier.Identifier) {
+	im.identifier = i
+}
+
 type dummyUser struct {
 	raw string
 }
@@ -120,14 +143,36 @@ func (im *DummyIdentityManager) Authorize(ctx context.Context, rw http.ResponseW
 		// Let all other prompt values pass.
 	}
 
-	// TODO(longsleep): Move the code below to general function.
-	// TODO(longsleep): Validate scopes and force prompt.
-	approvedScopes = ar.Scopes
+	clientDetails, err := im.clients.Lookup(ctx, ar.ClientID, "", ar.RedirectURI, "", true)
+	if err != nil {
+		return nil, ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, err.Error())
+	}
+
+	// If not trusted, always force consent.
+	if clientDetails.Trusted {
+		approvedScopes = ar.Scopes
+	} else {
+		promptConsent = true
+	}
+
+	// Check given consent.
+	consented := false
+	if im.identifier != nil {
+		consentedScopes, consentErr := getConsentFromIdentifier(ctx, rw, req, ar, im.identifier)
+		if consentErr != nil {
+			return auth, consentErr
+		}
+		if consentedScopes != nil {
+			promptConsent = false
+			consented = true
+			approvedScopes = consentedScopes
+		}
+	}
 
 	// Offline access validation.
 	// http://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess
 	if ok, _ := ar.Scopes[oidc.ScopeOfflineAccess]; ok {
-		if !promptConsent {
+		if !promptConsent && !consented {
 			// Ensure that the prompt parameter contains consent unless
 			// other conditions for processing the request permitting offline
 			// access to the requested resources are in place; unless one or
@@ -141,9 +186,11 @@ func (im *DummyIdentityManager) Authorize(ctx context.Context, rw http.ResponseW
 		if ar.Prompts[oidc.PromptNone] == true {
 			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required")
 		}
+		if im.identifier == nil {
+			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required, but no consent page available")
+		}
 
-		// TODO(longsleep): Implement consent page.
-		return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required, but page not implemented")
+		return nil, requestConsentFromIdentifier(ctx, rw, req, ar, auth, im.identifier)
 	}
 
 	auth.AuthorizeScopes(approvedScopes)
@@ -165,10 +212,7 @@ func (im *DummyIdentityManager) EndSession(ctx context.Context, rw http.Response
 
 // ApproveScopes implements the Backend interface.
 func (im *DummyIdentityManager) ApproveScopes(ctx context.Context, sub string, audience string, approvedScopes map[string]bool) (string, error) {
-	ref := rndm.GenerateRandomString(32)
-
-	// TODO(longsleep): Store generated ref with provided data.
-	return ref, nil
+	return im.consents.Approve(ctx, sub, audience, approvedScopes)
 }
 
 // ApprovedScopes implements the Backend interface.
@@ -177,7 +221,7 @@ func (im *DummyIdentityManager) ApprovedScopes(ctx context.Context, sub string,
 		return nil, fmt.Errorf("SimplePasswdBackend: invalid ref")
 	}
 
-	return nil, nil
+	return getApprovedScopes(ctx, im.consents, sub, audience, ref)
 }
 
 // Fetch implements the identity.Manager interface.
@@ -215,6 +259,9 @@ func (im *DummyIdentityManager) ClaimsSupported(claims []string) []string {
 
 // AddRoutes implements the identity.Manager interface.
 func (im *DummyIdentityManager) AddRoutes(ctx context.Context, router *mux.Router) {
+	if im.identifier != nil {
+		im.identifier.AddRoutes(ctx, router)
+	}
 }
 
 // OnSetLogon implements the identity.Manager interface.
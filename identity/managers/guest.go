@@ -26,12 +26,13 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"stash.kopano.io/kgol/oidc-go"
-	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identifier"
 	"stash.kopano.io/kc/konnect/identity"
 	"stash.kopano.io/kc/konnect/identity/clients"
 	"stash.kopano.io/kc/konnect/managers"
+	"stash.kopano.io/kc/konnect/oidc/consent"
 	"stash.kopano.io/kc/konnect/oidc/payload"
 	"stash.kopano.io/kc/konnect/utils"
 )
@@ -43,8 +44,10 @@ type GuestIdentityManager struct {
 	scopesSupported []string
 	claimsSupported []string
 
-	logger  logrus.FieldLogger
-	clients *clients.Registry
+	logger     logrus.FieldLogger
+	clients    *clients.Registry
+	consents   consent.Manager
+	identifier *identifier.Identifier
 
 	onSetLogonCallbacks   []func(ctx context.Context, rw http.ResponseWriter, user identity.User) error
 	onUnsetLogonCallbacks []func(ctx context.Context, rw http.ResponseWriter) error
@@ -188,6 +191,17 @@ func (u *guestUser) Claims() jwt.MapClaims {
 // RegisterManagers registers the provided managers,
 func (im *GuestIdentityManager) RegisterManagers(mgrs *managers.Managers) error {
 	im.clients = mgrs.Must("clients").(*clients.Registry)
+	im.consents = mgrs.Must("consent").(consent.Manager)
+
+	// Use the consent flow of the identifier of the main identity manager.
+	switch identityManager := mgrs.Must("identity").(type) {
+	case *IdentifierIdentityManager:
+		im.identifier = identityManager.identifier
+	case *CookieIdentityManager:
+		im.identifier = identityManager.identifier
+	case *DummyIdentityManager:
+		im.identifier = identityManager.identifier
+	}
 
 	return nil
 }
@@ -266,6 +280,11 @@ func (im *GuestIdentityManager) Authenticate(ctx context.Context, rw http.Respon
 		return nil, err
 	}
 
+	// Guest logons can never be stepped up.
+	if satisfied, essential := identity.SatisfiesRequestedACR(ar, nil); !satisfied && essential {
+		return nil, ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "GuestIdentityManager: acr not satisfied")
+	}
+
 	auth := identity.NewAuthRecord(im, user.Subject(), nil, nil, nil)
 	auth.SetUser(user)
 
@@ -285,10 +304,23 @@ func (im *GuestIdentityManager) Authorize(ctx context.Context, rw http.ResponseW
 		// Let all other prompt values pass.
 	}
 
+	// Check given consent.
+	var consentedScopes map[string]bool
+	if im.identifier != nil {
+		var err error
+		consentedScopes, err = getConsentFromIdentifier(ctx, rw, req, ar, im.identifier)
+		if err != nil {
+			return auth, err
+		}
+		if consentedScopes != nil {
+			promptConsent = false
+		}
+	}
+
 	// Offline access validation.
 	// http://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess
 	if ok, _ := ar.Scopes[oidc.ScopeOfflineAccess]; ok {
-		if !promptConsent {
+		if !promptConsent && consentedScopes == nil {
 			// Ensure that the prompt parameter contains consent unless
 			// other conditions for processing the request permitting offline
 			// access to the requested resources are in place; unless one or
@@ -314,17 +346,6 @@ func (im *GuestIdentityManager) Authorize(ctx context.Context, rw http.ResponseW
 		return nil, ar.NewBadRequest(oidc.ErrorCodeOIDCInvalidRequestObject, "GuestIdentityManager: authorize without secure client")
 	}
 
-	// TODO(longsleep): Validate scopes and force prompt.
-
-	if promptConsent {
-		if ar.Prompts[oidc.PromptNone] == true {
-			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required")
-		}
-
-		// TODO(longsleep): Implement consent page.
-		return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required, but not supported for guests")
-	}
-
 	origin := ""
 	if false {
 		// TODO(longsleep): find a condition when this can be enabled.
@@ -340,6 +361,22 @@ func (im *GuestIdentityManager) Authorize(ctx context.Context, rw http.ResponseW
 		return nil, ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, "client mismatch")
 	}
 
+	// If not trusted, always force consent.
+	if !clientDetails.Trusted && consentedScopes == nil {
+		promptConsent = true
+	}
+
+	if promptConsent {
+		if ar.Prompts[oidc.PromptNone] == true {
+			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required")
+		}
+		if im.identifier == nil {
+			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required, but no consent page available")
+		}
+
+		return nil, requestConsentFromIdentifier(ctx, rw, req, ar, auth, im.identifier)
+	}
+
 	// If not trusted we need to check request scopes.
 	if clientDetails.Trusted && securedDetails.TrustedScopes == nil {
 		// NOTE(longsleep):  Guest scope validation takes all client provided
@@ -378,6 +415,15 @@ func (im *GuestIdentityManager) Authorize(ctx context.Context, rw http.ResponseW
 		}
 	}
 
+	// Limit to the scopes which the guest approved in the consent flow.
+	if consentedScopes != nil {
+		for scope := range approvedScopes {
+			if !consentedScopes[scope] {
+				delete(approvedScopes, scope)
+			}
+		}
+	}
+
 	auth.AuthorizeScopes(approvedScopes)
 	auth.AuthorizeClaims(ar.Claims)
 	return auth, nil
@@ -400,10 +446,7 @@ func (im *GuestIdentityManager) EndSession(ctx context.Context, rw http.Response
 
 // ApproveScopes implements the Backend interface.
 func (im *GuestIdentityManager) ApproveScopes(ctx context.Context, sub string, audience string, approvedScopes map[string]bool) (string, error) {
-	ref := rndm.GenerateRandomString(32)
-
-	// TODO(longsleep): Store generated ref with provided data.
-	return ref, nil
+	return im.consents.Approve(ctx, sub, audience, approvedScopes)
 }
 
 // ApprovedScopes implements the Backend interface.
@@ -412,7 +455,7 @@ func (im *GuestIdentityManager) ApprovedScopes(ctx context.Context, sub string,
 		return nil, fmt.Errorf("GuestIdentityManager: invalid ref")
 	}
 
-	return nil, nil
+	return getApprovedScopes(ctx, im.consents, sub, audience, ref)
 }
 
 // Fetch implements the identity.Manager interface.
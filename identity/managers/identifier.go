@@ -27,13 +27,13 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"stash.kopano.io/kgol/oidc-go"
-	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect/identifier"
 	"stash.kopano.io/kc/konnect/identity"
 	"stash.kopano.io/kc/konnect/identity/clients"
 	"stash.kopano.io/kc/konnect/managers"
 	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/consent"
 	"stash.kopano.io/kc/konnect/oidc/payload"
 	"stash.kopano.io/kc/konnect/utils"
 )
@@ -49,6 +49,7 @@ type IdentifierIdentityManager struct {
 
 	identifier *identifier.Identifier
 	clients    *clients.Registry
+	consents   consent.Manager
 	logger     logrus.FieldLogger
 }
 
@@ -97,6 +98,7 @@ func NewIdentifierIdentityManager(c *identity.Config, i *identifier.Identifier)
 // RegisterManagers registers the provided managers,
 func (im *IdentifierIdentityManager) RegisterManagers(mgrs *managers.Managers) error {
 	im.clients = mgrs.Must("clients").(*clients.Registry)
+	im.consents = mgrs.Must("consent").(consent.Manager)
 
 	return im.identifier.RegisterManagers(mgrs)
 }
@@ -162,6 +164,7 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 	}
 
 	// More checks.
+	stepUp := false
 	if err == nil {
 		var sub string
 		if user != nil {
@@ -171,6 +174,19 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 		if err != nil {
 			return nil, err
 		}
+
+		// Enforce re-authentication when the authentication context class of
+		// the current logon does not satisfy the requested acr.
+		if satisfied, essential := identity.SatisfiesRequestedACR(ar, user.AuthenticationMethods()); !satisfied {
+			if ar.Prompts[oidc.PromptNone] == true {
+				if essential {
+					return nil, ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "IdentifierIdentityManager: acr not satisfied")
+				}
+			} else {
+				stepUp = true
+				err = ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "IdentifierIdentityManager: acr step-up required")
+			}
+		}
 	}
 
 	if err != nil {
@@ -180,6 +196,10 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 			return nil, err
 		}
 		query.Set("flow", identifier.FlowOIDC)
+		if stepUp {
+			// Force sign-in form, ignoring the current logon.
+			query.Set("prompt", strings.TrimSpace(ar.RawPrompt+" "+oidc.PromptLogin))
+		}
 		if ar.Claims != nil {
 			// Add derived scope list from claims request.
 			claimsScopes := ar.Claims.Scopes(ar.Scopes)
@@ -199,6 +219,7 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 	if loggedOn, logonAt := u.LoggedOn(); loggedOn {
 		auth.SetAuthTime(logonAt)
 	}
+	auth.SetAuthenticationMethods(u.AuthenticationMethods())
 
 	return auth, nil
 }
@@ -262,24 +283,7 @@ func (im *IdentifierIdentityManager) Authorize(ctx context.Context, rw http.Resp
 			return auth, ar.NewError(oidc.ErrorCodeOIDCInteractionRequired, "consent required")
 		}
 
-		// Build consent URL.
-		query, err := url.ParseQuery(req.URL.RawQuery)
-		if err != nil {
-			return nil, err
-		}
-		query.Set("flow", identifier.FlowConsent)
-		if ar.Claims != nil {
-			// Add derived scope list from claims request.
-			claimsScopes := ar.Claims.Scopes(ar.Scopes)
-			if len(claimsScopes) > 0 {
-				query.Set("claims_scope", strings.Join(claimsScopes, " "))
-			}
-		}
-		u, _ := url.Parse(im.signInFormURI)
-		u.RawQuery = query.Encode()
-		utils.WriteRedirect(rw, http.StatusFound, u, nil, false)
-
-		return nil, &identity.IsHandledError{}
+		return nil, writeConsentRedirect(rw, req, ar, im.signInFormURI)
 	}
 
 	// Offline access validation.
@@ -388,10 +392,7 @@ func (im *IdentifierIdentityManager) EndSession(ctx context.Context, rw http.Res
 
 // ApproveScopes implements the Backend interface.
 func (im *IdentifierIdentityManager) ApproveScopes(ctx context.Context, sub string, audience string, approvedScopes map[string]bool) (string, error) {
-	ref := rndm.GenerateRandomString(32)
-
-	// TODO(longsleep): Store generated ref with provided data.
-	return ref, nil
+	return im.consents.Approve(ctx, sub, audience, approvedScopes)
 }
 
 // ApprovedScopes implements the Backend interface.
@@ -400,7 +401,7 @@ func (im *IdentifierIdentityManager) ApprovedScopes(ctx context.Context, sub str
 		return nil, fmt.Errorf("IdentifierIdentityManager: invalid ref")
 	}
 
-	return nil, nil
+	return getApprovedScopes(ctx, im.consents, sub, audience, ref)
 }
 
 // Fetch implements the identity.Manager interface.
@@ -454,3 +455,9 @@ func (im *IdentifierIdentityManager) OnSetLogon(cb func(ctx context.Context, rw
 func (im *IdentifierIdentityManager) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter) error) error {
 	return im.identifier.OnUnsetLogon(cb)
 }
+
+// OnRevokeLogonSession implements the identity.ManagerWithLogonSessions
+// interface.
+func (im *IdentifierIdentityManager) OnRevokeLogonSession(cb func(ctx context.Context, logonSessionID string) error) error {
+	return im.identifier.OnRevokeLogonSession(cb)
+}
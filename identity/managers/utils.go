@@ -18,11 +18,21 @@
 package managers
 
 import (
+	"context"
 	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"golang.org/x/crypto/blake2b"
+	"stash.kopano.io/kgol/oidc-go"
 
+	"stash.kopano.io/kc/konnect/identifier"
+	"stash.kopano.io/kc/konnect/identity"
 	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/consent"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+	"stash.kopano.io/kc/konnect/utils"
 )
 
 func setupSupportedScopes(scopes []string, extra []string, override []string) []string {
@@ -49,3 +59,79 @@ func getPublicSubject(sub []byte, extra []byte) (string, error) {
 	s := base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
 	return s + "@konnect", nil
 }
+
+// getApprovedScopes looks up the scopes of the consent identified by the
+// provided ref in the provided consent manager. If no consent is recorded, nil
+// is returned without error, leaving it to the caller to use the approvals of
+// the token which carried the ref.
+func getApprovedScopes(ctx context.Context, consents consent.Manager, sub string, audience string, ref string) (map[string]bool, error) {
+	record, found := consents.Get(ctx, sub, audience)
+	if !found {
+		return nil, nil
+	}
+	if record.Ref != ref {
+		return nil, konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "consent revoked")
+	}
+
+	return record.Scopes(), nil
+}
+
+// writeConsentRedirect redirects to the consent flow of the identifier web app
+// at the provided form URI, passing along the parameters of the provided
+// authentication request. It returns an identity.IsHandledError on success.
+func writeConsentRedirect(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest, formURI string) error {
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return err
+	}
+	query.Set("flow", identifier.FlowConsent)
+	if ar.Claims != nil {
+		// Add derived scope list from claims request.
+		claimsScopes := ar.Claims.Scopes(ar.Scopes)
+		if len(claimsScopes) > 0 {
+			query.Set("claims_scope", strings.Join(claimsScopes, " "))
+		}
+	}
+	u, _ := url.Parse(formURI)
+	u.RawQuery = query.Encode()
+	utils.WriteRedirect(rw, http.StatusFound, u, nil, false)
+
+	return &identity.IsHandledError{}
+}
+
+// getConsentFromIdentifier returns the scopes which were approved for the
+// provided authentication request in the consent flow of the provided
+// identifier. It returns nil if no consent was given.
+func getConsentFromIdentifier(ctx context.Context, rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest, i *identifier.Identifier) (map[string]bool, error) {
+	consent, err := i.GetConsentFromConsentCookie(ctx, rw, req)
+	if err != nil || consent == nil {
+		return nil, err
+	}
+	if !consent.Allow {
+		return nil, ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, "consent denied")
+	}
+
+	filteredApprovedScopes, allApprovedScopes := consent.Scopes(ar.Scopes)
+
+	// Filter claims request by approved scopes.
+	if ar.Claims != nil {
+		err = ar.Claims.ApplyScopes(allApprovedScopes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return filteredApprovedScopes, nil
+}
+
+// requestConsentFromIdentifier sends the user of the provided auth record to
+// the consent flow of the provided identifier. It returns an
+// identity.IsHandledError on success.
+func requestConsentFromIdentifier(ctx context.Context, rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest, auth identity.AuthRecord, i *identifier.Identifier) error {
+	err := i.SetUserToConsentUserCookie(ctx, rw, auth.User())
+	if err != nil {
+		return err
+	}
+
+	return writeConsentRedirect(rw, req, ar, i.ConsentFormURI().String())
+}
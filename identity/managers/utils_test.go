@@ -0,0 +1,383 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/config"
+	"stash.kopano.io/kc/konnect/identifier"
+	identifierBackends "stash.kopano.io/kc/konnect/identifier/backends"
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/authorities"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	"stash.kopano.io/kc/konnect/managers"
+	consentManagers "stash.kopano.io/kc/konnect/oidc/consent/managers"
+	deviceManagers "stash.kopano.io/kc/konnect/oidc/device/managers"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+	revocationManagers "stash.kopano.io/kc/konnect/oidc/revocation/managers"
+)
+
+var logger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.TextFormatter{DisableColors: true},
+	Level:     logrus.DebugLevel,
+}
+
+const (
+	testRedirectURI = "https://client.example.com/cb"
+)
+
+type testConsentUser struct {
+	sub string
+}
+
+func (u *testConsentUser) Subject() string {
+	return u.sub
+}
+
+func (u *testConsentUser) Raw() string {
+	return u.sub
+}
+
+func (u *testConsentUser) Username() string {
+	return u.sub + "-username"
+}
+
+// newTestConsentIdentifier creates an identifier without logon backend, as
+// used to provide the consent flow for identity managers which do not bring
+// their own identifier.
+func newTestConsentIdentifier(t *testing.T) *identifier.Identifier {
+	staticFolder, err := ioutil.TempDir("", "konnect-managers-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The index.html is read on creation, so the folder is not needed after.
+	defer os.RemoveAll(staticFolder)
+	err = ioutil.WriteFile(filepath.Join(staticFolder, "index.html"), []byte("<html></html>"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseURI, _ := url.Parse("https://konnect.example.com")
+	i, err := identifier.NewIdentifier(&identifier.Config{
+		Config: &config.Config{
+			Logger: logger,
+		},
+
+		BaseURI:         baseURI,
+		PathPrefix:      "/signin/v1",
+		StaticFolder:    staticFolder,
+		LogonCookieName: "__Secure-KKT",
+
+		Backend: identifierBackends.NewNoneIdentifierBackend(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = i.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return i
+}
+
+// newTestConsentManagers registers the managers needed for the consent flow
+// with the provided identity managers, the first being the main identity
+// manager.
+func newTestConsentManagers(ctx context.Context, t *testing.T, identityManagers ...identity.Manager) {
+	clientRegistry, _ := clients.NewRegistry(ctx, nil, "", logger)
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:           "trusted",
+			Trusted:      true,
+			RedirectURIs: []string{testRedirectURI},
+		},
+		{
+			ID:           "untrusted",
+			RedirectURIs: []string{testRedirectURI},
+		},
+	} {
+		if err := clientRegistry.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authorityRegistry, _ := authorities.NewRegistry(ctx, "", logger)
+
+	mgrs := managers.New()
+	mgrs.Set("clients", clientRegistry)
+	mgrs.Set("authorities", authorityRegistry)
+	mgrs.Set("consent", consentManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("device", deviceManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("revocation", revocationManagers.NewMemoryMapManager(ctx))
+	encryptionManager, _ := NewEncryptionManager(nil)
+	mgrs.Set("encryption", encryptionManager)
+	mgrs.Set("identity", identityManagers[0])
+	for idx, im := range identityManagers[1:] {
+		mgrs.Set(fmt.Sprintf("identity-%d", idx), im)
+	}
+
+	if err := mgrs.Apply(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestAuthenticationRequest(clientID string, scopes ...string) (*http.Request, *payload.AuthenticationRequest) {
+	redirectURI, _ := url.Parse(testRedirectURI)
+	ar := &payload.AuthenticationRequest{
+		ClientID:       clientID,
+		RawRedirectURI: testRedirectURI,
+		RedirectURI:    redirectURI,
+		State:          "test-state",
+		Nonce:          "test-nonce",
+		Scopes:         make(map[string]bool),
+		Prompts:        make(map[string]bool),
+	}
+	for _, scope := range scopes {
+		ar.Scopes[scope] = true
+	}
+
+	query := url.Values{
+		"client_id":    {clientID},
+		"redirect_uri": {testRedirectURI},
+		"state":        {ar.State},
+		"nonce":        {ar.Nonce},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/konnect/v1/authorize?"+query.Encode(), nil)
+	req.ParseForm()
+
+	return req, ar
+}
+
+// withTestConsent adds the consent of the consent flow of the provided
+// identifier to the provided request.
+func withTestConsent(t *testing.T, i *identifier.Identifier, req *http.Request, ar *payload.AuthenticationRequest, allow bool, rawScope string) *http.Request {
+	query := req.URL.Query()
+	query.Set("konnect", "consent-state")
+	req = httptest.NewRequest(http.MethodGet, req.URL.Path+"?"+query.Encode(), nil)
+	req.ParseForm()
+
+	rr := httptest.NewRecorder()
+	err := i.SetConsentToConsentCookie(context.Background(), rr, &identifier.ConsentRequest{
+		State:          "consent-state",
+		ClientID:       ar.ClientID,
+		RawRedirectURI: ar.RawRedirectURI,
+		Ref:            ar.State,
+		Nonce:          ar.Nonce,
+	}, &identifier.Consent{
+		Allow:    allow,
+		RawScope: rawScope,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	return req
+}
+
+type testAuthorizeFunc func(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest) (identity.AuthRecord, error)
+
+// testConsentRouting checks that requests of untrusted clients are routed
+// through the consent flow of the provided identifier and that only the
+// consented scopes are authorized.
+func testConsentRouting(t *testing.T, i *identifier.Identifier, clientID string, sub string, authorize testAuthorizeFunc, requested []string, consented string, authorized []string) {
+	// Without consent, the user is sent to the consent flow.
+	req, ar := newTestAuthenticationRequest(clientID, requested...)
+	rr := httptest.NewRecorder()
+	_, err := authorize(rr, req, ar)
+	if _, ok := err.(*identity.IsHandledError); !ok {
+		t.Fatalf("without consent: got error %v want IsHandledError", err)
+	}
+	if rr.Code != http.StatusFound {
+		t.Fatalf("without consent: got status %v want %v", rr.Code, http.StatusFound)
+	}
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	if location.Path != i.ConsentFormURI().Path {
+		t.Errorf("without consent: redirected to %v want %v", location.Path, i.ConsentFormURI().Path)
+	}
+	if flow := location.Query().Get("flow"); flow != identifier.FlowConsent {
+		t.Errorf("without consent: got flow %v want %v", flow, identifier.FlowConsent)
+	}
+	if location.Query().Get("client_id") != clientID {
+		t.Errorf("without consent: request parameters were not passed along: %v", location)
+	}
+
+	// The consent flow knows the signed in user.
+	consentReq := httptest.NewRequest(http.MethodPost, "/signin/v1/identifier/_/hello", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		consentReq.AddCookie(cookie)
+	}
+	consentUser, err := i.GetUserFromConsentUserCookie(context.Background(), consentReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consentUser == nil || consentUser.Subject() != sub {
+		t.Errorf("without consent: got consent user %v want %v", consentUser, sub)
+	}
+
+	// With prompt none, consent is required.
+	req, ar = newTestAuthenticationRequest(clientID, requested...)
+	ar.Prompts[oidc.PromptNone] = true
+	_, err = authorize(httptest.NewRecorder(), req, ar)
+	if authErr, ok := err.(*payload.AuthenticationError); !ok || authErr.ErrorID != oidc.ErrorCodeOIDCInteractionRequired {
+		t.Errorf("prompt none: got error %v want %v", err, oidc.ErrorCodeOIDCInteractionRequired)
+	}
+
+	// Denied consent.
+	req, ar = newTestAuthenticationRequest(clientID, requested...)
+	req = withTestConsent(t, i, req, ar, false, "")
+	_, err = authorize(httptest.NewRecorder(), req, ar)
+	if authErr, ok := err.(*payload.AuthenticationError); !ok || authErr.ErrorID != oidc.ErrorCodeOAuth2AccessDenied {
+		t.Errorf("denied consent: got error %v want %v", err, oidc.ErrorCodeOAuth2AccessDenied)
+	}
+
+	// Given consent authorizes the consented scopes.
+	req, ar = newTestAuthenticationRequest(clientID, requested...)
+	req = withTestConsent(t, i, req, ar, true, consented)
+	auth, err := authorize(httptest.NewRecorder(), req, ar)
+	if err != nil {
+		t.Fatalf("given consent: %v", err)
+	}
+	scopes := auth.AuthorizedScopes()
+	if len(scopes) != len(authorized) {
+		t.Errorf("given consent: got scopes %v want %v", scopes, authorized)
+	}
+	for _, scope := range authorized {
+		if !scopes[scope] {
+			t.Errorf("given consent: got scopes %v want %v", scopes, authorized)
+		}
+	}
+}
+
+func TestDummyIdentityManagerConsent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i := newTestConsentIdentifier(t)
+	im := NewDummyIdentityManager(&identity.Config{Logger: logger}, "unittestuser")
+	im.SetIdentifier(i)
+	newTestConsentManagers(ctx, t, im)
+
+	authorize := func(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest) (identity.AuthRecord, error) {
+		auth, err := im.Authenticate(ctx, rw, req, ar, nil)
+		if err != nil {
+			return nil, err
+		}
+		return im.Authorize(ctx, rw, req, ar, auth)
+	}
+
+	// Trusted clients do not need consent.
+	req, ar := newTestAuthenticationRequest("trusted", oidc.ScopeOpenID, oidc.ScopeProfile)
+	auth, err := authorize(httptest.NewRecorder(), req, ar)
+	if err != nil {
+		t.Fatalf("trusted: %v", err)
+	}
+	if scopes := auth.AuthorizedScopes(); !scopes[oidc.ScopeOpenID] || !scopes[oidc.ScopeProfile] {
+		t.Errorf("trusted: got scopes %v", scopes)
+	}
+
+	testConsentRouting(t, i, "untrusted", (&dummyUser{"unittestuser"}).Subject(), authorize, []string{oidc.ScopeOpenID, oidc.ScopeProfile}, oidc.ScopeOpenID, []string{oidc.ScopeOpenID})
+
+	// Without identifier, there is no consent page.
+	im.SetIdentifier(nil)
+	req, ar = newTestAuthenticationRequest("untrusted", oidc.ScopeOpenID)
+	_, err = authorize(httptest.NewRecorder(), req, ar)
+	if authErr, ok := err.(*payload.AuthenticationError); !ok || authErr.ErrorID != oidc.ErrorCodeOIDCInteractionRequired {
+		t.Errorf("without identifier: got error %v want %v", err, oidc.ErrorCodeOIDCInteractionRequired)
+	}
+}
+
+func TestCookieIdentityManagerConsent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i := newTestConsentIdentifier(t)
+	backendURI, _ := url.Parse("https://backend.example.com/user")
+	signInFormURI, _ := url.Parse("https://konnect.example.com/signin")
+	im := NewCookieIdentityManager(&identity.Config{SignInFormURI: signInFormURI, Logger: logger}, backendURI, []string{"session"}, time.Second, nil)
+	im.SetIdentifier(i)
+	newTestConsentManagers(ctx, t, im)
+
+	authorize := func(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest) (identity.AuthRecord, error) {
+		auth := identity.NewAuthRecord(im, "unittestuser", nil, nil, nil)
+		auth.SetUser(&testConsentUser{sub: "unittestuser"})
+		return im.Authorize(ctx, rw, req, ar, auth)
+	}
+
+	// Trusted clients do not need consent.
+	req, ar := newTestAuthenticationRequest("trusted", oidc.ScopeOpenID, oidc.ScopeProfile)
+	auth, err := authorize(httptest.NewRecorder(), req, ar)
+	if err != nil {
+		t.Fatalf("trusted: %v", err)
+	}
+	if scopes := auth.AuthorizedScopes(); !scopes[oidc.ScopeOpenID] || !scopes[oidc.ScopeProfile] {
+		t.Errorf("trusted: got scopes %v", scopes)
+	}
+
+	testConsentRouting(t, i, "untrusted", "unittestuser", authorize, []string{oidc.ScopeOpenID, oidc.ScopeProfile, oidc.ScopeEmail}, oidc.ScopeOpenID+" "+oidc.ScopeEmail, []string{oidc.ScopeOpenID, oidc.ScopeEmail})
+}
+
+func TestGuestIdentityManagerConsent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i := newTestConsentIdentifier(t)
+	dummy := NewDummyIdentityManager(&identity.Config{Logger: logger}, "unittestuser")
+	dummy.SetIdentifier(i)
+	im := NewGuestIdentityManager(&identity.Config{Logger: logger})
+	newTestConsentManagers(ctx, t, dummy, im)
+
+	authorize := func(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest) (identity.AuthRecord, error) {
+		// Guests are authorized with a signed request object of the client.
+		roc := &payload.RequestObjectClaims{
+			ClientID: ar.ClientID,
+		}
+		err := roc.SetSecure(&clients.Secured{
+			ID:            ar.ClientID,
+			TrustedScopes: []string{konnect.ScopeGuestOK},
+		})
+		if err != nil {
+			return nil, err
+		}
+		ar.Request = &jwt.Token{Claims: roc}
+
+		auth := identity.NewAuthRecord(im, "unittestuser", nil, nil, nil)
+		auth.SetUser(&testConsentUser{sub: "unittestuser"})
+		return im.Authorize(ctx, rw, req, ar, auth)
+	}
+
+	testConsentRouting(t, i, "untrusted", "unittestuser", authorize, []string{oidc.ScopeOpenID, oidc.ScopeProfile, konnect.ScopeGuestOK}, oidc.ScopeOpenID+" "+konnect.ScopeGuestOK, []string{oidc.ScopeOpenID, konnect.ScopeGuestOK})
+}
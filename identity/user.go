@@ -77,6 +77,13 @@ type UserWithSessionRef interface {
 	SessionRef() *string
 }
 
+// UserWithLogonSession is a user which was signed in with a logon session
+// that can be revoked.
+type UserWithLogonSession interface {
+	User
+	LogonSessionID() string
+}
+
 // PublicUser is a user with a public Subject and a raw id.
 type PublicUser interface {
 	Subject() string
@@ -30,6 +30,9 @@ type IDTokenClaims struct {
 	AccessTokenHash string `json:"at_hash,omitempty"`
 	CodeHash        string `json:"c_hash,omitempty"`
 
+	ACR string   `json:"acr,omitempty"`
+	AMR []string `json:"amr,omitempty"`
+
 	*ProfileClaims
 	*EmailClaims
 
@@ -103,3 +106,18 @@ func (c UserInfoClaims) Valid() error {
 type SessionClaims struct {
 	SessionID string `json:"sid,omitempty"`
 }
+
+// LogoutTokenClaims define the claims found in OIDC Logout Tokens as
+// specified by https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+type LogoutTokenClaims struct {
+	jwt.StandardClaims
+
+	Events map[string]struct{} `json:"events"`
+
+	*SessionClaims
+}
+
+// Valid implements the jwt.Claims interface.
+func (c LogoutTokenClaims) Valid() error {
+	return c.StandardClaims.Valid()
+}
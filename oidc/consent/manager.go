@@ -0,0 +1,61 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package consent
+
+import (
+	"context"
+	"time"
+)
+
+// Record is a consent record, holding the scopes which a user approved for a
+// client.
+type Record struct {
+	Sub      string `json:"sub"`
+	ClientID string `json:"client_id"`
+
+	// Ref identifies the consent. It changes when the consent is revoked and
+	// approved again. Revoked consents have an empty Ref.
+	Ref            string   `json:"ref"`
+	ApprovedScopes []string `json:"scopes,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Revoked returns true if the accociated record has been revoked.
+func (r *Record) Revoked() bool {
+	return r.Ref == ""
+}
+
+// Scopes returns the accociated record's approved scopes as mapping.
+func (r *Record) Scopes() map[string]bool {
+	scopes := make(map[string]bool)
+	for _, scope := range r.ApprovedScopes {
+		scopes[scope] = true
+	}
+
+	return scopes
+}
+
+// Manager is a interface defining a consent manager which records the scopes
+// approved by users per client.
+type Manager interface {
+	Approve(ctx context.Context, sub string, clientID string, approvedScopes map[string]bool) (string, error)
+	Get(ctx context.Context, sub string, clientID string) (*Record, bool)
+	List(ctx context.Context, sub string) ([]*Record, error)
+	Revoke(ctx context.Context, sub string, clientID string) error
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kc/konnect/oidc/consent"
+	"stash.kopano.io/kc/konnect/utils"
+)
+
+// fileManager provides a consent manager which keeps its records in memory
+// and persists them to a JSON file on every change, so consents survive
+// restarts. The fileManager's methods are safe to call from multiple Go
+// routines.
+type fileManager struct {
+	*memoryMapManager
+
+	fn     string
+	mutex  sync.Mutex
+	logger logrus.FieldLogger
+}
+
+// NewFileManager creates a new file backed consent Manager using the provided
+// file name. Existing consents are loaded from the file if it exists.
+func NewFileManager(ctx context.Context, fn string, logger logrus.FieldLogger) (consent.Manager, error) {
+	cm := &fileManager{
+		memoryMapManager: newMemoryMapManager(),
+
+		fn:     fn,
+		logger: logger,
+	}
+
+	err := cm.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+func (cm *fileManager) load() error {
+	var records []*consent.Record
+	if _, err := utils.ReadJSONFile(cm.fn, &records); err != nil {
+		return fmt.Errorf("failed to load consent file: %v", err)
+	}
+
+	for _, record := range records {
+		cm.table.Set(cm.makeKey(record.Sub, record.ClientID), record)
+	}
+
+	return nil
+}
+
+// save writes all records of the accociated manager to the accociated file.
+// It must be called with the accociated manager's mutex locked.
+func (cm *fileManager) save() error {
+	records := make([]*consent.Record, 0, cm.table.Count())
+	for entry := range cm.table.IterBuffered() {
+		records = append(records, entry.Val.(*consent.Record))
+	}
+
+	return utils.WriteJSONFile(cm.fn, records)
+}
+
+// restore puts the provided previous record back for the provided sub and
+// client ID in the accociated manager's table, to undo a change which failed
+// to be saved.
+func (cm *fileManager) restore(sub string, clientID string, previous *consent.Record) {
+	if previous == nil {
+		cm.table.Remove(cm.makeKey(sub, clientID))
+	} else {
+		cm.table.Set(cm.makeKey(sub, clientID), previous)
+	}
+}
+
+// Approve records the provided approved scopes in the accociated manager's
+// table and persists the result to the accociated file. Approvals which do not
+// change the stored consent are not written.
+func (cm *fileManager) Approve(ctx context.Context, sub string, clientID string, approvedScopes map[string]bool) (string, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	ref, previous, changed, err := cm.memoryMapManager.approve(sub, clientID, approvedScopes)
+	if err != nil || !changed {
+		return ref, err
+	}
+
+	err = cm.save()
+	if err != nil {
+		cm.restore(sub, clientID, previous)
+		return "", fmt.Errorf("failed to save consent file: %v", err)
+	}
+
+	return ref, nil
+}
+
+// Revoke revokes the consent in the accociated manager's table and persists
+// the result to the accociated file.
+func (cm *fileManager) Revoke(ctx context.Context, sub string, clientID string) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	var previous *consent.Record
+	if stored, found := cm.table.Get(cm.makeKey(sub, clientID)); found {
+		previous = stored.(*consent.Record)
+	}
+	err := cm.memoryMapManager.Revoke(ctx, sub, clientID)
+	if err != nil {
+		return err
+	}
+
+	err = cm.save()
+	if err != nil {
+		cm.restore(sub, clientID, previous)
+		return fmt.Errorf("failed to save consent file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = &logrus.Logger{
+	Out:       ioutil.Discard,
+	Formatter: &logrus.TextFormatter{DisableColors: true},
+}
+
+func TestMemoryMapManagerApprove(t *testing.T) {
+	ctx := context.Background()
+	cm := NewMemoryMapManager(ctx)
+
+	ref1, err := cm.Approve(ctx, "sub1", "client1", map[string]bool{"openid": true, "profile": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref2, err := cm.Approve(ctx, "sub1", "client1", map[string]bool{"openid": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref1 == "" || ref1 != ref2 {
+		t.Errorf("approvals of the same consent must keep the ref, got %v and %v", ref1, ref2)
+	}
+	record, found := cm.Get(ctx, "sub1", "client1")
+	if !found {
+		t.Fatal("consent not found")
+	}
+	if scopes := record.Scopes(); len(scopes) != 1 || !scopes["openid"] {
+		t.Errorf("consent has wrong scopes: %v", record.ApprovedScopes)
+	}
+
+	otherRef, _ := cm.Approve(ctx, "sub2", "client1", map[string]bool{"openid": true})
+	if otherRef == ref1 {
+		t.Error("consents of different subjects must not share the ref")
+	}
+
+	err = cm.Revoke(ctx, "sub1", "client1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ := cm.List(ctx, "sub1")
+	if len(records) != 0 {
+		t.Errorf("revoked consent is listed: %v", records)
+	}
+	ref3, _ := cm.Approve(ctx, "sub1", "client1", map[string]bool{"openid": true})
+	if ref3 == "" || ref3 == ref1 {
+		t.Errorf("approval after revocation must create a new ref, got %v", ref3)
+	}
+
+	_, err = cm.Approve(ctx, "", "client1", nil)
+	if err == nil {
+		t.Error("approval without sub must fail")
+	}
+}
+
+func TestFileManagerPersists(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "konnect-consent-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "consents.json")
+
+	cm, err := NewFileManager(ctx, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := cm.Approve(ctx, "sub1", "client1", map[string]bool{"openid": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Approving the same scopes again must not rewrite the file.
+	err = os.Chtimes(fn, info.ModTime().Add(-time.Hour), info.ModTime().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(fn)
+	if _, err = cm.Approve(ctx, "sub1", "client1", map[string]bool{"openid": true}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(fn)
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("unchanged approval rewrote the consent file")
+	}
+
+	reloaded, err := NewFileManager(ctx, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, found := reloaded.Get(ctx, "sub1", "client1")
+	if !found || record.Ref != ref {
+		t.Fatalf("consent not restored from file: %v", record)
+	}
+}
+
+func TestFileManagerRestoresOnSaveError(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "konnect-consent-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cm, err := NewFileManager(ctx, filepath.Join(dir, "missing", "consents.json"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cm.Approve(ctx, "sub1", "client1", map[string]bool{"openid": true})
+	if err == nil {
+		t.Fatal("approval must fail when the file cannot be written")
+	}
+	if record, found := cm.Get(ctx, "sub1", "client1"); found {
+		t.Errorf("failed approval left a record behind: %v", record)
+	}
+}
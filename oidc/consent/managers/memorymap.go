@@ -0,0 +1,164 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+	"stash.kopano.io/kgol/rndm"
+
+	"stash.kopano.io/kc/konnect/oidc/consent"
+)
+
+// memoryMapManager provides a consent manager which keeps its records in
+// memory. The memoryMapManager's methods are safe to call from multiple Go
+// routines.
+type memoryMapManager struct {
+	table cmap.ConcurrentMap
+}
+
+// NewMemoryMapManager creates a new in-memory consent Manager.
+func NewMemoryMapManager(ctx context.Context) consent.Manager {
+	return newMemoryMapManager()
+}
+
+func newMemoryMapManager() *memoryMapManager {
+	return &memoryMapManager{
+		table: cmap.New(),
+	}
+}
+
+func (cm *memoryMapManager) makeKey(sub string, clientID string) string {
+	return sub + " " + clientID
+}
+
+// Approve records the provided approved scopes for the provided sub and
+// client ID in the accociated manager's table and returns the ref of the
+// consent. Existing consents keep their ref.
+func (cm *memoryMapManager) Approve(ctx context.Context, sub string, clientID string, approvedScopes map[string]bool) (string, error) {
+	ref, _, _, err := cm.approve(sub, clientID, approvedScopes)
+	return ref, err
+}
+
+// approve implements Approve, additionally returning the previous record if
+// any and whether the stored record was changed. Consents which already have
+// the provided scopes are left untouched.
+func (cm *memoryMapManager) approve(sub string, clientID string, approvedScopes map[string]bool) (string, *consent.Record, bool, error) {
+	if sub == "" || clientID == "" {
+		return "", nil, false, errors.New("invalid consent")
+	}
+
+	approvedScopesList := make([]string, 0)
+	for scope, granted := range approvedScopes {
+		if granted {
+			approvedScopesList = append(approvedScopesList, scope)
+		}
+	}
+	sort.Strings(approvedScopesList)
+
+	record := &consent.Record{
+		Sub:            sub,
+		ClientID:       clientID,
+		ApprovedScopes: approvedScopesList,
+		UpdatedAt:      time.Now(),
+	}
+	var previous *consent.Record
+	changed := true
+	stored := cm.table.Upsert(cm.makeKey(sub, clientID), record, func(exists bool, valueInMap interface{}, newValue interface{}) interface{} {
+		newRecord := newValue.(*consent.Record)
+		if !exists {
+			newRecord.Ref = rndm.GenerateRandomString(32)
+			return newRecord
+		}
+
+		previous = valueInMap.(*consent.Record)
+		if previous.Revoked() {
+			newRecord.Ref = rndm.GenerateRandomString(32)
+			return newRecord
+		}
+		if equalScopes(previous.ApprovedScopes, newRecord.ApprovedScopes) {
+			changed = false
+			return previous
+		}
+		newRecord.Ref = previous.Ref
+		return newRecord
+	})
+
+	return stored.(*consent.Record).Ref, previous, changed, nil
+}
+
+// Get returns the consent record for the provided sub and client ID from the
+// accociated manager's table.
+func (cm *memoryMapManager) Get(ctx context.Context, sub string, clientID string) (*consent.Record, bool) {
+	stored, found := cm.table.Get(cm.makeKey(sub, clientID))
+	if !found {
+		return nil, false
+	}
+
+	record := *stored.(*consent.Record)
+	return &record, true
+}
+
+// List returns all consent records of the provided sub which are not revoked
+// from the accociated manager's table, sorted by client ID.
+func (cm *memoryMapManager) List(ctx context.Context, sub string) ([]*consent.Record, error) {
+	records := make([]*consent.Record, 0)
+	for entry := range cm.table.IterBuffered() {
+		stored := entry.Val.(*consent.Record)
+		if stored.Sub != sub || stored.Revoked() {
+			continue
+		}
+		record := *stored
+		records = append(records, &record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ClientID < records[j].ClientID
+	})
+
+	return records, nil
+}
+
+// Revoke revokes the consent for the provided sub and client ID. The record
+// is kept with an empty ref, so that refs of the revoked consent are no longer
+// accepted.
+func (cm *memoryMapManager) Revoke(ctx context.Context, sub string, clientID string) error {
+	cm.table.Set(cm.makeKey(sub, clientID), &consent.Record{
+		Sub:       sub,
+		ClientID:  clientID,
+		UpdatedAt: time.Now(),
+	})
+
+	return nil
+}
+
+func equalScopes(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx, scope := range a {
+		if b[idx] != scope {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package device
+
+import (
+	"errors"
+	"time"
+
+	"stash.kopano.io/kc/konnect/identity"
+)
+
+// Errors returned by device managers when polling for a device code.
+var (
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("slow down")
+	ErrExpired              = errors.New("device code expired")
+	ErrDenied               = errors.New("access denied")
+	ErrNotFound             = errors.New("not found")
+)
+
+// Record bundles the data stored in a device manager.
+type Record struct {
+	ClientID string
+	Scopes   map[string]bool
+	UserCode string
+
+	ExpiresAt time.Time
+	Interval  time.Duration
+
+	Auth   identity.AuthRecord
+	Denied bool
+}
+
+// Manager is a interface defining a device manager.
+type Manager interface {
+	Create(record *Record) (string, error)
+	Lookup(userCode string) (*Record, bool)
+	Approve(userCode string, auth identity.AuthRecord) error
+	Deny(userCode string) error
+	Poll(deviceCode string) (*Record, error)
+}
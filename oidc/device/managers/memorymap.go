@@ -0,0 +1,234 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+	"stash.kopano.io/kgol/rndm"
+
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/oidc/device"
+)
+
+const (
+	deviceCodeValidDuration = 10 * time.Minute
+	deviceCodeInterval      = 5 * time.Second
+	deviceCodeSlowDownDelta = 5 * time.Second
+)
+
+// memoryMapManager provides the api and state for OAuth2 device authorization
+// grant. The memoryMapManager's methods are safe to call from multiple Go
+// routines.
+type memoryMapManager struct {
+	table     cmap.ConcurrentMap
+	userCodes cmap.ConcurrentMap
+}
+
+type deviceRequestRecord struct {
+	sync.Mutex
+
+	record   *device.Record
+	polledAt time.Time
+}
+
+// NewMemoryMapManager creates a new in-memory device Manager.
+func NewMemoryMapManager(ctx context.Context) device.Manager {
+	dm := &memoryMapManager{
+		table:     cmap.New(),
+		userCodes: cmap.New(),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return dm
+}
+
+func (dm *memoryMapManager) purgeExpired() {
+	var expired []string
+	// Keep expired records around for a while, so clients which are still
+	// polling receive a proper expired error.
+	deadline := time.Now().Add(-deviceCodeValidDuration)
+	var rr *deviceRequestRecord
+	for entry := range dm.table.IterBuffered() {
+		rr = entry.Val.(*deviceRequestRecord)
+		if rr.record.ExpiresAt.Before(deadline) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, deviceCode := range expired {
+		dm.remove(deviceCode)
+	}
+}
+
+func (dm *memoryMapManager) remove(deviceCode string) {
+	stored, found := dm.table.Pop(deviceCode)
+	if found {
+		dm.userCodes.Remove(stored.(*deviceRequestRecord).record.UserCode)
+	}
+}
+
+func (dm *memoryMapManager) getByUserCode(userCode string) (*deviceRequestRecord, bool) {
+	deviceCode, found := dm.userCodes.Get(device.NormalizeUserCode(userCode))
+	if !found {
+		return nil, false
+	}
+	stored, found := dm.table.Get(deviceCode.(string))
+	if !found {
+		return nil, false
+	}
+	rr := stored.(*deviceRequestRecord)
+	if rr.record.ExpiresAt.Before(time.Now()) {
+		return nil, false
+	}
+
+	return rr, true
+}
+
+// Create creates a new random device code and a unique user code, stores
+// them together with the provided record in the accociated manager's table
+// and returns the device code. The provided record's UserCode, ExpiresAt and
+// Interval fields are set accordingly.
+func (dm *memoryMapManager) Create(record *device.Record) (string, error) {
+	deviceCode := rndm.GenerateRandomString(32)
+
+	for {
+		record.UserCode = device.GenerateUserCode()
+		if dm.userCodes.SetIfAbsent(record.UserCode, deviceCode) {
+			break
+		}
+	}
+	record.ExpiresAt = time.Now().Add(deviceCodeValidDuration)
+	record.Interval = deviceCodeInterval
+
+	dm.table.Set(deviceCode, &deviceRequestRecord{
+		record: record,
+	})
+
+	return deviceCode, nil
+}
+
+// Lookup looks up the provided user code in the accociated manager's table
+// and returns the matching record plus true if found and still pending.
+func (dm *memoryMapManager) Lookup(userCode string) (*device.Record, bool) {
+	rr, found := dm.getByUserCode(userCode)
+	if !found {
+		return nil, false
+	}
+
+	rr.Lock()
+	defer rr.Unlock()
+	if rr.record.Auth != nil || rr.record.Denied {
+		return nil, false
+	}
+
+	return rr.record, true
+}
+
+// Approve binds the provided auth record to the pending device authorization
+// request identified by the provided user code.
+func (dm *memoryMapManager) Approve(userCode string, auth identity.AuthRecord) error {
+	rr, found := dm.getByUserCode(userCode)
+	if !found {
+		return device.ErrNotFound
+	}
+
+	rr.Lock()
+	defer rr.Unlock()
+	if rr.record.Auth != nil || rr.record.Denied {
+		return device.ErrNotFound
+	}
+	rr.record.Auth = auth
+
+	return nil
+}
+
+// Deny marks the pending device authorization request identified by the
+// provided user code as denied.
+func (dm *memoryMapManager) Deny(userCode string) error {
+	rr, found := dm.getByUserCode(userCode)
+	if !found {
+		return device.ErrNotFound
+	}
+
+	rr.Lock()
+	defer rr.Unlock()
+	if rr.record.Auth != nil || rr.record.Denied {
+		return device.ErrNotFound
+	}
+	rr.record.Denied = true
+
+	return nil
+}
+
+// Poll looks up the provided device code in the accociated manager's table. If
+// the request has been approved, the record is removed from the table and
+// returned. Otherwise an error describing the current state is returned.
+func (dm *memoryMapManager) Poll(deviceCode string) (*device.Record, error) {
+	stored, found := dm.table.Get(deviceCode)
+	if !found {
+		return nil, device.ErrNotFound
+	}
+	rr := stored.(*deviceRequestRecord)
+
+	rr.Lock()
+	defer rr.Unlock()
+
+	now := time.Now()
+	if rr.record.ExpiresAt.Before(now) {
+		dm.remove(deviceCode)
+		return nil, device.ErrExpired
+	}
+	if rr.record.Denied {
+		dm.remove(deviceCode)
+		return nil, device.ErrDenied
+	}
+
+	polledAt := rr.polledAt
+	rr.polledAt = now
+	if !polledAt.IsZero() && now.Sub(polledAt) < rr.record.Interval {
+		rr.record.Interval += deviceCodeSlowDownDelta
+		return nil, device.ErrSlowDown
+	}
+	if rr.record.Auth == nil {
+		return nil, device.ErrAuthorizationPending
+	}
+
+	if _, found = dm.table.Pop(deviceCode); !found {
+		// Already consumed by a concurrent request.
+		return nil, device.ErrNotFound
+	}
+	dm.userCodes.Remove(rr.record.UserCode)
+
+	return rr.record, nil
+}
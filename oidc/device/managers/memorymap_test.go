@@ -0,0 +1,135 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/oidc/device"
+)
+
+func TestPollApproveAndDeny(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dm := NewMemoryMapManager(ctx)
+
+	tests := []struct {
+		name     string
+		decide   func(userCode string) error
+		expected error
+	}{
+		{"approved", func(userCode string) error {
+			return dm.Approve(userCode, identity.NewAuthRecord(nil, "user1", nil, nil, nil))
+		}, nil},
+		{"denied", dm.Deny, device.ErrDenied},
+	}
+	for _, test := range tests {
+		record := &device.Record{
+			ClientID: "client1",
+		}
+		deviceCode, err := dm.Create(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.UserCode == "" || record.Interval != deviceCodeInterval {
+			t.Fatalf("%s: unexpected record %v", test.name, record)
+		}
+		// Allow polling without waiting for the interval.
+		record.Interval = 0
+
+		if _, err = dm.Poll(deviceCode); err != device.ErrAuthorizationPending {
+			t.Errorf("%s: got %v want %v", test.name, err, device.ErrAuthorizationPending)
+		}
+		if found, ok := dm.Lookup(device.FormatUserCode(record.UserCode)); !ok || found != record {
+			t.Errorf("%s: pending record not found by user code", test.name)
+		}
+
+		if err = test.decide(record.UserCode); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if err = test.decide(record.UserCode); err != device.ErrNotFound {
+			t.Errorf("%s: second decision got %v want %v", test.name, err, device.ErrNotFound)
+		}
+		if _, ok := dm.Lookup(record.UserCode); ok {
+			t.Errorf("%s: decided record found by user code", test.name)
+		}
+
+		polled, err := dm.Poll(deviceCode)
+		if err != test.expected {
+			t.Errorf("%s: got %v want %v", test.name, err, test.expected)
+		}
+		if test.expected == nil && (polled == nil || polled.Auth == nil) {
+			t.Errorf("%s: approved record without auth", test.name)
+		}
+		if _, err = dm.Poll(deviceCode); err != device.ErrNotFound {
+			t.Errorf("%s: poll after completion got %v want %v", test.name, err, device.ErrNotFound)
+		}
+	}
+}
+
+func TestPollSlowDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dm := NewMemoryMapManager(ctx)
+
+	record := &device.Record{
+		ClientID: "client1",
+	}
+	deviceCode, _ := dm.Create(record)
+
+	if _, err := dm.Poll(deviceCode); err != device.ErrAuthorizationPending {
+		t.Errorf("first poll got %v want %v", err, device.ErrAuthorizationPending)
+	}
+	if _, err := dm.Poll(deviceCode); err != device.ErrSlowDown {
+		t.Errorf("early poll got %v want %v", err, device.ErrSlowDown)
+	}
+	if record.Interval != deviceCodeInterval+deviceCodeSlowDownDelta {
+		t.Errorf("got interval %v want %v", record.Interval, deviceCodeInterval+deviceCodeSlowDownDelta)
+	}
+}
+
+func TestPollExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dm := NewMemoryMapManager(ctx)
+
+	record := &device.Record{
+		ClientID: "client1",
+	}
+	deviceCode, _ := dm.Create(record)
+	record.ExpiresAt = time.Now().Add(-time.Second)
+
+	if _, ok := dm.Lookup(record.UserCode); ok {
+		t.Errorf("expired record found by user code")
+	}
+	if err := dm.Approve(record.UserCode, identity.NewAuthRecord(nil, "user1", nil, nil, nil)); err != device.ErrNotFound {
+		t.Errorf("approve of expired record got %v want %v", err, device.ErrNotFound)
+	}
+	if _, err := dm.Poll(deviceCode); err != device.ErrExpired {
+		t.Errorf("got %v want %v", err, device.ErrExpired)
+	}
+	if _, err := dm.Poll(deviceCode); err != device.ErrNotFound {
+		t.Errorf("poll after expiry got %v want %v", err, device.ErrNotFound)
+	}
+}
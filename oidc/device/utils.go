@@ -0,0 +1,73 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package device
+
+import (
+	"strings"
+
+	"stash.kopano.io/kgol/rndm"
+)
+
+// UserCodeCharset is the set of characters used in user codes. It consists of
+// upper case consonants only, so codes are easy to type and never spell words
+// as recommended by RFC 8628 section 6.1.
+const UserCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// UserCodeLength is the number of characters in generated user codes.
+const UserCodeLength = 8
+
+// GenerateUserCode returns a new random user code using UserCodeCharset.
+func GenerateUserCode() string {
+	code := make([]byte, 0, UserCodeLength)
+	limit := byte(256 - 256%len(UserCodeCharset))
+	for len(code) < UserCodeLength {
+		for _, b := range rndm.GenerateRandomBytes(UserCodeLength) {
+			if b >= limit {
+				// Skip to avoid modulo bias.
+				continue
+			}
+			code = append(code, UserCodeCharset[int(b)%len(UserCodeCharset)])
+			if len(code) == UserCodeLength {
+				break
+			}
+		}
+	}
+
+	return string(code)
+}
+
+// NormalizeUserCode returns the provided user code with all characters which
+// are not part of UserCodeCharset removed, after converting it to upper case.
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(UserCodeCharset, r) {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(userCode))
+}
+
+// FormatUserCode returns the provided user code formatted for display to end
+// users by splitting it in two halves separated by a dash.
+func FormatUserCode(userCode string) string {
+	if len(userCode) != UserCodeLength {
+		return userCode
+	}
+
+	return userCode[:UserCodeLength/2] + "-" + userCode[UserCodeLength/2:]
+}
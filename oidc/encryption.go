@@ -0,0 +1,68 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package oidc
+
+// JWE key management algorithms which are supported to encrypt responses to
+// a client's public key as specified at
+// https://tools.ietf.org/html/rfc7518#section-4.1.
+var EncryptionAlgValuesSupported = []string{
+	"RSA-OAEP",
+	"RSA-OAEP-256",
+	"ECDH-ES",
+	"ECDH-ES+A128KW",
+	"ECDH-ES+A192KW",
+	"ECDH-ES+A256KW",
+}
+
+// JWE content encryption algorithms which are supported to encrypt responses
+// as specified at https://tools.ietf.org/html/rfc7518#section-5.1.
+var EncryptionEncValuesSupported = []string{
+	"A128CBC-HS256",
+	"A192CBC-HS384",
+	"A256CBC-HS512",
+	"A128GCM",
+	"A192GCM",
+	"A256GCM",
+}
+
+// EncryptionEncDefault is the content encryption algorithm used when a client
+// registered an encryption algorithm without content encryption as specified
+// at https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata.
+const EncryptionEncDefault = "A128CBC-HS256"
+
+// IsSupportedEncryptionAlg returns true if the provided JWE key management
+// algorithm is supported.
+func IsSupportedEncryptionAlg(alg string) bool {
+	for _, supported := range EncryptionAlgValuesSupported {
+		if alg == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSupportedEncryptionEnc returns true if the provided JWE content encryption
+// algorithm is supported.
+func IsSupportedEncryptionEnc(enc string) bool {
+	for _, supported := range EncryptionEncValuesSupported {
+		if enc == supported {
+			return true
+		}
+	}
+	return false
+}
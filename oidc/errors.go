@@ -50,6 +50,13 @@ func NewOAuth2Error(id string, description string) utils.ErrorWithDescription {
 // WWW-Authenticate header with comma separated fields for id and
 // description.
 func WriteWWWAuthenticateError(rw http.ResponseWriter, code int, err error) {
+	WriteWWWAuthenticateErrorWithScheme(rw, code, "", err)
+}
+
+// WriteWWWAuthenticateErrorWithScheme is like WriteWWWAuthenticateError but
+// prefixes the header value with the provided authentication scheme if it is
+// not empty.
+func WriteWWWAuthenticateErrorWithScheme(rw http.ResponseWriter, code int, scheme string, err error) {
 	if code == 0 {
 		code = http.StatusUnauthorized
 	}
@@ -61,7 +68,11 @@ func WriteWWWAuthenticateError(rw http.ResponseWriter, code int, err error) {
 	default:
 	}
 
-	rw.Header().Set("WWW-Authenticate", fmt.Sprintf("error=\"%s\", error_description=\"%s\"", err.Error(), description))
+	value := fmt.Sprintf("error=\"%s\", error_description=\"%s\"", err.Error(), description)
+	if scheme != "" {
+		value = scheme + " " + value
+	}
+	rw.Header().Set("WWW-Authenticate", value)
 	rw.WriteHeader(code)
 }
 
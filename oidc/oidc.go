@@ -20,3 +20,148 @@ package oidc
 // KonnectIDTokenSubjectSaltV1 is the salt value used when hasing Subjects in
 // ID tokens created by Konnect.
 const KonnectIDTokenSubjectSaltV1 = "konnect-IDToken-v1"
+
+// KonnectPairwiseSubjectSaltV1 is the salt value used when deriving pairwise
+// Subjects for clients which are registered with the pairwise subject type.
+const KonnectPairwiseSubjectSaltV1 = "konnect-pairwise-v1"
+
+// Additional OAuth 2.0 error codes used by Konnect.
+const (
+	ErrorCodeOAuth2InvalidClient      = "invalid_client"
+	ErrorCodeOAuth2InvalidScope       = "invalid_scope"
+	ErrorCodeOAuth2UnauthorizedClient = "unauthorized_client"
+)
+
+// OAuth 2.0 error codes as specified at https://tools.ietf.org/html/rfc8693#section-2.2.2.
+const (
+	ErrorCodeOAuth2InvalidTarget = "invalid_target"
+)
+
+// OAuth 2.0 error codes as specified at https://tools.ietf.org/html/rfc8628#section-3.5.
+const (
+	ErrorCodeOAuth2AuthorizationPending = "authorization_pending"
+	ErrorCodeOAuth2SlowDown             = "slow_down"
+	ErrorCodeOAuth2ExpiredToken         = "expired_token"
+)
+
+// Additional grant types as specified at https://tools.ietf.org/html/rfc6749.
+const (
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// Device authorization grant type as specified at https://tools.ietf.org/html/rfc8628#section-3.4.
+const (
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// Token exchange grant type as specified at https://tools.ietf.org/html/rfc8693#section-2.1.
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// Token type identifiers as specified at https://tools.ietf.org/html/rfc8693#section-3.
+const (
+	TokenTypeIdentifierAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIdentifierJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Additional client authentication methods as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+const (
+	AuthMethodClientSecretPost = "client_secret_post"
+	AuthMethodClientSecretJWT  = "client_secret_jwt"
+	AuthMethodPrivateKeyJWT    = "private_key_jwt"
+)
+
+// Mutual TLS client authentication methods as specified at
+// https://tools.ietf.org/html/rfc8705#section-2
+const (
+	AuthMethodTLSClientAuth           = "tls_client_auth"
+	AuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+// Client assertion types as specified at https://tools.ietf.org/html/rfc7523#section-2.2.
+const (
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// Token type hints as specified at https://tools.ietf.org/html/rfc7009#section-2.1
+// and https://tools.ietf.org/html/rfc7662#section-2.1.
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// Request URI prefix for pushed authorization requests as specified at
+// https://tools.ietf.org/html/rfc9126#section-2.2.
+const (
+	RequestURIPrefixPushedAuthorizationRequest = "urn:ietf:params:oauth:request_uri:"
+)
+
+// Additional response modes as specified at
+// https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html and
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.3.
+const (
+	ResponseModeFormPost    = "form_post"
+	ResponseModeJWT         = "jwt"
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFragmentJWT = "fragment.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+)
+
+// Logout token event as specified at
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken.
+const (
+	LogoutTokenEventBackChannelLogout = "http://schemas.openid.net/event/backchannel-logout"
+)
+
+// Access token profiles supported by Konnect. The JWT profile is specified at
+// https://tools.ietf.org/html/rfc9068.
+const (
+	AccessTokenProfileKonnect = "konnect"
+	AccessTokenProfileJWT     = "jwt"
+)
+
+// JWT typ header value of access tokens issued with the JWT profile as
+// specified at https://tools.ietf.org/html/rfc9068#section-2.1.
+const (
+	AccessTokenJWTType = "at+jwt"
+)
+
+// DPoP header, token type and error codes as specified at
+// https://tools.ietf.org/html/rfc9449.
+const (
+	DPoPHeader      = "DPoP"
+	DPoPNonceHeader = "DPoP-Nonce"
+	DPoPProofType   = "dpop+jwt"
+	TokenTypeDPoP   = "DPoP"
+
+	ErrorCodeOAuth2InvalidDPoPProof = "invalid_dpop_proof"
+	ErrorCodeOAuth2UseDPoPNonce     = "use_dpop_nonce"
+)
+
+// Additional claims as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#IDToken.
+const (
+	ACRClaim = "acr"
+	AMRClaim = "amr"
+)
+
+// Authentication context class reference values used by Konnect. The value
+// "0" is specified at https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+// and signals an authentication which does not meet ISO/IEC 29115 level 1, for
+// example the re-use of a long-lived browser cookie.
+const (
+	ACRValueNone         = "0"
+	ACRValueSingleFactor = "1"
+)
+
+// Authentication method reference values as specified at
+// https://tools.ietf.org/html/rfc8176#section-2 and additional values used
+// by Konnect.
+const (
+	AMRValuePassword          = "pwd"
+	AMRValueWindowsIntegrated = "wia"
+	AMRValueFederated         = "fed"
+	AMRValueCookie            = "cookie"
+)
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kc/konnect/oidc/par"
+)
+
+func TestPopRequestURI(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pm := NewMemoryMapManager(ctx)
+
+	tests := []struct {
+		used     bool
+		validFor time.Duration
+	}{
+		{false, requestURIValidDuration},
+		{true, requestURIUsedValidDuration},
+	}
+	for _, test := range tests {
+		record := &par.Record{
+			ClientID: "client1",
+			Values:   url.Values{"scope": {"openid"}},
+			Used:     test.used,
+		}
+		requestURI, err := pm.Create(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expiresIn := time.Until(record.ExpiresAt); expiresIn > test.validFor || expiresIn < test.validFor-time.Minute {
+			t.Errorf("used %v: unexpected expiration in %v", test.used, expiresIn)
+		}
+
+		popped, found := pm.Pop(requestURI)
+		if !found || popped.ClientID != record.ClientID {
+			t.Errorf("used %v: request_uri not found on first use", test.used)
+		}
+		if _, found = pm.Pop(requestURI); found {
+			t.Errorf("used %v: request_uri found on second use", test.used)
+		}
+	}
+
+	// Expired records are not returned.
+	record := &par.Record{
+		ClientID: "client1",
+	}
+	requestURI, _ := pm.Create(record)
+	record.ExpiresAt = time.Now().Add(-time.Second)
+	if _, found := pm.Pop(requestURI); found {
+		t.Errorf("expired request_uri found")
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+	"stash.kopano.io/kgol/rndm"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/par"
+)
+
+const (
+	requestURIValidDuration     = 90 * time.Second
+	requestURIUsedValidDuration = 10 * time.Minute
+)
+
+// Manager provides the api and state for OAuth 2.0 pushed authorization
+// requests. The manager's methods are safe to call from multiple Go routines.
+type memoryMapManager struct {
+	table cmap.ConcurrentMap
+}
+
+// NewMemoryMapManager creates a new pushed authorization request Manager.
+func NewMemoryMapManager(ctx context.Context) par.Manager {
+	pm := &memoryMapManager{
+		table: cmap.New(),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+
+		}
+	}()
+
+	return pm
+}
+
+func (pm *memoryMapManager) purgeExpired() {
+	var expired []string
+	now := time.Now()
+	var record *par.Record
+	for entry := range pm.table.IterBuffered() {
+		record = entry.Val.(*par.Record)
+		if record.ExpiresAt.Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, requestURI := range expired {
+		pm.table.Remove(requestURI)
+	}
+}
+
+// Create creates a new random request URI, stores it together with the
+// provided record in the accociated manager's table and returns the request
+// URI. The record's expiration is set by this function, records which are
+// marked as used stay valid longer, so the end-user can sign in and give
+// consent.
+func (pm *memoryMapManager) Create(record *par.Record) (string, error) {
+	requestURI := konnectoidc.RequestURIPrefixPushedAuthorizationRequest + rndm.GenerateRandomString(32)
+
+	if record.Used {
+		record.ExpiresAt = time.Now().Add(requestURIUsedValidDuration)
+	} else {
+		record.ExpiresAt = time.Now().Add(requestURIValidDuration)
+	}
+	pm.table.Set(requestURI, record)
+
+	return requestURI, nil
+}
+
+// Pop looks up the provided request URI in the accociated manager's table and
+// removes it, so every request URI can only be used once. If found and not
+// expired, it returns the stored record plus true. Otherwise it returns nil
+// plus false.
+func (pm *memoryMapManager) Pop(requestURI string) (*par.Record, bool) {
+	stored, found := pm.table.Pop(requestURI)
+	if !found {
+		return nil, false
+	}
+	record := stored.(*par.Record)
+	if record.ExpiresAt.Before(time.Now()) {
+		return nil, false
+	}
+
+	return record, true
+}
+
+// Remove removes the provided request URI from the accociated manager's
+// table, so it cannot be used again.
+func (pm *memoryMapManager) Remove(requestURI string) {
+	pm.table.Remove(requestURI)
+}
@@ -49,6 +49,7 @@ type AuthenticationRequest struct {
 	RawPrompt       string         `schema:"prompt"`
 	RawIDTokenHint  string         `schema:"id_token_hint"`
 	RawMaxAge       string         `schema:"max_age"`
+	RawACRValues    string         `schema:"acr_values"`
 
 	RawRequest      string `schema:"request"`
 	RawRequestURI   string `schema:"request_uri"`
@@ -57,18 +58,25 @@ type AuthenticationRequest struct {
 	CodeChallenge       string `schema:"code_challenge"`
 	CodeChallengeMethod string `schema:"code_challenge_method"`
 
+	Resources []string `schema:"resource"`
+
 	Scopes        map[string]bool `schema:"-"`
 	ResponseTypes map[string]bool `schema:"-"`
 	Prompts       map[string]bool `schema:"-"`
 	RedirectURI   *url.URL        `schema:"-"`
 	IDTokenHint   *jwt.Token      `schema:"-"`
 	MaxAge        time.Duration   `schema:"-"`
+	ACRValues     []string        `schema:"-"`
 	Request       *jwt.Token      `schema:"-"`
 
 	UseFragment bool   `schema:"-"`
+	UseFormPost bool   `schema:"-"`
+	UseJWT      bool   `schema:"-"`
 	Flow        string `schema:"-"`
 
 	Session *Session `schema:"-"`
+
+	publicSubjectFunc func(string) (string, error)
 }
 
 // DecodeAuthenticationRequest returns a AuthenticationRequest holding the
@@ -135,6 +143,9 @@ func NewAuthenticationRequest(values url.Values, providerMetadata *oidc.WellKnow
 			ar.Prompts[prompt] = true
 		}
 	}
+	if ar.RawACRValues != "" {
+		ar.ACRValues = strings.Split(ar.RawACRValues, " ")
+	}
 
 	switch ar.RawResponseType {
 	case oidc.ResponseTypeCode:
@@ -167,6 +178,27 @@ func NewAuthenticationRequest(values url.Values, providerMetadata *oidc.WellKnow
 	case oidc.ResponseModeQuery:
 		ar.UseFragment = false
 		// breaks
+	case konnectoidc.ResponseModeFormPost:
+		ar.UseFragment = false
+		ar.UseFormPost = true
+		// breaks
+	case konnectoidc.ResponseModeJWT:
+		// JWT response with default mode of the flow.
+		ar.UseJWT = true
+		// breaks
+	case konnectoidc.ResponseModeQueryJWT:
+		ar.UseFragment = false
+		ar.UseJWT = true
+		// breaks
+	case konnectoidc.ResponseModeFragmentJWT:
+		ar.UseFragment = true
+		ar.UseJWT = true
+		// breaks
+	case konnectoidc.ResponseModeFormPostJWT:
+		ar.UseFragment = false
+		ar.UseFormPost = true
+		ar.UseJWT = true
+		// breaks
 	}
 
 	if ar.RawMaxAge != "" {
@@ -235,6 +267,9 @@ func (ar *AuthenticationRequest) ApplyRequestObject(roc *RequestObjectClaims, me
 	if roc.RawRedirectURI != "" {
 		ar.RawRedirectURI = roc.RawRedirectURI
 	}
+	if roc.ResponseMode != "" {
+		ar.ResponseMode = roc.ResponseMode
+	}
 	if roc.State != "" {
 		ar.State = roc.State
 	}
@@ -250,6 +285,9 @@ func (ar *AuthenticationRequest) ApplyRequestObject(roc *RequestObjectClaims, me
 	if roc.RawMaxAge != "" {
 		ar.RawMaxAge = roc.RawMaxAge
 	}
+	if roc.RawACRValues != "" {
+		ar.RawACRValues = roc.RawACRValues
+	}
 	if roc.RawRegistration != "" {
 		ar.RawRegistration = roc.RawRegistration
 	}
@@ -259,6 +297,9 @@ func (ar *AuthenticationRequest) ApplyRequestObject(roc *RequestObjectClaims, me
 	if roc.CodeChallenge != "" {
 		ar.CodeChallenge = roc.CodeChallenge
 	}
+	if len(roc.Resources) > 0 {
+		ar.Resources = roc.Resources
+	}
 
 	return nil
 }
@@ -312,6 +353,12 @@ func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 		}
 	}
 
+	// Tokens must not be put in the query with unencrypted JWT responses, see
+	// https://openid.net/specs/oauth-v2-jarm.html#section-2.3.1.
+	if ar.ResponseMode == konnectoidc.ResponseModeQueryJWT && ar.Flow != oidc.FlowCode {
+		return ar.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "query.jwt response mode requires code flow")
+	}
+
 	if _, hasNonePrompt := ar.Prompts[oidc.PromptNone]; hasNonePrompt {
 		if len(ar.Prompts) > 1 {
 			// Cannot have other prompts if none is requested.
@@ -328,6 +375,10 @@ func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 		return ar.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "invalid or missing redirect_uri")
 	}
 
+	if err := ValidateResourceIndicators(ar.Resources); err != nil {
+		return ar.NewBadRequest(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+	}
+
 	if ar.RawIDTokenHint != "" {
 		parser := &jwt.Parser{
 			SkipClaimsValidation: true,
@@ -366,9 +417,23 @@ func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 	return nil
 }
 
+// SetPublicSubjectFunc sets the function which is used to map subjects to the
+// subjects as presented to the accociated request's client.
+func (ar *AuthenticationRequest) SetPublicSubjectFunc(f func(string) (string, error)) {
+	ar.publicSubjectFunc = f
+}
+
 // Verify checks that the passed parameters match the accociated requirements.
 func (ar *AuthenticationRequest) Verify(userID string) error {
 	if ar.IDTokenHint != nil {
+		if ar.publicSubjectFunc != nil {
+			// Map userID to the subject as presented to the client.
+			publicUserID, err := ar.publicSubjectFunc(userID)
+			if err != nil {
+				return err
+			}
+			userID = publicUserID
+		}
 		// Compare userID with IDTokenHint.
 		if userID != ar.IDTokenHint.Claims.(*konnectoidc.IDTokenClaims).Subject {
 			return ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "userid mismatch")
@@ -378,6 +443,33 @@ func (ar *AuthenticationRequest) Verify(userID string) error {
 	return nil
 }
 
+// RequestedACRValues returns the authentication context class reference values
+// requested by the accociated authentication request in order of preference
+// and true if the values were requested as essential claim. A claims request
+// for the acr claim of the ID token takes precedence over the acr_values
+// parameter as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#acrSemantics.
+func (ar *AuthenticationRequest) RequestedACRValues() ([]string, bool) {
+	if ar.Claims != nil && ar.Claims.IDToken != nil {
+		if crv, ok := ar.Claims.IDToken.Get(konnectoidc.ACRClaim); ok && crv != nil {
+			var values []string
+			if value, ok := crv.Value.(string); ok && value != "" {
+				values = append(values, value)
+			}
+			for _, v := range crv.Values {
+				if value, ok := v.(string); ok && value != "" {
+					values = append(values, value)
+				}
+			}
+			if len(values) > 0 {
+				return values, crv.Essential
+			}
+		}
+	}
+
+	return ar.ACRValues, false
+}
+
 // NewError creates a new error with id and string and the associated request's
 // state.
 func (ar *AuthenticationRequest) NewError(id string, description string) *AuthenticationError {
@@ -416,6 +508,13 @@ type AuthenticationSuccess struct {
 	SessionState string `url:"session_state,omitempty"`
 }
 
+// AuthenticationJWTResponse holds the outgoing data for an OpenID Connect 1.0
+// authorize response in JWT Secured Authorization Response Mode as specified
+// at https://openid.net/specs/oauth-v2-jarm.html#section-2.1.
+type AuthenticationJWTResponse struct {
+	Response string `url:"response"`
+}
+
 // AuthenticationError holds the outgoind data for a failed OpenID
 // Connect 1.0 authorize request as specified at
 // http://openid.net/specs/openid-connect-core-1_0.html#AuthError and
@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 
 	"stash.kopano.io/kgol/oidc-go"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 )
 
 var scopedClaims = map[string]string{
@@ -41,6 +43,14 @@ var scopedClaims = map[string]string{
 	oidc.EmailVerifiedClaim: oidc.ScopeEmail,
 }
 
+// unscopedClaims are claims which are not mapped to a scope but can be
+// requested nevertheless, since they describe the authentication and not the
+// user.
+var unscopedClaims = map[string]bool{
+	konnectoidc.ACRClaim: true,
+	oidc.AuthTimeClaim:   true,
+}
+
 // GetScopeForClaim returns the known scope if any for the provided claim name.
 func GetScopeForClaim(claim string) (string, bool) {
 	scope, ok := scopedClaims[claim]
@@ -59,21 +69,15 @@ type ClaimsRequest struct {
 }
 
 // ApplyScopes removes all claims requests from the accociated claims request
-// which are not mapped to one of the provided approved scopes.
+// which are not mapped to one of the provided approved scopes. Only claims
+// which describe the authentication, like the acr claim, are kept without
+// being mapped to a scope.
 func (cr *ClaimsRequest) ApplyScopes(approvedScopes map[string]bool) error {
 	if cr.UserInfo != nil {
-		for claim := range *cr.UserInfo {
-			if approved := approvedScopes[scopedClaims[claim]]; !approved {
-				delete(*cr.UserInfo, claim)
-			}
-		}
+		cr.UserInfo.applyScopes(approvedScopes)
 	}
 	if cr.IDToken != nil {
-		for claim := range *cr.IDToken {
-			if approved := approvedScopes[scopedClaims[claim]]; !approved {
-				delete(*cr.IDToken, claim)
-			}
-		}
+		cr.IDToken.applyScopes(approvedScopes)
 	}
 
 	return nil
@@ -114,6 +118,17 @@ func (cr *ClaimsRequest) Scopes(excludedScopes map[string]bool) []string {
 // OpenID Connect claims request parameter values.
 type ClaimsRequestMap map[string]*ClaimsRequestValue
 
+func (crm *ClaimsRequestMap) applyScopes(approvedScopes map[string]bool) {
+	for claim := range *crm {
+		if unscopedClaims[claim] {
+			continue
+		}
+		if scope, scoped := scopedClaims[claim]; !scoped || !approvedScopes[scope] {
+			delete(*crm, claim)
+		}
+	}
+}
+
 // ScopesMap returns a map of scopes defined by the claims in tha associated map.
 func (crm *ClaimsRequestMap) ScopesMap(excludedScopes map[string]bool) map[string]bool {
 	scopesMap := make(map[string]bool)
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"stash.kopano.io/kgol/oidc-go"
+)
+
+func TestClaimsRequestApplyScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   map[string]bool
+		expected []string
+	}{
+		{"no scopes", map[string]bool{}, []string{"acr", "auth_time"}},
+		{"email", map[string]bool{oidc.ScopeEmail: true}, []string{"acr", "auth_time", "email"}},
+		{"profile and phone", map[string]bool{oidc.ScopeProfile: true, "phone": true}, []string{"acr", "auth_time", "name"}},
+	}
+	for _, test := range tests {
+		cr := &ClaimsRequest{
+			UserInfo: &ClaimsRequestMap{},
+			IDToken:  &ClaimsRequestMap{},
+		}
+		for _, claim := range []string{"acr", "auth_time", "email", "name", "phone_number", "address", "groups", "custom"} {
+			(*cr.UserInfo)[claim] = nil
+			(*cr.IDToken)[claim] = nil
+		}
+
+		err := cr.ApplyScopes(test.scopes)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, crm := range []*ClaimsRequestMap{cr.UserInfo, cr.IDToken} {
+			claims := make([]string, 0)
+			for claim := range *crm {
+				claims = append(claims, claim)
+			}
+			sort.Strings(claims)
+			if strings.Join(claims, " ") != strings.Join(test.expected, " ") {
+				t.Errorf("%s: got claims %v want %v", test.name, claims, test.expected)
+			}
+		}
+	}
+}
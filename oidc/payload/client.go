@@ -0,0 +1,93 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"stash.kopano.io/kgol/oidc-go"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+)
+
+// ErrMultipleClientAuthMethods is returned when a request uses more than one
+// client authentication method, which is not allowed as specified at
+// https://tools.ietf.org/html/rfc6749#section-2.3.
+var ErrMultipleClientAuthMethods = errors.New("multiple client authentication methods")
+
+// decodeClientCredentials reads the client credentials from the provided
+// request's Authorization header if it is set and fills in the provided
+// client id and secret. The already decoded form values are checked so that
+// only one authentication method is used. It returns the client
+// authentication method which was found or an empty string for client
+// assertions, which are validated elsewhere.
+func decodeClientCredentials(req *http.Request, clientID *string, clientSecret *string, withAssertion bool) (string, error) {
+	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	switch auth[0] {
+	case "Basic":
+		if *clientSecret != "" || withAssertion {
+			return "", ErrMultipleClientAuthMethods
+		}
+		if len(auth) != 2 {
+			return "", fmt.Errorf("invalid Basic authorization header format")
+		}
+		basic, err := base64.StdEncoding.DecodeString(auth[1])
+		if err != nil {
+			return "", err
+		}
+		// Split client id and secret.
+		check := strings.SplitN(string(basic), ":", 2)
+		if len(check) != 2 {
+			return "", fmt.Errorf("invalid Basic authorization header value")
+		}
+		// Data is encoded application/x-www-form-urlencoded UTF-8. See
+		// https://tools.ietf.org/html/rfc6749#appendix-B for details.
+		id, err := url.QueryUnescape(check[0])
+		if err != nil {
+			return "", err
+		}
+		secret, err := url.QueryUnescape(check[1])
+		if err != nil {
+			return "", err
+		}
+		if *clientID != "" && *clientID != id {
+			return "", fmt.Errorf("client_id mismatch")
+		}
+		*clientID = id
+		*clientSecret = secret
+
+		return oidc.AuthMethodClientSecretBasic, nil
+	}
+
+	switch {
+	case withAssertion:
+		if *clientSecret != "" {
+			return "", ErrMultipleClientAuthMethods
+		}
+		return "", nil
+	case *clientSecret != "":
+		return konnectoidc.AuthMethodClientSecretPost, nil
+	default:
+		return oidc.AuthMethodNone, nil
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ClientAssertionClaims holds the claims of JWT client assertions as used for
+// client authentication as specified at https://tools.ietf.org/html/rfc7523#section-3
+// and https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+type ClientAssertionClaims struct {
+	jwt.StandardClaims
+
+	Audience AudienceList `json:"aud,omitempty"`
+}
+
+// Valid implements the jwt.Claims interface.
+func (cac ClientAssertionClaims) Valid() error {
+	if err := cac.StandardClaims.Valid(); err != nil {
+		return err
+	}
+	if cac.Issuer == "" || cac.Issuer != cac.Subject {
+		return errors.New("iss and sub claims must match")
+	}
+	if cac.ExpiresAt == 0 {
+		return errors.New("missing exp claim")
+	}
+	if cac.Id == "" {
+		return errors.New("missing jti claim")
+	}
+
+	return nil
+}
+
+// AudienceList holds the values of an aud claim, which can either be a single
+// string or an array of strings.
+type AudienceList []string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (al *AudienceList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*al = AudienceList{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*al = AudienceList(multiple)
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface. Single values are
+// encoded as string, as is common for the aud claim.
+func (al AudienceList) MarshalJSON() ([]byte, error) {
+	if len(al) == 1 {
+		return json.Marshal(al[0])
+	}
+
+	return json.Marshal([]string(al))
+}
+
+// Contains returns true if the accociated audience list contains the
+// provided value.
+func (al AudienceList) Contains(value string) bool {
+	for _, v := range al {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
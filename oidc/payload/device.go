@@ -0,0 +1,105 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"stash.kopano.io/kgol/oidc-go"
+)
+
+// DeviceAuthorizationRequest holds the incoming parameters and request data
+// for the OAuth 2.0 device authorization endpoint as specified at
+// https://tools.ietf.org/html/rfc8628#section-3.1
+type DeviceAuthorizationRequest struct {
+	providerMetadata *oidc.WellKnown
+
+	RawScope string `schema:"scope"`
+
+	ClientID            string `schema:"client_id"`
+	ClientSecret        string `schema:"client_secret"`
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+
+	Scopes           map[string]bool `schema:"-"`
+	ClientAuthMethod string          `schema:"-"`
+}
+
+// DecodeDeviceAuthorizationRequest returns a DeviceAuthorizationRequest
+// holding the provided request's form data.
+func DecodeDeviceAuthorizationRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*DeviceAuthorizationRequest, error) {
+	dar, err := NewDeviceAuthorizationRequest(req.PostForm, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	dar.ClientAuthMethod, err = decodeClientCredentials(req, &dar.ClientID, &dar.ClientSecret, dar.ClientAssertion != "" || dar.ClientAssertionType != "")
+	if err != nil {
+		return nil, err
+	}
+
+	return dar, nil
+}
+
+// NewDeviceAuthorizationRequest returns a DeviceAuthorizationRequest holding
+// the provided url values.
+func NewDeviceAuthorizationRequest(values url.Values, providerMetadata *oidc.WellKnown) (*DeviceAuthorizationRequest, error) {
+	dar := &DeviceAuthorizationRequest{
+		providerMetadata: providerMetadata,
+
+		Scopes: make(map[string]bool),
+	}
+
+	err := DecodeSchema(dar, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if dar.RawScope != "" {
+		for _, scope := range strings.Split(dar.RawScope, " ") {
+			dar.Scopes[scope] = true
+		}
+	}
+
+	return dar, nil
+}
+
+// Validate validates the request data of the accociated device authorization
+// request.
+func (dar *DeviceAuthorizationRequest) Validate() error {
+	if dar.ClientID == "" && dar.ClientAssertion == "" {
+		return fmt.Errorf("missing client_id")
+	}
+
+	return nil
+}
+
+// DeviceAuthorizationResponse holds the outgoing data for a successful OAuth
+// 2.0 device authorization request as specified at
+// https://tools.ietf.org/html/rfc8628#section-3.2
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval,omitempty"`
+}
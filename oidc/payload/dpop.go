@@ -0,0 +1,54 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DPoPProofClaims holds the claims of DPoP proof JWTs as specified at
+// https://tools.ietf.org/html/rfc9449#section-4.2
+type DPoPProofClaims struct {
+	jwt.StandardClaims
+
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	ATH   string `json:"ath,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// Valid implements the jwt.Claims interface. The age of the proof is not
+// validated here, since it is checked by the receiver with some leeway.
+func (dpc DPoPProofClaims) Valid() error {
+	if dpc.Id == "" {
+		return errors.New("missing jti claim")
+	}
+	if dpc.HTM == "" {
+		return errors.New("missing htm claim")
+	}
+	if dpc.HTU == "" {
+		return errors.New("missing htu claim")
+	}
+	if dpc.IssuedAt == 0 {
+		return errors.New("missing iat claim")
+	}
+
+	return nil
+}
@@ -40,6 +40,8 @@ type EndSessionRequest struct {
 
 	IDTokenHint           *jwt.Token `schema:"-"`
 	PostLogoutRedirectURI *url.URL   `schema:"-"`
+
+	publicSubjectFunc func(string) (string, error)
 }
 
 // DecodeEndSessionRequest returns a EndSessionRequest holding the
@@ -86,9 +88,24 @@ func (esr *EndSessionRequest) Validate(keyFunc jwt.Keyfunc) error {
 	return nil
 }
 
+// SetPublicSubjectFunc sets the function which is used to map subjects to the
+// subjects as presented to the client of the accociated request's ID token
+// hint.
+func (esr *EndSessionRequest) SetPublicSubjectFunc(f func(string) (string, error)) {
+	esr.publicSubjectFunc = f
+}
+
 // Verify checks that the passed parameters match the accociated requirements.
 func (esr *EndSessionRequest) Verify(userID string) error {
 	if esr.IDTokenHint != nil {
+		if esr.publicSubjectFunc != nil {
+			// Map userID to the subject as presented to the client.
+			publicUserID, err := esr.publicSubjectFunc(userID)
+			if err != nil {
+				return err
+			}
+			userID = publicUserID
+		}
 		// Compare userID with IDTokenHint.
 		if userID != esr.IDTokenHint.Claims.(*konnectoidc.IDTokenClaims).Subject {
 			return esr.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "userid mismatch")
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dgrijalva/jwt-go"
+	"stash.kopano.io/kgol/oidc-go"
+)
+
+// IntrospectionRequest holds the incoming parameters and request data for
+// the OAuth 2.0 token introspection endpoint as specified at
+// https://tools.ietf.org/html/rfc7662#section-2.1
+type IntrospectionRequest struct {
+	providerMetadata *oidc.WellKnown
+
+	Token         string `schema:"token"`
+	TokenTypeHint string `schema:"token_type_hint"`
+
+	ClientID            string `schema:"client_id"`
+	ClientSecret        string `schema:"client_secret"`
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+
+	ClientAuthMethod string `schema:"-"`
+}
+
+// DecodeIntrospectionRequest returns a IntrospectionRequest holding the
+// provided request's form data.
+func DecodeIntrospectionRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*IntrospectionRequest, error) {
+	ir, err := NewIntrospectionRequest(req.PostForm, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	ir.ClientAuthMethod, err = decodeClientCredentials(req, &ir.ClientID, &ir.ClientSecret, ir.ClientAssertion != "" || ir.ClientAssertionType != "")
+	if err != nil {
+		return nil, err
+	}
+
+	return ir, nil
+}
+
+// NewIntrospectionRequest returns a IntrospectionRequest holding the provided
+// url values.
+func NewIntrospectionRequest(values url.Values, providerMetadata *oidc.WellKnown) (*IntrospectionRequest, error) {
+	ir := &IntrospectionRequest{
+		providerMetadata: providerMetadata,
+	}
+
+	err := DecodeSchema(ir, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return ir, nil
+}
+
+// Validate validates the request data of the accociated introspection request.
+func (ir *IntrospectionRequest) Validate() error {
+	if ir.Token == "" {
+		return fmt.Errorf("missing token")
+	}
+	if ir.ClientID == "" && ir.ClientAssertion == "" {
+		return fmt.Errorf("missing client_id")
+	}
+
+	return nil
+}
+
+// IntrospectionResponse holds the outgoing data for a OAuth 2.0 token
+// introspection request as specified at
+// https://tools.ietf.org/html/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active bool `json:"active"`
+
+	Scope     string       `json:"scope,omitempty"`
+	ClientID  string       `json:"client_id,omitempty"`
+	TokenType string       `json:"token_type,omitempty"`
+	ExpiresAt int64        `json:"exp,omitempty"`
+	IssuedAt  int64        `json:"iat,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  AudienceList `json:"aud,omitempty"`
+	Issuer    string       `json:"iss,omitempty"`
+	ID        string       `json:"jti,omitempty"`
+
+	IdentityClaims   jwt.MapClaims `json:"kc.identity,omitempty"`
+	IdentityProvider string        `json:"kc.provider,omitempty"`
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"stash.kopano.io/kgol/oidc-go"
+)
+
+// PushedAuthorizationRequest holds the incoming parameters and request data
+// for the OAuth 2.0 pushed authorization request endpoint as specified at
+// https://tools.ietf.org/html/rfc9126#section-2.1
+type PushedAuthorizationRequest struct {
+	providerMetadata *oidc.WellKnown
+
+	ClientID            string `schema:"client_id"`
+	ClientSecret        string `schema:"client_secret"`
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+
+	RawRequestURI string `schema:"request_uri"`
+
+	ClientAuthMethod string     `schema:"-"`
+	Values           url.Values `schema:"-"`
+}
+
+// DecodePushedAuthorizationRequest returns a PushedAuthorizationRequest
+// holding the provided request's form data.
+func DecodePushedAuthorizationRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*PushedAuthorizationRequest, error) {
+	parr, err := NewPushedAuthorizationRequest(req.PostForm, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	parr.ClientAuthMethod, err = decodeClientCredentials(req, &parr.ClientID, &parr.ClientSecret, parr.ClientAssertion != "" || parr.ClientAssertionType != "")
+	if err != nil {
+		return nil, err
+	}
+
+	return parr, nil
+}
+
+// NewPushedAuthorizationRequest returns a PushedAuthorizationRequest holding
+// the provided url values. All values except for the client authentication
+// parameters are kept as authorization request parameters.
+func NewPushedAuthorizationRequest(values url.Values, providerMetadata *oidc.WellKnown) (*PushedAuthorizationRequest, error) {
+	parr := &PushedAuthorizationRequest{
+		providerMetadata: providerMetadata,
+
+		Values: make(url.Values),
+	}
+
+	err := DecodeSchema(parr, values)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range values {
+		switch key {
+		case "client_secret", "client_assertion", "client_assertion_type":
+			// Never keep client credentials.
+		default:
+			parr.Values[key] = value
+		}
+	}
+
+	return parr, nil
+}
+
+// Validate validates the request data of the accociated pushed authorization
+// request.
+func (parr *PushedAuthorizationRequest) Validate() error {
+	if parr.ClientID == "" && parr.ClientAssertion == "" {
+		return fmt.Errorf("missing client_id")
+	}
+	if parr.RawRequestURI != "" {
+		// See https://tools.ietf.org/html/rfc9126#section-2.1.
+		return fmt.Errorf("request_uri must not be pushed")
+	}
+
+	return nil
+}
+
+// PushedAuthorizationResponse holds the outgoing data for a successful OAuth
+// 2.0 pushed authorization request as specified at
+// https://tools.ietf.org/html/rfc9126#section-2.2
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
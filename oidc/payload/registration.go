@@ -54,9 +54,95 @@ type ClientRegistrationRequest struct {
 	RawTokenEndpointAuthMethod     string `json:"token_endpoint_auth_method"`
 	RawTokenEndpointAuthSigningAlg string `json:"token_endpoint_auth_signing_alg"`
 
+	RawAuthorizationSignedResponseAlg string `json:"authorization_signed_response_alg"`
+
+	RawUserInfoEncryptedResponseAlg string `json:"userinfo_encrypted_response_alg"`
+	RawUserInfoEncryptedResponseEnc string `json:"userinfo_encrypted_response_enc"`
+
 	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
 
+	BackChannelLogoutURI             string `json:"backchannel_logout_uri"`
+	BackChannelLogoutSessionRequired bool   `json:"backchannel_logout_session_required"`
+
+	FrontChannelLogoutURI             string `json:"frontchannel_logout_uri"`
+	FrontChannelLogoutSessionRequired bool   `json:"frontchannel_logout_session_required"`
+
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests"`
+
+	SubjectType         string `json:"subject_type,omitempty"`
+	SectorIdentifierURI string `json:"sector_identifier_uri,omitempty"`
+
+	TLSClientAuthSubjectDN                string `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANDNS                   string `json:"tls_client_auth_san_dns,omitempty"`
+	TLSClientAuthSANURI                   string `json:"tls_client_auth_san_uri,omitempty"`
+	TLSClientAuthSANIP                    string `json:"tls_client_auth_san_ip,omitempty"`
+	TLSClientAuthSANEmail                 string `json:"tls_client_auth_san_email,omitempty"`
+	TLSClientCertificateBoundAccessTokens bool   `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+
 	JWKS *gojwk.Key `json:"-"`
+
+	// Client credentials as sent when updating a registration as specified at
+	// https://tools.ietf.org/html/rfc7592#section-2.2
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// NewClientRegistrationRequest returns a ClientRegistrationRequest holding the
+// provided client registration's data.
+func NewClientRegistrationRequest(cr *clients.ClientRegistration) (*ClientRegistrationRequest, error) {
+	crr := &ClientRegistrationRequest{
+		RedirectURIs:    cr.RedirectURIs,
+		ResponseTypes:   cr.ResponseTypes,
+		GrantTypes:      cr.GrantTypes,
+		ApplicationType: cr.ApplicationType,
+
+		Contacts:   cr.Contacts,
+		ClientName: cr.Name,
+		ClientURI:  cr.URI,
+
+		RawIDTokenSignedResponseAlg:    cr.RawIDTokenSignedResponseAlg,
+		RawUserInfoSignedResponseAlg:   cr.RawUserInfoSignedResponseAlg,
+		RawRequestObjectSigningAlg:     cr.RawRequestObjectSigningAlg,
+		RawTokenEndpointAuthMethod:     cr.RawTokenEndpointAuthMethod,
+		RawTokenEndpointAuthSigningAlg: cr.RawTokenEndpointAuthSigningAlg,
+
+		RawAuthorizationSignedResponseAlg: cr.RawAuthorizationSignedResponseAlg,
+
+		RawUserInfoEncryptedResponseAlg: cr.RawUserInfoEncryptedResponseAlg,
+		RawUserInfoEncryptedResponseEnc: cr.RawUserInfoEncryptedResponseEnc,
+
+		PostLogoutRedirectURIs: cr.PostLogoutRedirectURIs,
+
+		BackChannelLogoutURI:             cr.BackChannelLogoutURI,
+		BackChannelLogoutSessionRequired: cr.BackChannelLogoutSessionRequired,
+
+		FrontChannelLogoutURI:             cr.FrontChannelLogoutURI,
+		FrontChannelLogoutSessionRequired: cr.FrontChannelLogoutSessionRequired,
+
+		RequirePushedAuthorizationRequests: cr.RequirePushedAuthorizationRequests,
+
+		SubjectType:         cr.SubjectType,
+		SectorIdentifierURI: cr.SectorIdentifierURI,
+
+		TLSClientAuthSubjectDN:                cr.TLSClientAuthSubjectDN,
+		TLSClientAuthSANDNS:                   cr.TLSClientAuthSANDNS,
+		TLSClientAuthSANURI:                   cr.TLSClientAuthSANURI,
+		TLSClientAuthSANIP:                    cr.TLSClientAuthSANIP,
+		TLSClientAuthSANEmail:                 cr.TLSClientAuthSANEmail,
+		TLSClientCertificateBoundAccessTokens: cr.TLSClientCertificateBoundAccessTokens,
+
+		JWKS: cr.JWKS,
+	}
+
+	if cr.JWKS != nil {
+		rawJWKS, err := json.Marshal(cr.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode client registration jwks: %v", err)
+		}
+		crr.RawJWKS = rawJWKS
+	}
+
+	return crr, nil
 }
 
 // DecodeClientRegistrationRequest returns a ClientRegistrationRequest holding
@@ -209,12 +295,37 @@ func (crr *ClientRegistrationRequest) Validate() error {
 			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unknown id_token_signed_response_alg")
 		}
 	}
+	if crr.RawAuthorizationSignedResponseAlg != "" {
+		alg := jwt.GetSigningMethod(crr.RawAuthorizationSignedResponseAlg)
+		if alg == nil {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unknown authorization_signed_response_alg")
+		}
+	}
 	if crr.RawUserInfoSignedResponseAlg != "" {
 		alg := jwt.GetSigningMethod(crr.RawUserInfoSignedResponseAlg)
 		if alg == nil {
 			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unknown userinfo_signed_response_alg")
 		}
 	}
+	if crr.RawUserInfoEncryptedResponseAlg != "" {
+		if !konnectoidc.IsSupportedEncryptionAlg(crr.RawUserInfoEncryptedResponseAlg) {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported userinfo_encrypted_response_alg")
+		}
+		if crr.JWKS == nil || len(crr.JWKS.Keys) == 0 {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "userinfo_encrypted_response_alg requires jwks")
+		}
+		if crr.RawUserInfoEncryptedResponseEnc == "" {
+			crr.RawUserInfoEncryptedResponseEnc = konnectoidc.EncryptionEncDefault
+		}
+	}
+	if crr.RawUserInfoEncryptedResponseEnc != "" {
+		if crr.RawUserInfoEncryptedResponseAlg == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "userinfo_encrypted_response_enc requires userinfo_encrypted_response_alg")
+		}
+		if !konnectoidc.IsSupportedEncryptionEnc(crr.RawUserInfoEncryptedResponseEnc) {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported userinfo_encrypted_response_enc")
+		}
+	}
 	if crr.RawRequestObjectSigningAlg != "" {
 		alg := jwt.GetSigningMethod(crr.RawRequestObjectSigningAlg)
 		if alg == nil {
@@ -228,6 +339,28 @@ func (crr *ClientRegistrationRequest) Validate() error {
 		switch crr.RawTokenEndpointAuthMethod {
 		case oidc.AuthMethodClientSecretBasic:
 			// breaks
+		case konnectoidc.AuthMethodClientSecretPost:
+			// breaks
+		case konnectoidc.AuthMethodPrivateKeyJWT:
+			if crr.JWKS == nil || len(crr.JWKS.Keys) == 0 {
+				return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "private_key_jwt requires jwks")
+			}
+		case konnectoidc.AuthMethodTLSClientAuth:
+			// Exactly one of the subject metadata values must be set, see
+			// https://tools.ietf.org/html/rfc8705#section-2.1.2
+			count := 0
+			for _, value := range []string{crr.TLSClientAuthSubjectDN, crr.TLSClientAuthSANDNS, crr.TLSClientAuthSANURI, crr.TLSClientAuthSANIP, crr.TLSClientAuthSANEmail} {
+				if value != "" {
+					count++
+				}
+			}
+			if count != 1 {
+				return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "tls_client_auth requires exactly one tls_client_auth subject value")
+			}
+		case konnectoidc.AuthMethodSelfSignedTLSClientAuth:
+			if crr.JWKS == nil || len(crr.JWKS.Keys) == 0 {
+				return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "self_signed_tls_client_auth requires jwks")
+			}
 		case oidc.AuthMethodNone:
 			// breaks
 		default:
@@ -248,23 +381,54 @@ func (crr *ClientRegistrationRequest) Validate() error {
 		}
 	}
 
+	if crr.BackChannelLogoutURI != "" {
+		// See https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRegistration
+		uri, err := url.Parse(crr.BackChannelLogoutURI)
+		if err != nil || !uri.IsAbs() || uri.Fragment != "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "invalid backchannel_logout_uri")
+		}
+	}
+	if crr.FrontChannelLogoutURI != "" {
+		// See https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPLogout
+		uri, err := url.Parse(crr.FrontChannelLogoutURI)
+		if err != nil || !uri.IsAbs() || uri.Fragment != "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "invalid frontchannel_logout_uri")
+		}
+	}
+
+	switch crr.SubjectType {
+	case "", oidc.SubjectIDPublic:
+		// breaks
+	case oidc.SubjectIDPairwise:
+		// breaks
+	default:
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported subject_type")
+	}
+	if crr.SectorIdentifierURI != "" {
+		// See https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+		uri, err := url.Parse(crr.SectorIdentifierURI)
+		if err != nil || uri.Scheme != "https" || uri.Host == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "invalid sector_identifier_uri")
+		}
+	}
+
 	if crr.JWKS != nil {
 		if len(crr.JWKS.Keys) == 0 {
 			crr.JWKS = nil
 		} else {
 			enc := false
-			empty := true
+			unset := false
 			for _, key := range crr.JWKS.Keys {
 				switch key.Use {
 				case "":
 					if enc {
 						return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "jwks includes enc key and unset use key")
 					}
-					empty = true
+					unset = true
 					key.Use = "sig"
 				case "enc":
 					enc = true
-					if empty {
+					if unset {
 						return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "jwks includes enc key and unset use key")
 					}
 				}
@@ -283,6 +447,7 @@ func (crr *ClientRegistrationRequest) ClientRegistration() (*clients.ClientRegis
 		Name:            crr.ClientName,
 		URI:             crr.ClientURI,
 		GrantTypes:      crr.GrantTypes,
+		ResponseTypes:   crr.ResponseTypes,
 		ApplicationType: crr.ApplicationType,
 
 		RedirectURIs: crr.RedirectURIs,
@@ -295,7 +460,30 @@ func (crr *ClientRegistrationRequest) ClientRegistration() (*clients.ClientRegis
 		RawTokenEndpointAuthMethod:     crr.RawTokenEndpointAuthMethod,
 		RawTokenEndpointAuthSigningAlg: crr.RawTokenEndpointAuthSigningAlg,
 
+		RawAuthorizationSignedResponseAlg: crr.RawAuthorizationSignedResponseAlg,
+
+		RawUserInfoEncryptedResponseAlg: crr.RawUserInfoEncryptedResponseAlg,
+		RawUserInfoEncryptedResponseEnc: crr.RawUserInfoEncryptedResponseEnc,
+
 		PostLogoutRedirectURIs: crr.PostLogoutRedirectURIs,
+
+		BackChannelLogoutURI:             crr.BackChannelLogoutURI,
+		BackChannelLogoutSessionRequired: crr.BackChannelLogoutSessionRequired,
+
+		FrontChannelLogoutURI:             crr.FrontChannelLogoutURI,
+		FrontChannelLogoutSessionRequired: crr.FrontChannelLogoutSessionRequired,
+
+		RequirePushedAuthorizationRequests: crr.RequirePushedAuthorizationRequests,
+
+		SubjectType:         crr.SubjectType,
+		SectorIdentifierURI: crr.SectorIdentifierURI,
+
+		TLSClientAuthSubjectDN:                crr.TLSClientAuthSubjectDN,
+		TLSClientAuthSANDNS:                   crr.TLSClientAuthSANDNS,
+		TLSClientAuthSANURI:                   crr.TLSClientAuthSANURI,
+		TLSClientAuthSANIP:                    crr.TLSClientAuthSANIP,
+		TLSClientAuthSANEmail:                 crr.TLSClientAuthSANEmail,
+		TLSClientCertificateBoundAccessTokens: crr.TLSClientCertificateBoundAccessTokens,
 	}
 
 	return cr, nil
@@ -311,6 +499,11 @@ type ClientRegistrationResponse struct {
 	ClientIDIssuedAt      int64 `json:"client_id_issued_at,omitempty"`
 	ClientSecretExpiresAt int64 `json:"client_secret_expires_at"`
 
+	// Client configuration endpoint as specified at
+	// https://tools.ietf.org/html/rfc7592#section-3
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+
 	// Include validated request data.
 	ClientRegistrationRequest
 }
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"testing"
+
+	"github.com/mendsley/gojwk"
+)
+
+func TestClientRegistrationRequestValidateJWKSUse(t *testing.T) {
+	tests := []struct {
+		name  string
+		uses  []string
+		valid bool
+	}{
+		{"unset", []string{""}, true},
+		{"sig", []string{"sig"}, true},
+		{"enc", []string{"enc"}, true},
+		{"sig and enc", []string{"sig", "enc"}, true},
+		{"enc and sig", []string{"enc", "sig"}, true},
+		{"unset and enc", []string{"", "enc"}, false},
+		{"enc and unset", []string{"enc", ""}, false},
+	}
+	for _, test := range tests {
+		jwks := &gojwk.Key{}
+		for _, use := range test.uses {
+			jwks.Keys = append(jwks.Keys, &gojwk.Key{Kty: "EC", Use: use})
+		}
+		crr := &ClientRegistrationRequest{
+			RedirectURIs: []string{"https://client.example.com/cb"},
+			JWKS:         jwks,
+		}
+		err := crr.Validate()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got valid %v want %v: %v", test.name, valid, test.valid, err)
+		}
+	}
+}
+
+func TestClientRegistrationRequestValidateFrontChannelLogoutURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"", true},
+		{"https://client.example.com/logout", true},
+		{"https://client.example.com/logout?client=1", true},
+		{"/logout", false},
+		{"https://client.example.com/logout#fragment", false},
+	}
+	for _, test := range tests {
+		crr := &ClientRegistrationRequest{
+			RedirectURIs:          []string{"https://client.example.com/cb"},
+			FrontChannelLogoutURI: test.uri,
+		}
+		err := crr.Validate()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got valid %v want %v: %v", test.uri, valid, test.valid, err)
+		}
+		if err == nil {
+			cr, err := crr.ClientRegistration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cr.FrontChannelLogoutURI != test.uri {
+				t.Errorf("%s: got registration frontchannel_logout_uri %v", test.uri, cr.FrontChannelLogoutURI)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ValidateResourceIndicators returns error if one of the provided resource
+// indicators is not an absolute URI without fragment as specified at
+// https://tools.ietf.org/html/rfc8707#section-2.
+func ValidateResourceIndicators(resources []string) error {
+	for _, resource := range resources {
+		uri, err := url.Parse(resource)
+		if err != nil || !uri.IsAbs() || uri.Fragment != "" {
+			return fmt.Errorf("invalid resource value")
+		}
+	}
+
+	return nil
+}
@@ -18,7 +18,6 @@
 package payload
 
 import (
-	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -45,11 +44,26 @@ type TokenRequest struct {
 	ClientID     string `schema:"client_id"`
 	ClientSecret string `schema:"client_secret"`
 
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+
 	CodeVerifier string `schema:"code_verifier"`
 
+	DeviceCode string `schema:"device_code"`
+
+	SubjectToken       string   `schema:"subject_token"`
+	SubjectTokenType   string   `schema:"subject_token_type"`
+	ActorToken         string   `schema:"actor_token"`
+	ActorTokenType     string   `schema:"actor_token_type"`
+	RequestedTokenType string   `schema:"requested_token_type"`
+	Audience           string   `schema:"audience"`
+	Resources          []string `schema:"resource"`
+
 	RedirectURI  *url.URL        `schema:"-"`
 	RefreshToken *jwt.Token      `schema:"-"`
 	Scopes       map[string]bool `schema:"-"`
+
+	ClientAuthMethod string `schema:"-"`
 }
 
 // DecodeTokenRequest return a TokenRequest holding the provided
@@ -60,31 +74,12 @@ func DecodeTokenRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*T
 		return nil, err
 	}
 
-	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
-	switch auth[0] {
-	case "Basic":
-		if len(auth) != 2 {
-			return nil, fmt.Errorf("invalid Basic authorization header format")
-		}
-		var basic []byte
-		if basic, err = base64.StdEncoding.DecodeString(auth[1]); err != nil {
-			return nil, err
-		}
-		// Split client id and secret.
-		check := strings.SplitN(string(basic), ":", 2)
-		// Data is encoded application/x-www-form-urlencoded UTF-8. See
-		// https://tools.ietf.org/html/rfc6749#appendix-B for details.
-		tr.ClientID, err = url.QueryUnescape(check[0])
-		if err != nil {
-			return nil, err
-		}
-		tr.ClientSecret, err = url.QueryUnescape(check[1])
-		if err != nil {
-			return nil, err
-		}
+	tr.ClientAuthMethod, err = decodeClientCredentials(req, &tr.ClientID, &tr.ClientSecret, tr.ClientAssertion != "" || tr.ClientAssertionType != "")
+	if err != nil {
+		return nil, err
 	}
 
-	return tr, err
+	return tr, nil
 }
 
 // NewTokenRequest returns a TokenRequest holding the provided url values.
@@ -113,9 +108,37 @@ func NewTokenRequest(values url.Values, providerMetadata *oidc.WellKnown) (*Toke
 
 // Validate validates the request data of the accociated token request.
 func (tr *TokenRequest) Validate(keyFunc jwt.Keyfunc, claims jwt.Claims) error {
+	if err := ValidateResourceIndicators(tr.Resources); err != nil {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+	}
+
 	switch tr.GrantType {
 	case oidc.GrantTypeAuthorizationCode:
 		// breaks
+	case konnectoidc.GrantTypeClientCredentials:
+		// breaks
+	case konnectoidc.GrantTypeDeviceCode:
+		if tr.DeviceCode == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing device_code")
+		}
+		// breaks
+	case konnectoidc.GrantTypeTokenExchange:
+		if tr.SubjectToken == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing subject_token")
+		}
+		if !isSupportedTokenTypeIdentifier(tr.SubjectTokenType) {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "unsupported subject_token_type value")
+		}
+		if tr.ActorToken != "" && !isSupportedTokenTypeIdentifier(tr.ActorTokenType) {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "unsupported actor_token_type value")
+		}
+		if tr.ActorToken == "" && tr.ActorTokenType != "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "actor_token_type without actor_token")
+		}
+		if tr.RequestedTokenType != "" && !isSupportedTokenTypeIdentifier(tr.RequestedTokenType) {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, "unsupported requested_token_type value")
+		}
+		// breaks
 	case oidc.GrantTypeRefreshToken:
 		if tr.RawRefreshToken != "" {
 			refreshToken, err := jwt.ParseWithClaims(tr.RawRefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
@@ -139,6 +162,19 @@ func (tr *TokenRequest) Validate(keyFunc jwt.Keyfunc, claims jwt.Claims) error {
 	return nil
 }
 
+// isSupportedTokenTypeIdentifier returns true if the provided token type
+// identifier refers to a token type which is accepted for token exchange.
+func isSupportedTokenTypeIdentifier(tokenType string) bool {
+	switch tokenType {
+	case konnectoidc.TokenTypeIdentifierAccessToken:
+		return true
+	case konnectoidc.TokenTypeIdentifierJWT:
+		return true
+	}
+
+	return false
+}
+
 // TokenSuccess holds the outgoing data for a successful OpenID
 // Connect 1.0 token request as specified at
 // http://openid.net/specs/openid-connect-core-1_0.html#TokenResponse.
@@ -148,4 +184,7 @@ type TokenSuccess struct {
 	IDToken      string `json:"id_token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"stash.kopano.io/kgol/rndm"
+
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+	"stash.kopano.io/kc/konnect/oidc/session"
+)
+
+const (
+	backChannelLogoutTimeout       = 10 * time.Second
+	backChannelLogoutRetries       = 3
+	backChannelLogoutRetryDelay    = 5 * time.Second
+	backChannelLogoutTokenDuration = 2 * time.Minute
+)
+
+// trackSessionClient remembers that the provided client received tokens for
+// the provided session, so it can be notified when the session ends. Only
+// clients which registered a back-channel or front-channel logout URI are
+// tracked.
+func (p *Provider) trackSessionClient(ctx context.Context, session *payload.Session, clientID string, auth identity.AuthRecord) error {
+	if session == nil {
+		return nil
+	}
+
+	registration, _ := p.clients.Get(ctx, clientID)
+	if registration == nil || (registration.BackChannelLogoutURI == "" && registration.FrontChannelLogoutURI == "") {
+		return nil
+	}
+
+	publicSubject, err := p.PublicSubjectFromAuth(ctx, auth, clientID)
+	if err != nil {
+		return err
+	}
+
+	return p.sessionManager.Add(session.ID, logonSessionIDFromAuth(auth), clientID, publicSubject)
+}
+
+// endLogonSession notifies all clients of the session in which the logon
+// session with the provided ID was used, when that logon session is revoked
+// at the identity manager.
+func (p *Provider) endLogonSession(ctx context.Context, logonSessionID string) error {
+	if record, found := p.sessionManager.PopLogonSession(logonSessionID); found {
+		p.backChannelLogout(ctx, record)
+	}
+
+	return nil
+}
+
+// logonSessionIDFromAuth returns the ID of the logon session with which the
+// user of the provided auth record signed in, if any.
+func logonSessionIDFromAuth(auth identity.AuthRecord) string {
+	if userWithLogonSession, ok := auth.User().(identity.UserWithLogonSession); ok {
+		return userWithLogonSession.LogonSessionID()
+	}
+
+	return ""
+}
+
+// backChannelLogout notifies all clients of the provided session record as
+// specified at https://openid.net/specs/openid-connect-backchannel-1_0.html.
+// Notifications are delivered in the background.
+func (p *Provider) backChannelLogout(ctx context.Context, record *session.Record) {
+	for clientID, sub := range record.Clients {
+		registration, _ := p.clients.Get(ctx, clientID)
+		if registration == nil || registration.BackChannelLogoutURI == "" {
+			continue
+		}
+
+		go func(registration *clients.ClientRegistration, sub string, sid string) {
+			logger := p.logger.WithFields(logrus.Fields{
+				"client_id": registration.ID,
+				"uri":       registration.BackChannelLogoutURI,
+			})
+
+			// NOTE(longsleep): Use a new context, since delivery continues
+			// after the request which triggered it is done.
+			err := p.sendBackChannelLogout(context.Background(), registration, sub, sid)
+			if err != nil {
+				logger.WithError(err).Warnln("back-channel logout failed")
+				return
+			}
+			logger.Debugln("back-channel logout delivered")
+		}(registration, sub, record.ID)
+	}
+}
+
+// sendBackChannelLogout creates a logout token for the provided client
+// registration and POSTs it to the client's back-channel logout URI, retrying
+// on failure.
+func (p *Provider) sendBackChannelLogout(ctx context.Context, registration *clients.ClientRegistration, sub string, sid string) error {
+	now := time.Now()
+	claims := &konnectoidc.LogoutTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    p.issuerIdentifier,
+			Subject:   sub,
+			Audience:  registration.ID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(backChannelLogoutTokenDuration).Unix(),
+			Id:        rndm.GenerateRandomString(32),
+		},
+		Events: map[string]struct{}{
+			konnectoidc.LogoutTokenEventBackChannelLogout: {},
+		},
+		SessionClaims: &konnectoidc.SessionClaims{
+			SessionID: sid,
+		},
+	}
+
+	logoutToken, err := p.makeJWT(ctx, jwt.GetSigningMethod(registration.RawIDTokenSignedResponseAlg), claims)
+	if err != nil {
+		return err
+	}
+	body := url.Values{
+		"logout_token": []string{logoutToken},
+	}.Encode()
+
+	for attempt := 1; ; attempt++ {
+		err = p.postBackChannelLogout(ctx, registration.BackChannelLogoutURI, body)
+		if err == nil || attempt >= backChannelLogoutRetries {
+			break
+		}
+		p.logger.WithError(err).WithField("client_id", registration.ID).Debugln("back-channel logout attempt failed, retrying")
+
+		select {
+		case <-time.After(backChannelLogoutRetryDelay * time.Duration(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+func (p *Provider) postBackChannelLogout(ctx context.Context, uri string, body string) error {
+	req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	default:
+		return fmt.Errorf("unexpected response status: %d", response.StatusCode)
+	}
+}
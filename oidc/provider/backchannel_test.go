@@ -0,0 +1,93 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+)
+
+func TestEndLogonSessionBackChannelLogout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	logoutTokens := make(chan string, 1)
+	rpServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		logoutTokens <- req.PostForm.Get("logout_token")
+	}))
+	defer rpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                   "backchannelclient",
+		RedirectURIs:         []string{"https://backchannel.example.com/cb"},
+		BackChannelLogoutURI: rpServer.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := newTestAuthRecord(provider)
+	auth.SetUser(&testUser{id: "unittestuser", logonSessionID: "logonsession"})
+	session := &payload.Session{
+		Version: sessionVersion,
+		ID:      "session",
+		Sub:     auth.Subject(),
+	}
+	err = provider.trackSessionClient(ctx, session, "backchannelclient", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		logonSessionID string
+		notified       bool
+	}{
+		{"other", false},
+		{"logonsession", true},
+		{"logonsession", false},
+	}
+	for _, test := range tests {
+		err = provider.endLogonSession(ctx, test.logonSessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case logoutToken := <-logoutTokens:
+			if !test.notified {
+				t.Errorf("%s: unexpected back-channel logout", test.logonSessionID)
+			} else if logoutToken == "" {
+				t.Errorf("%s: back-channel logout without logout_token", test.logonSessionID)
+			}
+		case <-time.After(500 * time.Millisecond):
+			if test.notified {
+				t.Errorf("%s: expected back-channel logout", test.logonSessionID)
+			}
+		}
+	}
+}
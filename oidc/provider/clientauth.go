@@ -0,0 +1,196 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+)
+
+// validateClientAssertion validates the provided JWT client assertion as
+// specified at https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+// and returns the matching client registration together with the client
+// authentication method which was used. If clientID is not empty, the
+// assertion must be issued by that client.
+func (p *Provider) validateClientAssertion(ctx context.Context, clientID string, assertionType string, assertion string) (*clients.ClientRegistration, string, error) {
+	if assertionType != konnectoidc.ClientAssertionTypeJWTBearer {
+		return nil, "", fmt.Errorf("unsupported client_assertion_type")
+	}
+	if assertion == "" {
+		return nil, "", fmt.Errorf("missing client_assertion")
+	}
+
+	var registration *clients.ClientRegistration
+	var authMethod string
+	claims := &payload.ClientAssertionClaims{}
+	_, err := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		if clientID != "" && claims.Subject != clientID {
+			return nil, fmt.Errorf("client_id mismatch")
+		}
+		registration, _ = p.clients.Get(ctx, claims.Subject)
+		if registration == nil {
+			return nil, fmt.Errorf("unknown client")
+		}
+		if registration.RawTokenEndpointAuthSigningAlg != "" && token.Method.Alg() != registration.RawTokenEndpointAuthSigningAlg {
+			return nil, fmt.Errorf("token alg does not match client registration")
+		}
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			// Shared secret, only possible with clients which have their
+			// secret registered in clear text.
+			authMethod = konnectoidc.AuthMethodClientSecretJWT
+			if registration.Dynamic || registration.Secret == "" {
+				return nil, fmt.Errorf("no client secret registered")
+			}
+			return []byte(registration.Secret), nil
+
+		default:
+			if token.Method == jwt.SigningMethodNone {
+				return nil, fmt.Errorf("unsigned client assertion")
+			}
+			authMethod = konnectoidc.AuthMethodPrivateKeyJWT
+			if registration.JWKS == nil {
+				return nil, fmt.Errorf("no client keys registered")
+			}
+			secureClient, secureErr := registration.Secure(token.Header[oidc.JWTHeaderKeyID])
+			if secureErr != nil {
+				return nil, secureErr
+			}
+			return secureClient.PublicKey, nil
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The audience must identify us, either by issuer or by the endpoint which
+	// received the assertion.
+	if !claims.Audience.Contains(p.issuerIdentifier) &&
+		!claims.Audience.Contains(p.makeIssURL(p.tokenPath)) &&
+		!(p.introspectionPath != "" && claims.Audience.Contains(p.makeIssURL(p.introspectionPath))) &&
+		!(p.revocationPath != "" && claims.Audience.Contains(p.makeIssURL(p.revocationPath))) &&
+		!(p.deviceAuthorizationPath != "" && claims.Audience.Contains(p.makeIssURL(p.deviceAuthorizationPath))) &&
+		!(p.pushedAuthorizationRequestPath != "" && claims.Audience.Contains(p.makeIssURL(p.pushedAuthorizationRequestPath))) {
+		return nil, "", fmt.Errorf("invalid aud claim")
+	}
+
+	// Client assertions must only be used once. Remember the jti until the
+	// assertion expires.
+	jti := fmt.Sprintf("client_assertion:%s:%s", claims.Subject, claims.Id)
+	if !p.replayCache.Use(jti, time.Unix(claims.ExpiresAt, 0)) {
+		return nil, "", fmt.Errorf("client_assertion jti has already been used")
+	}
+
+	return registration, authMethod, nil
+}
+
+// authenticateClient authenticates the client of the provided request with
+// the provided credentials, either by JWT client assertion, by TLS client
+// certificate or by client secret, and enforces the client authentication
+// method of the client registration. It returns the details of the
+// authenticated client together with the client authentication method which
+// was used. All returned errors are OAuth2 invalid_client errors.
+func (p *Provider) authenticateClient(req *http.Request, clientID string, clientSecret string, clientAuthMethod string, assertionType string, assertion string, redirectURI *url.URL) (*clients.Details, string, error) {
+	withoutSecret := false
+
+	// Client authentication with JWT client assertion.
+	if assertion != "" || assertionType != "" {
+		registration, authMethod, err := p.validateClientAssertion(req.Context(), clientID, assertionType, assertion)
+		if err != nil {
+			return nil, "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+		}
+		clientID = registration.ID
+		clientAuthMethod = authMethod
+		withoutSecret = true
+	}
+
+	// Client authentication with TLS client certificate as specified at
+	// https://tools.ietf.org/html/rfc8705#section-2.
+	if clientSecret == "" && assertion == "" {
+		if certificates := p.getClientCertificates(req); len(certificates) > 0 {
+			authMethod, err := p.validateClientCertificates(req.Context(), clientID, certificates)
+			if err != nil {
+				return nil, "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+			}
+			if authMethod != "" {
+				clientAuthMethod = authMethod
+				withoutSecret = true
+			}
+		}
+	}
+
+	clientDetails, err := p.clients.Lookup(req.Context(), clientID, clientSecret, redirectURI, "", withoutSecret)
+	if err != nil {
+		return nil, "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+	}
+	// Enforce the registered client authentication method.
+	if clientDetails.Registration != nil && !isRegisteredClientAuthMethod(clientDetails.Registration.RawTokenEndpointAuthMethod, clientAuthMethod) {
+		return nil, "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client authentication method mismatch")
+	}
+
+	return clientDetails, clientAuthMethod, nil
+}
+
+// isClientAuthMethodWithoutSecret returns true if the provided client
+// authentication method authenticates clients without their client secret.
+func isClientAuthMethodWithoutSecret(authMethod string) bool {
+	switch authMethod {
+	case konnectoidc.AuthMethodPrivateKeyJWT, konnectoidc.AuthMethodClientSecretJWT:
+		return true
+	case konnectoidc.AuthMethodTLSClientAuth, konnectoidc.AuthMethodSelfSignedTLSClientAuth:
+		return true
+	}
+
+	return false
+}
+
+// isTLSClientAuthMethod returns true if the provided client authentication
+// method is one of the mutual TLS methods.
+func isTLSClientAuthMethod(authMethod string) bool {
+	return authMethod == konnectoidc.AuthMethodTLSClientAuth || authMethod == konnectoidc.AuthMethodSelfSignedTLSClientAuth
+}
+
+// isRegisteredClientAuthMethod returns true if the provided client
+// authentication method which was used in a request is allowed for the
+// provided registered method. The secret based methods client_secret_basic
+// and client_secret_post are treated as equivalent, since the registration
+// defaults to client_secret_basic and existing clients might post their
+// secret in the request body.
+func isRegisteredClientAuthMethod(registered string, used string) bool {
+	if registered == "" || registered == used {
+		return true
+	}
+
+	switch registered {
+	case oidc.AuthMethodClientSecretBasic, konnectoidc.AuthMethodClientSecretPost:
+		return used == oidc.AuthMethodClientSecretBasic || used == konnectoidc.AuthMethodClientSecretPost
+	}
+
+	return false
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mendsley/gojwk"
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+)
+
+func TestIsRegisteredClientAuthMethod(t *testing.T) {
+	tests := []struct {
+		registered string
+		used       string
+		expected   bool
+	}{
+		{"", oidc.AuthMethodClientSecretBasic, true},
+		{"", konnectoidc.AuthMethodPrivateKeyJWT, true},
+		{oidc.AuthMethodClientSecretBasic, oidc.AuthMethodClientSecretBasic, true},
+		{oidc.AuthMethodClientSecretBasic, konnectoidc.AuthMethodClientSecretPost, true},
+		{konnectoidc.AuthMethodClientSecretPost, oidc.AuthMethodClientSecretBasic, true},
+		{oidc.AuthMethodClientSecretBasic, konnectoidc.AuthMethodPrivateKeyJWT, false},
+		{oidc.AuthMethodClientSecretBasic, oidc.AuthMethodNone, false},
+		{konnectoidc.AuthMethodPrivateKeyJWT, oidc.AuthMethodClientSecretBasic, false},
+		{konnectoidc.AuthMethodTLSClientAuth, konnectoidc.AuthMethodClientSecretPost, false},
+		{konnectoidc.AuthMethodTLSClientAuth, konnectoidc.AuthMethodTLSClientAuth, true},
+	}
+
+	for _, test := range tests {
+		if ok := isRegisteredClientAuthMethod(test.registered, test.used); ok != test.expected {
+			t.Errorf("registered %q used %q: got %v want %v", test.registered, test.used, ok, test.expected)
+		}
+	}
+}
+
+func TestTokenEndpointClientSecretAuthMethods(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	registration, _ := provider.clients.Get(ctx, testClientID)
+
+	tests := []struct {
+		registered string
+		basic      bool
+		status     int
+	}{
+		{oidc.AuthMethodClientSecretBasic, true, http.StatusOK},
+		{oidc.AuthMethodClientSecretBasic, false, http.StatusOK},
+		{konnectoidc.AuthMethodClientSecretPost, true, http.StatusOK},
+		{konnectoidc.AuthMethodClientSecretPost, false, http.StatusOK},
+		{konnectoidc.AuthMethodPrivateKeyJWT, false, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		registration.RawTokenEndpointAuthMethod = test.registered
+
+		values := refreshTokenValues(makeTestUserRefreshToken(ctx, t, provider))
+		if test.basic {
+			values.Del("client_secret")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/konnect/v1/token", strings.NewReader(values.Encode()))
+		if test.basic {
+			req.SetBasicAuth(testClientID, testClientSecret)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != test.status {
+			t.Errorf("registered %q basic %v: got status %v want %v: %s", test.registered, test.basic, rr.Code, test.status, rr.Body.String())
+		}
+	}
+}
+
+func makeTestClientAssertion(t *testing.T, p *Provider, jti string) string {
+	claims := &payload.ClientAssertionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    testClientID,
+			Subject:   testClientID,
+			Id:        jti,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+		Audience: payload.AudienceList{p.issuerIdentifier},
+	}
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testClientSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return assertion
+}
+
+func registerTestPrivateKeyJWTClient(t *testing.T, p *Provider, clientID string, secret string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.clients.Register(&clients.ClientRegistration{
+		ID:           clientID,
+		Secret:       secret,
+		RedirectURIs: []string{"https://key.example.com/cb"},
+		JWKS: &gojwk.Key{
+			Keys: []*gojwk.Key{{
+				Kty: "EC",
+				Crv: "P-256",
+				X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+				Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+			}},
+		},
+		RawTokenEndpointAuthMethod: konnectoidc.AuthMethodPrivateKeyJWT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func makeTestPrivateKeyJWTAssertion(t *testing.T, p *Provider, clientID string, key *ecdsa.PrivateKey, jti string) string {
+	claims := &payload.ClientAssertionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    clientID,
+			Subject:   clientID,
+			Id:        jti,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+		Audience: payload.AudienceList{p.issuerIdentifier},
+	}
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return assertion
+}
+
+func TestValidateClientAssertionReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	tests := []struct {
+		name  string
+		jti   string
+		valid bool
+	}{
+		{"first use", "jti-1", true},
+		{"replay", "jti-1", false},
+		{"other jti", "jti-2", true},
+	}
+	for _, test := range tests {
+		registration, authMethod, err := provider.validateClientAssertion(ctx, testClientID, konnectoidc.ClientAssertionTypeJWTBearer, makeTestClientAssertion(t, provider, test.jti))
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got valid %v want %v: %v", test.name, valid, test.valid, err)
+			continue
+		}
+		if test.valid && (registration.ID != testClientID || authMethod != konnectoidc.AuthMethodClientSecretJWT) {
+			t.Errorf("%s: unexpected client %v with auth method %v", test.name, registration.ID, authMethod)
+		}
+	}
+}
@@ -36,6 +36,15 @@ type Config struct {
 	EndSessionPath         string
 	CheckSessionIframePath string
 	RegistrationPath       string
+	IntrospectionPath      string
+	RevocationPath         string
+
+	DeviceAuthorizationPath string
+	DeviceVerificationURI   string
+
+	PushedAuthorizationRequestPath string
+
+	AuthorizationServerMetadataPaths []string
 
 	BrowserStateCookiePath string
 	BrowserStateCookieName string
@@ -46,4 +55,9 @@ type Config struct {
 	AccessTokenDuration  time.Duration
 	IDTokenDuration      time.Duration
 	RefreshTokenDuration time.Duration
+	RefreshTokenRotation bool
+
+	AccessTokenProfile string
+
+	SignMetadata bool
 }
@@ -0,0 +1,237 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+)
+
+const (
+	dpopProofMaxAge   = 5 * time.Minute
+	dpopProofLeeway   = 1 * time.Minute
+	dpopNonceDuration = 5 * time.Minute
+)
+
+// hasDPoPProof returns true if the provided request includes a DPoP header.
+func hasDPoPProof(req *http.Request) bool {
+	_, ok := req.Header[http.CanonicalHeaderKey(konnectoidc.DPoPHeader)]
+	return ok
+}
+
+// validateDPoPProof validates the DPoP proof of the provided request as
+// specified at https://tools.ietf.org/html/rfc9449#section-4.3 and returns
+// the JWK SHA-256 thumbprint of the key which signed the proof. If the
+// provided access token is not empty, the proof must be bound to it. When the
+// request has no DPoP proof, an empty thumbprint is returned without error.
+func (p *Provider) validateDPoPProof(req *http.Request, accessToken string) (string, error) {
+	values := req.Header[http.CanonicalHeaderKey(konnectoidc.DPoPHeader)]
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		// breaks
+	default:
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "multiple DPoP proofs")
+	}
+
+	var jwk *jose.JSONWebKey
+	claims := &payload.DPoPProofClaims{}
+	_, err := jwt.ParseWithClaims(values[0], claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != konnectoidc.DPoPProofType {
+			return nil, fmt.Errorf("invalid typ header")
+		}
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok || token.Method == jwt.SigningMethodNone {
+			return nil, fmt.Errorf("proof must be signed with an asymmetric algorithm")
+		}
+
+		rawJWK, ok := token.Header["jwk"]
+		if !ok {
+			return nil, fmt.Errorf("missing jwk header")
+		}
+		encodedJWK, jwkErr := json.Marshal(rawJWK)
+		if jwkErr != nil {
+			return nil, jwkErr
+		}
+		jwk = &jose.JSONWebKey{}
+		if jwkErr = jwk.UnmarshalJSON(encodedJWK); jwkErr != nil {
+			return nil, fmt.Errorf("invalid jwk header: %v", jwkErr)
+		}
+		if !jwk.IsPublic() {
+			return nil, fmt.Errorf("jwk header must not contain a private key")
+		}
+
+		return jwk.Key, nil
+	})
+	if err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, err.Error())
+	}
+
+	// Proof must be for the current request.
+	if claims.HTM != req.Method {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "htm mismatch")
+	}
+	if !p.isDPoPTargetURI(req, claims.HTU) {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "htu mismatch")
+	}
+
+	// Proof must be recent.
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	now := time.Now()
+	if issuedAt.After(now.Add(dpopProofLeeway)) || issuedAt.Before(now.Add(-dpopProofMaxAge)) {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "iat out of range")
+	}
+
+	// Proof must be bound to the access token if one is presented.
+	if accessToken != "" {
+		ath := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(ath[:]) {
+			return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "ath mismatch")
+		}
+	}
+
+	// Proof must include a nonce provided by us.
+	if err = p.validateDPoPNonce(claims.Nonce); err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UseDPoPNonce, "DPoP proof requires a valid nonce")
+	}
+
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, err.Error())
+	}
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	// Proofs must only be used once. Remember the jti until the proof is no
+	// longer accepted.
+	jti := fmt.Sprintf("dpop:%s:%s", jkt, claims.Id)
+	if !p.replayCache.Use(jti, issuedAt.Add(dpopProofMaxAge+dpopProofLeeway)) {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "DPoP proof jti has already been used")
+	}
+
+	return jkt, nil
+}
+
+// isDPoPTargetURI returns true if the provided htu value matches the URI of
+// the provided request, ignoring query and fragment.
+func (p *Provider) isDPoPTargetURI(req *http.Request, htu string) bool {
+	target, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	expected, err := url.Parse(p.makeIssURL(req.URL.Path))
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(target.Scheme, expected.Scheme) &&
+		strings.EqualFold(target.Host, expected.Host) &&
+		target.EscapedPath() == expected.EscapedPath()
+}
+
+// validateDPoPConfirmation validates that the access token with the provided
+// claims is presented with the provided authorization scheme as required by
+// its confirmation claim. DPoP bound access tokens require a matching DPoP
+// proof as specified at https://tools.ietf.org/html/rfc9449#section-7.
+func (p *Provider) validateDPoPConfirmation(req *http.Request, scheme string, accessToken string, claims *konnect.AccessTokenClaims) error {
+	if claims.Confirmation == nil || claims.Confirmation.JKT == "" {
+		if scheme == konnectoidc.TokenTypeDPoP {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "access token is not DPoP bound")
+		}
+		return nil
+	}
+	if scheme != konnectoidc.TokenTypeDPoP {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "DPoP bound access token requires DPoP authorization")
+	}
+
+	jkt, err := p.validateDPoPProof(req, accessToken)
+	if err != nil {
+		return err
+	}
+	if jkt == "" {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "missing DPoP proof")
+	}
+	if jkt != claims.Confirmation.JKT {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "DPoP proof key does not match access token")
+	}
+
+	return nil
+}
+
+// makeDPoPNonce creates a new DPoP nonce. Nonces are the encrypted time of
+// their creation, so they can be validated without keeping state.
+func (p *Provider) makeDPoPNonce() (string, error) {
+	ciphertext, err := p.encryptionManager.Encrypt([]byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// validateDPoPNonce returns error if the provided DPoP nonce was not created
+// by us or has expired.
+func (p *Provider) validateDPoPNonce(nonce string) error {
+	if nonce == "" {
+		return fmt.Errorf("missing nonce")
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil {
+		return err
+	}
+	plaintext, err := p.encryptionManager.Decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	created, err := strconv.ParseInt(string(plaintext), 10, 64)
+	if err != nil {
+		return err
+	}
+	if time.Unix(created, 0).Add(dpopNonceDuration).Before(time.Now()) {
+		return fmt.Errorf("nonce expired")
+	}
+
+	return nil
+}
+
+// setDPoPNonce sets a new DPoP nonce as header to the provided
+// http.ResponseWriter as specified at https://tools.ietf.org/html/rfc9449#section-8.
+func (p *Provider) setDPoPNonce(rw http.ResponseWriter) {
+	nonce, err := p.makeDPoPNonce()
+	if err != nil {
+		p.logger.WithError(err).Warnln("failed to create DPoP nonce")
+		return
+	}
+
+	rw.Header().Set(konnectoidc.DPoPNonceHeader, nonce)
+}
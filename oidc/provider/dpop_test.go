@@ -0,0 +1,108 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+)
+
+func makeTestDPoPProof(t *testing.T, key *ecdsa.PrivateKey, method string, htu string, jti string, nonce string) string {
+	claims := &payload.DPoPProofClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:       jti,
+			IssuedAt: time.Now().Unix(),
+		},
+		HTM:   method,
+		HTU:   htu,
+		Nonce: nonce,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = konnectoidc.DPoPProofType
+	token.Header["jwk"] = &jose.JSONWebKey{Key: &key.PublicKey}
+
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return proof
+}
+
+func TestValidateDPoPProofReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, cfg := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = provider.encryptionManager.SetKey(make([]byte, provider.encryptionManager.GetKeySize())); err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := provider.makeDPoPNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	htu := provider.makeIssURL(cfg.TokenPath)
+
+	tests := []struct {
+		name  string
+		key   *ecdsa.PrivateKey
+		jti   string
+		nonce string
+		valid bool
+	}{
+		{"first use", key, "jti-1", nonce, true},
+		{"replay", key, "jti-1", nonce, false},
+		{"other jti", key, "jti-2", nonce, true},
+		{"same jti other key", otherKey, "jti-1", nonce, true},
+		{"missing nonce", key, "jti-3", "", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, cfg.TokenPath, nil)
+		req.Header.Set(konnectoidc.DPoPHeader, makeTestDPoPProof(t, test.key, http.MethodPost, htu, test.jti, test.nonce))
+
+		jkt, err := provider.validateDPoPProof(req, "")
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got valid %v want %v: %v", test.name, valid, test.valid, err)
+		}
+		if test.valid && jkt == "" {
+			t.Errorf("%s: missing jkt", test.name)
+		}
+	}
+}
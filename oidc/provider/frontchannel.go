@@ -0,0 +1,91 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"stash.kopano.io/kgol/rndm"
+
+	"stash.kopano.io/kc/konnect/oidc/session"
+)
+
+// frontChannelLogoutURIs returns the front-channel logout URIs of all clients
+// of the provided session record as specified at
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPLogout.
+func (p *Provider) frontChannelLogoutURIs(ctx context.Context, record *session.Record) []*url.URL {
+	var uris []*url.URL
+
+	for clientID := range record.Clients {
+		registration, _ := p.clients.Get(ctx, clientID)
+		if registration == nil || registration.FrontChannelLogoutURI == "" {
+			continue
+		}
+
+		uri, err := url.Parse(registration.FrontChannelLogoutURI)
+		if err != nil {
+			p.logger.WithError(err).WithField("client_id", clientID).Warnln("invalid front-channel logout uri")
+			continue
+		}
+		query := uri.Query()
+		query.Set("iss", p.issuerIdentifier)
+		query.Set("sid", record.ID)
+		uri.RawQuery = query.Encode()
+
+		uris = append(uris, uri)
+	}
+
+	return uris
+}
+
+// FrontChannelLogoutPage writes a HTML page to the provided
+// http.ResponseWriter which loads the provided front-channel logout URIs and
+// continues to the provided continue URI afterwards if not empty.
+func (p *Provider) FrontChannelLogoutPage(rw http.ResponseWriter, uris []*url.URL, continueURI string) {
+	nonce := rndm.GenerateRandomString(32)
+
+	frameSources := make([]string, 0, len(uris))
+	logoutURIs := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		frameSources = append(frameSources, fmt.Sprintf("%s://%s", uri.Scheme, uri.Host))
+		logoutURIs = append(logoutURIs, uri.String())
+	}
+
+	addResponseHeaders(rw.Header())
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("X-XSS-Protection", "1; mode=block")
+	rw.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; script-src 'nonce-%s'; frame-src %s", nonce, strings.Join(uniqueStrings(frameSources), " ")))
+
+	data := struct {
+		LogoutURIs  []string
+		ContinueURI string
+		Nonce       string
+	}{
+		LogoutURIs:  logoutURIs,
+		ContinueURI: continueURI,
+		Nonce:       nonce,
+	}
+	err := frontChannelLogoutTemplate.Execute(rw, data)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to write to response")
+	}
+}
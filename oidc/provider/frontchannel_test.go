@@ -0,0 +1,141 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+	"stash.kopano.io/kc/konnect/oidc/payload"
+)
+
+func TestEndSessionFrontChannelLogout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if !provider.metadata.FrontChannelLogoutSupported || !provider.metadata.FrontChannelLogoutSessionSupported {
+		t.Errorf("front-channel logout is not advertised")
+	}
+
+	provider.sessionCookieName = "__Secure-KKT"
+	if err := provider.encryptionManager.SetKey(bytes.Repeat([]byte{0x42}, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:                    "frontchannelclient",
+			RedirectURIs:          []string{"https://frontchannel.example.com/cb"},
+			FrontChannelLogoutURI: "https://frontchannel.example.com/logout?client=1",
+		},
+		{
+			ID:           "otherclient",
+			RedirectURIs: []string{"https://other.example.com/cb"},
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auth := newTestAuthRecord(provider)
+	auth.SetUser(&testUser{id: "unittestuser", logonSessionID: "logonsession"})
+	session := &payload.Session{
+		Version:  sessionVersion,
+		ID:       "session",
+		Sub:      auth.Subject(),
+		Provider: auth.Manager().Name(),
+	}
+	for _, clientID := range []string{"frontchannelclient", "otherclient"} {
+		if err := provider.trackSessionClient(ctx, session, clientID, auth); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serialized, err := provider.serializeSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endSession := func(values url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/konnect/v1/endsession?"+values.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: provider.sessionCookieName, Value: serialized})
+		rr := httptest.NewRecorder()
+		provider.EndSessionHandler(rr, req)
+		return rr
+	}
+
+	rr := endSession(url.Values{
+		"post_logout_redirect_uri": {"https://frontchannel.example.com/bye"},
+		"state":                    {"test-state"},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("got content type %v want text/html", contentType)
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-src https://frontchannel.example.com") {
+		t.Errorf("content security policy does not allow the logout frame: %v", csp)
+	}
+
+	body := rr.Body.String()
+	if count := strings.Count(body, "<iframe"); count != 1 {
+		t.Fatalf("got %d logout frames want 1: %s", count, body)
+	}
+	marker := `<iframe hidden src="`
+	src := body[strings.Index(body, marker)+len(marker):]
+	src = strings.Replace(src[:strings.Index(src, `"`)], "&amp;", "&", -1)
+	logoutURI, err := url.Parse(src)
+	if err != nil {
+		t.Fatalf("invalid logout frame uri: %v", err)
+	}
+	if logoutURI.Host != "frontchannel.example.com" || logoutURI.Path != "/logout" {
+		t.Errorf("logout frame uri got %v want the registered frontchannel_logout_uri", logoutURI)
+	}
+	query := logoutURI.Query()
+	if query.Get("client") != "1" {
+		t.Errorf("logout frame uri lost its query: %v", logoutURI)
+	}
+	if query.Get("iss") != provider.issuerIdentifier {
+		t.Errorf("logout frame iss got %v want %v", query.Get("iss"), provider.issuerIdentifier)
+	}
+	if query.Get("sid") != session.ID {
+		t.Errorf("logout frame sid got %v want %v", query.Get("sid"), session.ID)
+	}
+	if !strings.Contains(body, "https://frontchannel.example.com/bye?state=test-state") {
+		t.Errorf("page does not continue to the post logout redirect uri: %s", body)
+	}
+
+	// The session has ended, so its clients are not notified again.
+	rr = endSession(url.Values{})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("repeated: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "<iframe") {
+		t.Errorf("repeated: unexpected logout frames: %s", rr.Body.String())
+	}
+}
@@ -19,9 +19,13 @@ package provider
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	jwk "github.com/mendsley/gojwk"
@@ -34,7 +38,10 @@ import (
 	"stash.kopano.io/kc/konnect/identity/clients"
 	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 	"stash.kopano.io/kc/konnect/oidc/code"
+	"stash.kopano.io/kc/konnect/oidc/device"
+	"stash.kopano.io/kc/konnect/oidc/par"
 	"stash.kopano.io/kc/konnect/oidc/payload"
+	"stash.kopano.io/kc/konnect/oidc/refresh"
 	"stash.kopano.io/kc/konnect/signing"
 	"stash.kopano.io/kc/konnect/utils"
 )
@@ -45,6 +52,8 @@ const (
 
 // WellKnownHandler implements the HTTP provider configuration endpoint
 // for OpenID Connect 1.0 as specified at https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+// and the OAuth 2.0 authorization server metadata endpoint as specified at
+// https://tools.ietf.org/html/rfc8414#section-3.
 func (p *Provider) WellKnownHandler(rw http.ResponseWriter, req *http.Request) {
 	// TODO(longsleep): Add caching headers.
 	wellKnown := p.metadata
@@ -89,7 +98,10 @@ func (p *Provider) JwksHandler(rw http.ResponseWriter, req *http.Request) {
 // http://openid.net/specs/openid-connect-core-1_0.html#ImplicitFlowAuth
 func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 	var err error
+	var ar *payload.AuthenticationRequest
 	var auth identity.AuthRecord
+	var pushedRequestURI string
+	var registration *clients.ClientRegistration
 
 	addResponseHeaders(rw.Header())
 
@@ -102,51 +114,53 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ar, err := payload.DecodeAuthenticationRequest(req, p.metadata, func(token *jwt.Token) (interface{}, error) {
-		if claims, ok := token.Claims.(*payload.RequestObjectClaims); ok {
-			// Validate signed request tokens according to spec defined at
-			// https://openid.net/specs/openid-connect-core-1_0.html#SignedRequestObject
-			registration, _ := p.clients.Get(req.Context(), claims.ClientID)
-			if registration != nil {
-				if registration.RawRequestObjectSigningAlg != "" {
-					if token.Method.Alg() != registration.RawRequestObjectSigningAlg {
-						return nil, fmt.Errorf("token alg does not match client registration")
-					}
-				}
-				if token.Method == jwt.SigningMethodNone {
-					// Request parameters do not need to be signed to be valid, so
-					// none is allowed in this special case.
-					return jwt.UnsafeAllowNoneSignatureType, nil
-				}
-				// Get secure client.
-				if registration.JWKS != nil {
-					secureClient, err := registration.Secure(token.Header[oidc.JWTHeaderKeyID])
-					if err != nil {
-						return nil, err
-					}
-					if err := claims.SetSecure(secureClient); err != nil {
-						return nil, err
-					}
-					return secureClient.PublicKey, err
-				}
-				return nil, fmt.Errorf("no client keys registered")
-			} else {
-				// Also allow, when client is not registered and the token is unsigned.
-				if token.Method == jwt.SigningMethodNone {
-					// Request parameters do not need to be signed to be valid, so
-					// none is allowed in this special case.
-					return jwt.UnsafeAllowNoneSignatureType, nil
-				}
-			}
+	// Resolve pushed authorization requests as specified at
+	// https://tools.ietf.org/html/rfc9126#section-4.
+	if requestURI := req.Form.Get("request_uri"); strings.HasPrefix(requestURI, konnectoidc.RequestURIPrefixPushedAuthorizationRequest) {
+		// Request URIs are one time use.
+		record, found := p.parManager.Pop(requestURI)
+		if !found || record.ClientID != req.Form.Get("client_id") {
+			p.logger.Debugln("authorize request with invalid pushed authorization request_uri")
+			p.ErrorPage(rw, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidRequest, "invalid request_uri")
+			return
+		}
+		// Continue with a new request URI, since sign-in and consent get
+		// redirected back here afterwards.
+		pushedRequestURI, err = p.parManager.Create(&par.Record{
+			ClientID: record.ClientID,
+			Values:   record.Values,
+			Used:     true,
+		})
+		if err != nil {
+			p.logger.WithError(err).Errorln("authorize request failed to store pushed authorization request")
+			p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+			return
 		}
+		req.Form = record.Values
+		// Keep the pushed parameters in the query, so they are available to
+		// sign-in and consent.
+		query := url.Values{}
+		for key, value := range record.Values {
+			query[key] = value
+		}
+		query.Set("request_uri", pushedRequestURI)
+		req.URL.RawQuery = query.Encode()
+	}
 
-		return nil, fmt.Errorf("not validated")
-	})
+	ar, err = payload.DecodeAuthenticationRequest(req, p.metadata.WellKnown, p.requestObjectKeyFunc(req.Context()))
 	if err != nil {
 		p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("authorize request invalid request data")
 		p.ErrorPage(rw, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		return
 	}
+
+	// Enforce pushed authorization requests when required by the client.
+	registration, _ = p.clients.Get(req.Context(), ar.ClientID)
+	if registration != nil && registration.RequirePushedAuthorizationRequests && pushedRequestURI == "" {
+		err = ar.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "pushed authorization request required")
+		goto done
+	}
+
 	err = ar.Validate(func(token *jwt.Token) (interface{}, error) {
 		// Validator for incoming IDToken hints, looks up key.
 		return p.validateJWT(token)
@@ -155,6 +169,16 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		goto done
 	}
 
+	// Requested resources must be allowed for the client as specified at
+	// https://tools.ietf.org/html/rfc8707#section-2.
+	if resourcesErr := validateClientResources(registration, ar.Resources); resourcesErr != nil {
+		err = ar.NewBadRequest(konnectoidc.ErrorCodeOAuth2InvalidTarget, resourcesErr.Error())
+		goto done
+	}
+
+	// Compare subjects as presented to the client.
+	ar.SetPublicSubjectFunc(p.publicSubjectFunc(req.Context(), ar.ClientID))
+
 	// Find session if any, ignoring errors.
 	ar.Session, err = p.getSession(req)
 	if err != nil {
@@ -173,7 +197,12 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		// Validate sub claim request
 		// https://openid.net/specs/openid-connect-core-1_0.html#ImplicitValidation
 		if subRequest, ok := ar.Claims.IDToken.Get(oidc.SubjectIdentifierClaim); ok {
-			if !subRequest.Match(auth.Subject()) {
+			publicSubject, subjectErr := p.PublicSubjectFromAuth(req.Context(), auth, ar.ClientID)
+			if subjectErr != nil {
+				err = subjectErr
+				goto done
+			}
+			if !subRequest.Match(publicSubject) {
 				err = ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, "sub claim request mismatch")
 				goto done
 			}
@@ -188,9 +217,60 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 
 done:
+	if pushedRequestURI != "" {
+		if _, isHandled := err.(*identity.IsHandledError); !isHandled {
+			// The continued request URI is only needed while the end-user is
+			// redirected for sign-in or consent.
+			p.parManager.Remove(pushedRequestURI)
+		}
+	}
 	p.AuthorizeResponse(rw, req, ar, auth, err)
 }
 
+// requestObjectKeyFunc returns a jwt.Keyfunc which validates signed request
+// objects of authentication requests according to spec defined at
+// https://openid.net/specs/openid-connect-core-1_0.html#SignedRequestObject
+func (p *Provider) requestObjectKeyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if claims, ok := token.Claims.(*payload.RequestObjectClaims); ok {
+			registration, _ := p.clients.Get(ctx, claims.ClientID)
+			if registration != nil {
+				if registration.RawRequestObjectSigningAlg != "" {
+					if token.Method.Alg() != registration.RawRequestObjectSigningAlg {
+						return nil, fmt.Errorf("token alg does not match client registration")
+					}
+				}
+				if token.Method == jwt.SigningMethodNone {
+					// Request parameters do not need to be signed to be valid, so
+					// none is allowed in this special case.
+					return jwt.UnsafeAllowNoneSignatureType, nil
+				}
+				// Get secure client.
+				if registration.JWKS != nil {
+					secureClient, err := registration.Secure(token.Header[oidc.JWTHeaderKeyID])
+					if err != nil {
+						return nil, err
+					}
+					if err := claims.SetSecure(secureClient); err != nil {
+						return nil, err
+					}
+					return secureClient.PublicKey, err
+				}
+				return nil, fmt.Errorf("no client keys registered")
+			} else {
+				// Also allow, when client is not registered and the token is unsigned.
+				if token.Method == jwt.SigningMethodNone {
+					// Request parameters do not need to be signed to be valid, so
+					// none is allowed in this special case.
+					return jwt.UnsafeAllowNoneSignatureType, nil
+				}
+			}
+		}
+
+		return nil, fmt.Errorf("not validated")
+	}
+}
+
 // AuthorizeResponse writes the result according to the provided parameters to
 // the provided http.ResponseWriter.
 func (p *Provider) AuthorizeResponse(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest, auth identity.AuthRecord, err error) {
@@ -215,6 +295,12 @@ func (p *Provider) AuthorizeResponse(rw http.ResponseWriter, req *http.Request,
 
 	authorizedScopes = auth.AuthorizedScopes()
 
+	// Remember client of session for back-channel logout.
+	err = p.trackSessionClient(ctx, session, ar.ClientID, auth)
+	if err != nil {
+		goto done
+	}
+
 	// Create code when requested.
 	if _, ok := ar.ResponseTypes[oidc.ResponseTypeCode]; ok {
 		codeString, err = p.codeManager.Create(&code.Record{
@@ -229,7 +315,7 @@ func (p *Provider) AuthorizeResponse(rw http.ResponseWriter, req *http.Request,
 
 	// Create access token when requested.
 	if _, ok := ar.ResponseTypes[oidc.ResponseTypeToken]; ok {
-		accessTokenString, err = p.makeAccessToken(ctx, ar.ClientID, auth, nil)
+		accessTokenString, err = p.makeAccessToken(ctx, ar.ClientID, ar.Resources, auth, nil, nil, nil)
 		if err != nil {
 			goto done
 		}
@@ -258,7 +344,7 @@ done:
 	if err != nil {
 		switch err.(type) {
 		case *payload.AuthenticationError:
-			p.Found(rw, ar.RedirectURI, err, ar.UseFragment)
+			p.writeAuthorizeResponse(rw, req, ar, err)
 		case *payload.AuthenticationBadRequest:
 			p.ErrorPage(rw, http.StatusBadRequest, err.Error(), err.(*payload.AuthenticationBadRequest).Description())
 		case *identity.RedirectError:
@@ -269,7 +355,7 @@ done:
 			// do nothing
 		case *konnectoidc.OAuth2Error:
 			err = ar.NewError(err.Error(), err.(*konnectoidc.OAuth2Error).Description())
-			p.Found(rw, ar.RedirectURI, err, ar.UseFragment)
+			p.writeAuthorizeResponse(rw, req, ar, err)
 		default:
 			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("authorize request failed")
 			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
@@ -305,7 +391,32 @@ done:
 		response.IDToken = idTokenString
 	}
 
-	p.Found(rw, ar.RedirectURI, response, ar.UseFragment)
+	p.writeAuthorizeResponse(rw, req, ar, response)
+}
+
+// writeAuthorizeResponse delivers the provided authorize response params to
+// the redirect URI of the provided authentication request, using the
+// requested response mode.
+func (p *Provider) writeAuthorizeResponse(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest, params interface{}) {
+	if ar.UseJWT {
+		// JWT Secured Authorization Response Mode as specified at
+		// https://openid.net/specs/oauth-v2-jarm.html
+		response, err := p.makeAuthorizeResponseJWT(req.Context(), ar, params)
+		if err != nil {
+			p.logger.WithError(err).Errorln("failed to create authorize response JWT")
+			p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		params = &payload.AuthenticationJWTResponse{
+			Response: response,
+		}
+	}
+
+	if ar.UseFormPost {
+		p.FormPost(rw, ar.RedirectURI, params)
+		return
+	}
+	p.Found(rw, ar.RedirectURI, params, ar.UseFragment)
 }
 
 // TokenHandler implements the HTTP token endpoint for OpenID
@@ -323,6 +434,14 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 	var approvedScopes map[string]bool
 	var authorizedScopes map[string]bool
 	var clientDetails *clients.Details
+	var resources []string
+	var authorizedResources []string
+	var actor *konnect.ActorClaims
+	var refreshTokenClaims *konnect.RefreshTokenClaims
+	var confirmation *konnect.ConfirmationClaims
+	var dpopJKT string
+	var clientCertificates []*x509.Certificate
+	var clientCertificateAuth bool
 	signinMethod := p.signingMethodDefault
 
 	rw.Header().Set("Cache-Control", "no-store")
@@ -337,6 +456,19 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 		goto done
 	}
 
+	// Validate DPoP proof to bind issued tokens to the proof key as specified
+	// at https://tools.ietf.org/html/rfc9449#section-5
+	if hasDPoPProof(req) {
+		p.setDPoPNonce(rw)
+		dpopJKT, err = p.validateDPoPProof(req, "")
+		if err != nil {
+			goto done
+		}
+		confirmation = &konnect.ConfirmationClaims{
+			JKT: dpopJKT,
+		}
+	}
+
 	// Token Request Validation
 	// http://openid.net/specs/openid-connect-core-1_0.html#TokenRequestValidation
 	err = req.ParseForm()
@@ -344,7 +476,7 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		goto done
 	}
-	tr, err = payload.DecodeTokenRequest(req, p.metadata)
+	tr, err = payload.DecodeTokenRequest(req, p.metadata.WellKnown)
 	if err != nil {
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		goto done
@@ -359,15 +491,30 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	// Additional validations according to https://tools.ietf.org/html/rfc6749#section-4.1.3
-	clientDetails, err = p.clients.Lookup(req.Context(), tr.ClientID, tr.ClientSecret, tr.RedirectURI, "", false)
+	clientDetails, tr.ClientAuthMethod, err = p.authenticateClient(req, tr.ClientID, tr.ClientSecret, tr.ClientAuthMethod, tr.ClientAssertionType, tr.ClientAssertion, tr.RedirectURI)
 	if err != nil {
-		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2AccessDenied, err.Error())
 		goto done
 	}
-	if clientDetails != nil && clientDetails.Registration != nil {
+	tr.ClientID = clientDetails.ID
+	clientCertificates = p.getClientCertificates(req)
+	clientCertificateAuth = isTLSClientAuthMethod(tr.ClientAuthMethod)
+	if clientDetails.Registration != nil {
 		signinMethod = jwt.GetSigningMethod(clientDetails.Registration.RawIDTokenSignedResponseAlg)
 	}
 
+	// Bind issued tokens to the TLS client certificate as specified at
+	// https://tools.ietf.org/html/rfc8705#section-3.
+	if clientCertificateAuth || (clientDetails.Registration != nil && clientDetails.Registration.TLSClientCertificateBoundAccessTokens) {
+		if len(clientCertificates) == 0 {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "TLS client certificate required")
+			goto done
+		}
+		if confirmation == nil {
+			confirmation = &konnect.ConfirmationClaims{}
+		}
+		confirmation.X5TS256 = makeCertificateThumbprint(clientCertificates[0])
+	}
+
 	switch tr.GrantType {
 	case oidc.GrantTypeAuthorizationCode:
 		codeRecord, codeRecordFound := p.codeManager.Pop(tr.Code)
@@ -402,6 +549,15 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 			}
 		}
 
+		// Select resources from the authorized resources as specified at
+		// https://tools.ietf.org/html/rfc8707#section-2.2.
+		authorizedResources = ar.Resources
+		resources, err = selectResources(tr.Resources, authorizedResources)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+			goto done
+		}
+
 	case oidc.GrantTypeRefreshToken:
 		if tr.RefreshToken == nil {
 			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "missing refresh_token")
@@ -417,9 +573,28 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 			goto done
 		}
 
+		// Ensure that the refresh token has not been revoked.
+		if p.isRefreshTokenRevoked(claims) {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "refresh token has been revoked")
+			goto done
+		}
+
+		// Ensure that DPoP bound refresh tokens are used with the same key as
+		// specified at https://tools.ietf.org/html/rfc9449#section-5.
+		if claims.Confirmation != nil && claims.Confirmation.JKT != "" && claims.Confirmation.JKT != dpopJKT {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "DPoP proof key does not match refresh token")
+			goto done
+		}
+		// Ensure that certificate bound refresh tokens are used with the same
+		// TLS client certificate.
+		if claims.Confirmation != nil && claims.Confirmation.X5TS256 != "" && (confirmation == nil || claims.Confirmation.X5TS256 != confirmation.X5TS256) {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "TLS client certificate does not match refresh token")
+			goto done
+		}
+
 		// TODO(longsleep): Compare standard claims issuer.
 
-		userID, sessionRef := p.getUserIDAndSessionRefFromClaims(&claims.StandardClaims, claims.IdentityClaims)
+		userID, sessionRef := p.getUserIDAndSessionRefFromClaims(claims.Audience, claims.IdentityClaims)
 		if userID == "" {
 			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "missing data in kc.identity claim")
 			goto done
@@ -427,13 +602,19 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 
 		ctx := konnect.NewClaimsContext(req.Context(), claims)
 
-		currentIdentityManager, err := p.getIdentityManagerFromClaims(claims.IdentityProvider, claims.IdentityClaims)
-		if err != nil {
+		currentIdentityManager, managerErr := p.getIdentityManagerFromClaims(claims.IdentityProvider, claims.IdentityClaims)
+		if managerErr != nil {
+			err = managerErr
 			goto done
 		}
 
-		// Lookup Ref values from backend.
-		approvedScopes, err = currentIdentityManager.ApprovedScopes(ctx, claims.Subject, tr.ClientID, claims.Ref)
+		// Lookup consent ref values from backend. Refresh tokens issued
+		// before consents were recorded only have their ref.
+		consentRef := claims.ConsentRef
+		if consentRef == "" {
+			consentRef = claims.Ref
+		}
+		approvedScopes, err = currentIdentityManager.ApprovedScopes(ctx, claims.Subject, tr.ClientID, consentRef)
 		if err != nil {
 			goto done
 		}
@@ -457,95 +638,775 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 					authorizedScopes[scope] = true
 				}
 			}
-		} else {
-			// Authorize all approved scopes when no scopes are in request.
-			authorizedScopes = approvedScopes
+		} else {
+			// Authorize all approved scopes when no scopes are in request.
+			authorizedScopes = approvedScopes
+		}
+
+		// Load user record from identitymanager, without any scopes or claims.
+		auth, found, err = currentIdentityManager.Fetch(ctx, userID, sessionRef, nil, nil)
+		if !found {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "user not found")
+			goto done
+		}
+		if err != nil {
+			goto done
+		}
+		// Add authorized scopes.
+		auth.AuthorizeScopes(authorizedScopes)
+		// Add authorized claims from request.
+		auth.AuthorizeClaims(claims.ApprovedClaimsRequest)
+
+		if p.refreshTokenRotation {
+			// Ensure that the refresh token is the current token of its family,
+			// revoke all tokens of the family if it is not. Refresh tokens
+			// without family were issued while rotation was not enabled and
+			// start a new family when rotated.
+			if claims.FamilyID != "" {
+				switch rotateErr := p.refreshManager.Rotate(claims.FamilyID, claims.Id); rotateErr {
+				case nil:
+					// breaks
+				case refresh.ErrNotFound:
+					err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "refresh token family unknown")
+					goto done
+				case refresh.ErrReused:
+					p.logger.WithFields(logrus.Fields{
+						"client_id": tr.ClientID,
+						"family":    claims.FamilyID,
+					}).Warnln("refresh token reuse detected, revoking token family")
+					err = p.revocationManager.Revoke(claims.FamilyID, time.Now().Add(p.refreshTokenDuration))
+					if err != nil {
+						goto done
+					}
+					err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "refresh token has been revoked")
+					goto done
+				default:
+					err = rotateErr
+					goto done
+				}
+			}
+			refreshTokenClaims = claims
+		}
+
+		// Select resources from the resources authorized with the refresh
+		// token as specified at https://tools.ietf.org/html/rfc8707#section-2.2.
+		authorizedResources = claims.ResourcesList
+		resources, err = selectResources(tr.Resources, authorizedResources)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+			goto done
+		}
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: claims.Audience,
+		}
+
+	case konnectoidc.GrantTypeClientCredentials:
+		// Client Credentials Grant as specified at https://tools.ietf.org/html/rfc6749#section-4.4
+		// is only available for confidential clients from the registry. Clients
+		// which authenticate without a secret are confidential as well.
+		if clientDetails.Registration == nil || clientDetails.Registration.Dynamic || (!isClientAuthMethodWithoutSecret(tr.ClientAuthMethod) && clientDetails.Registration.Secret == "") {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "client_credentials grant requires a confidential client")
+			goto done
+		}
+
+		allowedScopes := make(map[string]bool)
+		for _, scope := range clientDetails.Registration.AllowedScopes {
+			allowedScopes[scope] = true
+		}
+		if len(tr.Scopes) > 0 {
+			// Make sure all requested scopes are allowed for the client.
+			authorizedScopes = make(map[string]bool)
+			for scope := range tr.Scopes {
+				if !allowedScopes[scope] {
+					err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidScope, "scope not allowed for client")
+					goto done
+				} else {
+					authorizedScopes[scope] = true
+				}
+			}
+		} else {
+			// Authorize all allowed scopes when no scopes are in request.
+			authorizedScopes = allowedScopes
+		}
+
+		// Requested resources must be allowed for the client.
+		err = validateClientResources(clientDetails.Registration, tr.Resources)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+			goto done
+		}
+		resources = tr.Resources
+
+		// The client acts on its own behalf, so the token has no user.
+		auth = identity.NewAuthRecord(nil, tr.ClientID, authorizedScopes, nil, nil)
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: tr.ClientID,
+		}
+
+	case konnectoidc.GrantTypeDeviceCode:
+		if p.deviceAuthorizationPath == "" {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2UnsupportedGrantType, "grant_type value not supported")
+			goto done
+		}
+
+		// Device Access Token Request as specified at https://tools.ietf.org/html/rfc8628#section-3.4
+		deviceRecord, pollErr := p.deviceManager.Poll(tr.DeviceCode)
+		switch pollErr {
+		case nil:
+			// breaks
+		case device.ErrAuthorizationPending:
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2AuthorizationPending, "authorization pending")
+			goto done
+		case device.ErrSlowDown:
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2SlowDown, "polling too fast")
+			goto done
+		case device.ErrDenied:
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2AccessDenied, "authorization denied")
+			goto done
+		case device.ErrExpired:
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2ExpiredToken, "device_code expired")
+			goto done
+		case device.ErrNotFound:
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "device_code not found")
+			goto done
+		default:
+			err = pollErr
+			goto done
+		}
+
+		// Ensure that the device code was issued to the client id.
+		if deviceRecord.ClientID != tr.ClientID {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "client_id mismatch")
+			goto done
+		}
+
+		auth = deviceRecord.Auth
+		authorizedScopes = auth.AuthorizedScopes()
+
+		// Requested resources must be allowed for the client.
+		err = validateClientResources(clientDetails.Registration, tr.Resources)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+			goto done
+		}
+		authorizedResources = tr.Resources
+		resources = tr.Resources
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: deviceRecord.ClientID,
+			Scopes:   deviceRecord.Scopes,
+		}
+
+	case konnectoidc.GrantTypeTokenExchange:
+		// Token Exchange as specified at https://tools.ietf.org/html/rfc8693
+		// is only available for confidential clients from the registry. Clients
+		// which authenticate without a secret are confidential as well.
+		if clientDetails.Registration == nil || clientDetails.Registration.Dynamic || (!isClientAuthMethodWithoutSecret(tr.ClientAuthMethod) && clientDetails.Registration.Secret == "") {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "token exchange requires a confidential client")
+			goto done
+		}
+
+		// Only access tokens issued by us are accepted as subject token.
+		subjectClaims, parseErr := p.parseAccessToken(tr.SubjectToken)
+		if parseErr != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid subject_token")
+			goto done
+		}
+		if p.revocationManager.IsRevoked(subjectClaims.Id) {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "subject_token has been revoked")
+			goto done
+		}
+
+		// Select target audience, either from audience or resource.
+		switch {
+		case len(tr.Resources) > 1 || (tr.Audience != "" && len(tr.Resources) == 1 && tr.Audience != tr.Resources[0]):
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, "multiple targets are not supported")
+			goto done
+		case tr.Audience != "":
+			resources = []string{tr.Audience}
+		case len(tr.Resources) == 1:
+			resources = tr.Resources
+		}
+		// Target audience must be allowed for the client.
+		err = validateClientResources(clientDetails.Registration, resources)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+			goto done
+		}
+
+		// Make sure the exchanged token never has broader scopes than the
+		// subject token.
+		subjectScopes := subjectClaims.AuthorizedScopes()
+		if len(tr.Scopes) > 0 {
+			authorizedScopes = make(map[string]bool)
+			for scope := range tr.Scopes {
+				if !subjectScopes[scope] {
+					err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidScope, "scope exceeds subject_token scope")
+					goto done
+				} else {
+					authorizedScopes[scope] = true
+				}
+			}
+		} else {
+			authorizedScopes = subjectScopes
+		}
+
+		// Identify the acting party, defaulting to the client.
+		actor = &konnect.ActorClaims{
+			Subject:  tr.ClientID,
+			ClientID: tr.ClientID,
+		}
+		if tr.ActorToken != "" {
+			actorClaims, actorParseErr := p.parseAccessToken(tr.ActorToken)
+			if actorParseErr != nil {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid actor_token")
+				goto done
+			}
+			if p.revocationManager.IsRevoked(actorClaims.Id) {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "actor_token has been revoked")
+				goto done
+			}
+			actor = &konnect.ActorClaims{
+				Subject:  actorClaims.Subject,
+				ClientID: actorClaims.AuthorizedClientID(),
+			}
+		}
+		// Keep delegation chain of the subject token.
+		actor.Actor = subjectClaims.Actor
+
+		if subjectClaims.IdentityClaims == nil {
+			// Subject token has no user (client credentials), so the new
+			// token has none either.
+			auth = identity.NewAuthRecord(nil, subjectClaims.Subject, authorizedScopes, nil, nil)
+		} else {
+			userID, sessionRef := p.getUserIDAndSessionRefFromClaims(subjectClaims.AuthorizedClientID(), subjectClaims.IdentityClaims)
+			if userID == "" {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "missing data in kc.identity claim")
+				goto done
+			}
+
+			ctx := konnect.NewClaimsContext(req.Context(), subjectClaims)
+
+			currentIdentityManager, managerErr := p.getIdentityManagerFromClaims(subjectClaims.IdentityProvider, subjectClaims.IdentityClaims)
+			if managerErr != nil {
+				err = managerErr
+				goto done
+			}
+
+			// Load user record from identitymanager, without any scopes or claims.
+			auth, found, err = currentIdentityManager.Fetch(ctx, userID, sessionRef, nil, nil)
+			if !found {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "user not found")
+				goto done
+			}
+			if err != nil {
+				goto done
+			}
+			// Add authorized scopes.
+			auth.AuthorizeScopes(authorizedScopes)
+			// Add authorized claims from subject token.
+			auth.AuthorizeClaims(subjectClaims.AuthorizedClaimsRequest)
+		}
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: tr.ClientID,
+		}
+
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2UnsupportedGrantType, "grant_type value not implemented")
+		goto done
+	}
+
+	// Create access token.
+	accessTokenString, err = p.makeAccessToken(req.Context(), ar.ClientID, resources, auth, actor, confirmation, signinMethod)
+	if err != nil {
+		goto done
+	}
+
+	switch tr.GrantType {
+	case oidc.GrantTypeAuthorizationCode:
+		// Create ID token when not previously requested.
+		if !ar.ResponseTypes[oidc.ResponseTypeIDToken] {
+			idTokenString, err = p.makeIDToken(req.Context(), ar, auth, session, accessTokenString, "", signinMethod)
+			if err != nil {
+				goto done
+			}
+		}
+
+		// Create refresh token when granted.
+		if authorizedScopes[oidc.ScopeOfflineAccess] {
+			refreshTokenString, err = p.makeRefreshToken(req.Context(), ar.ClientID, authorizedResources, auth, confirmation, nil)
+			if err != nil {
+				goto done
+			}
+		}
+
+	case oidc.GrantTypeRefreshToken:
+		// Create new refresh token for the same grant when rotating.
+		if refreshTokenClaims != nil {
+			refreshTokenString, err = p.rotateRefreshToken(req.Context(), refreshTokenClaims, nil)
+			if err != nil {
+				goto done
+			}
+		}
+
+	case konnectoidc.GrantTypeDeviceCode:
+		// Create ID token when requested and authorized.
+		if authorizedScopes[oidc.ScopeOpenID] {
+			idTokenString, err = p.makeIDToken(req.Context(), ar, auth, nil, accessTokenString, "", signinMethod)
+			if err != nil {
+				goto done
+			}
+		}
+
+		// Create refresh token when granted.
+		if authorizedScopes[oidc.ScopeOfflineAccess] {
+			refreshTokenString, err = p.makeRefreshToken(req.Context(), ar.ClientID, authorizedResources, auth, confirmation, nil)
+			if err != nil {
+				goto done
+			}
+		}
+	}
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			status := http.StatusBadRequest
+			if konnectoidc.IsErrorWithID(err, konnectoidc.ErrorCodeOAuth2InvalidClient) {
+				// Unauthorized as specified at https://tools.ietf.org/html/rfc6749#section-5.2
+				status = http.StatusUnauthorized
+				if tr != nil && tr.ClientAuthMethod == oidc.AuthMethodClientSecretBasic {
+					rw.Header().Set("WWW-Authenticate", "Basic")
+				}
+			}
+			err = utils.WriteJSON(rw, status, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("token request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("token request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	// Successful Token Response
+	// http://openid.net/specs/openid-connect-core-1_0.html#TokenResponse
+	response := &payload.TokenSuccess{}
+	if accessTokenString != "" {
+		response.AccessToken = accessTokenString
+		response.TokenType = oidc.TokenTypeBearer
+		response.ExpiresIn = int64(p.accessTokenDuration.Seconds())
+		if confirmation != nil && confirmation.JKT != "" {
+			response.TokenType = konnectoidc.TokenTypeDPoP
+		}
+	}
+	if idTokenString != "" {
+		response.IDToken = idTokenString
+	}
+	if refreshTokenString != "" {
+		response.RefreshToken = refreshTokenString
+	}
+	switch tr.GrantType {
+	case konnectoidc.GrantTypeClientCredentials:
+		response.Scope = strings.Join(makeArrayFromBoolMap(authorizedScopes), " ")
+	case konnectoidc.GrantTypeTokenExchange:
+		response.Scope = strings.Join(makeArrayFromBoolMap(authorizedScopes), " ")
+		response.IssuedTokenType = konnectoidc.TokenTypeIdentifierAccessToken
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("token request failed writing response")
+	}
+}
+
+// IntrospectionHandler implements the HTTP token introspection endpoint for
+// OAuth 2.0 as specified at https://tools.ietf.org/html/rfc7662
+func (p *Provider) IntrospectionHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var ir *payload.IntrospectionRequest
+	var clientDetails *clients.Details
+	var response *payload.IntrospectionResponse
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	// Introspection Request validation
+	// https://tools.ietf.org/html/rfc7662#section-2.1
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	ir, err = payload.DecodeIntrospectionRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	err = ir.Validate()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	// Only registered clients with credentials are allowed to introspect. They
+	// authenticate the same way as at the token endpoint.
+	clientDetails, ir.ClientAuthMethod, err = p.authenticateClient(req, ir.ClientID, ir.ClientSecret, ir.ClientAuthMethod, ir.ClientAssertionType, ir.ClientAssertion, &url.URL{})
+	if err != nil {
+		goto done
+	}
+	if clientDetails.Registration == nil || (!isClientAuthMethodWithoutSecret(ir.ClientAuthMethod) && clientDetails.Registration.Secret == "") {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client authentication required")
+		goto done
+	}
+
+	response = p.introspectToken(req.Context(), ir.Token, ir.TokenTypeHint)
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			status := http.StatusBadRequest
+			if konnectoidc.IsErrorWithID(err, konnectoidc.ErrorCodeOAuth2InvalidClient) {
+				status = http.StatusUnauthorized
+			}
+			err = utils.WriteJSON(rw, status, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("introspection request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("introspection request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	// Introspection Response
+	// https://tools.ietf.org/html/rfc7662#section-2.2
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("introspection request failed writing response")
+	}
+}
+
+// RevocationHandler implements the HTTP token revocation endpoint for OAuth
+// 2.0 as specified at https://tools.ietf.org/html/rfc7009. Access tokens are
+// not revoked together with their refresh token, see revokeToken.
+func (p *Provider) RevocationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var rr *payload.RevocationRequest
+	var clientDetails *clients.Details
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	// Revocation Request validation
+	// https://tools.ietf.org/html/rfc7009#section-2.1
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	rr, err = payload.DecodeRevocationRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	err = rr.Validate()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	// Authenticate the client like at the token endpoint, public clients are
+	// allowed to revoke their own tokens.
+	clientDetails, rr.ClientAuthMethod, err = p.authenticateClient(req, rr.ClientID, rr.ClientSecret, rr.ClientAuthMethod, rr.ClientAssertionType, rr.ClientAssertion, &url.URL{})
+	if err != nil {
+		goto done
+	}
+
+	err = p.revokeToken(req.Context(), rr.Token, rr.TokenTypeHint, clientDetails.ID)
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			status := http.StatusBadRequest
+			if konnectoidc.IsErrorWithID(err, konnectoidc.ErrorCodeOAuth2InvalidClient) {
+				status = http.StatusUnauthorized
+			}
+			err = utils.WriteJSON(rw, status, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("revocation request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("revocation request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	// Revocation Response
+	// https://tools.ietf.org/html/rfc7009#section-2.2
+	rw.WriteHeader(http.StatusOK)
+}
+
+// DeviceAuthorizationHandler implements the HTTP device authorization endpoint
+// for OAuth 2.0 as specified at https://tools.ietf.org/html/rfc8628#section-3.1
+func (p *Provider) DeviceAuthorizationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var dar *payload.DeviceAuthorizationRequest
+	var clientDetails *clients.Details
+	var record *device.Record
+	var deviceCode string
+	var verificationURIComplete *url.URL
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	// Device Authorization Request validation
+	// https://tools.ietf.org/html/rfc8628#section-3.1
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	dar, err = payload.DecodeDeviceAuthorizationRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	err = dar.Validate()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	// Authenticate the client like at the token endpoint, devices usually are
+	// public clients.
+	clientDetails, dar.ClientAuthMethod, err = p.authenticateClient(req, dar.ClientID, dar.ClientSecret, dar.ClientAuthMethod, dar.ClientAssertionType, dar.ClientAssertion, &url.URL{})
+	if err != nil {
+		goto done
+	}
+
+	record = &device.Record{
+		ClientID: clientDetails.ID,
+		Scopes:   dar.Scopes,
+	}
+	deviceCode, err = p.deviceManager.Create(record)
+	if err != nil {
+		goto done
+	}
+
+	verificationURIComplete, err = url.Parse(p.deviceVerificationURI)
+	if err != nil {
+		goto done
+	}
+	verificationURIComplete.RawQuery = url.Values{
+		"user_code": []string{device.FormatUserCode(record.UserCode)},
+	}.Encode()
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			status := http.StatusBadRequest
+			if konnectoidc.IsErrorWithID(err, konnectoidc.ErrorCodeOAuth2InvalidClient) {
+				status = http.StatusUnauthorized
+			}
+			err = utils.WriteJSON(rw, status, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("device authorization request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("device authorization request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
 		}
 
-		// Load user record from identitymanager, without any scopes or claims.
-		auth, found, err = currentIdentityManager.Fetch(ctx, userID, sessionRef, nil, nil)
-		if !found {
-			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "user not found")
-			goto done
-		}
-		if err != nil {
-			goto done
-		}
-		// Add authorized scopes.
-		auth.AuthorizeScopes(authorizedScopes)
-		// Add authorized claims from request.
-		auth.AuthorizeClaims(claims.ApprovedClaimsRequest)
+		return
+	}
 
-		// Create fake request for token generation.
-		ar = &payload.AuthenticationRequest{
-			ClientID: claims.Audience,
-		}
+	// Device Authorization Response
+	// https://tools.ietf.org/html/rfc8628#section-3.2
+	response := &payload.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                device.FormatUserCode(record.UserCode),
+		VerificationURI:         p.deviceVerificationURI,
+		VerificationURIComplete: verificationURIComplete.String(),
+		ExpiresIn:               int64(time.Until(record.ExpiresAt).Seconds()),
+		Interval:                int64(record.Interval.Seconds()),
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("device authorization request failed writing response")
+	}
+}
+
+// PushedAuthorizationRequestHandler implements the HTTP pushed authorization
+// request endpoint for OAuth 2.0 as specified at https://tools.ietf.org/html/rfc9126
+func (p *Provider) PushedAuthorizationRequestHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var parr *payload.PushedAuthorizationRequest
+	var ar *payload.AuthenticationRequest
+	var clientDetails *clients.Details
+	var record *par.Record
+	var requestURI string
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
 
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
 	default:
-		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2UnsupportedGrantType, "grant_type value not implemented")
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
 		goto done
 	}
 
-	// Create access token.
-	accessTokenString, err = p.makeAccessToken(req.Context(), ar.ClientID, auth, signinMethod)
+	// Pushed Authorization Request validation
+	// https://tools.ietf.org/html/rfc9126#section-2.1
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	parr, err = payload.DecodePushedAuthorizationRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	err = parr.Validate()
 	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		goto done
 	}
 
-	switch tr.GrantType {
-	case oidc.GrantTypeAuthorizationCode:
-		// Create ID token when not previously requested.
-		if !ar.ResponseTypes[oidc.ResponseTypeIDToken] {
-			idTokenString, err = p.makeIDToken(req.Context(), ar, auth, session, accessTokenString, "", signinMethod)
-			if err != nil {
-				goto done
-			}
-		}
+	// Authenticate the client like at the token endpoint, only confidential
+	// clients can push requests.
+	clientDetails, parr.ClientAuthMethod, err = p.authenticateClient(req, parr.ClientID, parr.ClientSecret, parr.ClientAuthMethod, parr.ClientAssertionType, parr.ClientAssertion, &url.URL{})
+	if err != nil {
+		goto done
+	}
+	if clientDetails.Registration == nil || (!isClientAuthMethodWithoutSecret(parr.ClientAuthMethod) && clientDetails.Registration.Secret == "") {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "pushed authorization requests require a confidential client")
+		goto done
+	}
+	// Client ID might have been given via authentication only.
+	parr.ClientID = clientDetails.ID
+	parr.Values.Set("client_id", parr.ClientID)
 
-		// Create refresh token when granted.
-		if authorizedScopes[oidc.ScopeOfflineAccess] {
-			refreshTokenString, err = p.makeRefreshToken(req.Context(), ar.ClientID, auth, nil)
-			if err != nil {
-				goto done
-			}
+	// Validate the pushed parameters like the authorization endpoint does.
+	ar, err = payload.NewAuthenticationRequest(parr.Values, p.metadata.WellKnown, p.requestObjectKeyFunc(req.Context()))
+	if err == nil {
+		err = ar.Validate(func(token *jwt.Token) (interface{}, error) {
+			// Validator for incoming IDToken hints, looks up key.
+			return p.validateJWT(token)
+		})
+	}
+	if err != nil {
+		if errWithDescription, ok := err.(utils.ErrorWithDescription); ok {
+			err = konnectoidc.NewOAuth2Error(errWithDescription.Error(), errWithDescription.Description())
+		} else {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		}
+		goto done
+	}
+	if ar.ClientID != parr.ClientID {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "client_id mismatch")
+		goto done
+	}
+
+	// Validate the redirect URI of the authenticated client.
+	_, err = p.clients.Lookup(req.Context(), parr.ClientID, "", ar.RedirectURI, "", true)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	record = &par.Record{
+		ClientID: parr.ClientID,
+		Values:   parr.Values,
+	}
+	requestURI, err = p.parManager.Create(record)
+	if err != nil {
+		goto done
 	}
 
 done:
 	if err != nil {
 		switch err.(type) {
 		case *konnectoidc.OAuth2Error:
-			err = utils.WriteJSON(rw, http.StatusBadRequest, err, "")
+			status := http.StatusBadRequest
+			if konnectoidc.IsErrorWithID(err, konnectoidc.ErrorCodeOAuth2InvalidClient) {
+				status = http.StatusUnauthorized
+			}
+			err = utils.WriteJSON(rw, status, err, "")
 			if err != nil {
-				p.logger.WithError(err).Errorln("token request failed writing response")
+				p.logger.WithError(err).Errorln("pushed authorization request failed writing response")
 				return
 			}
 		default:
-			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("token request failed")
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("pushed authorization request failed")
 			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
 		}
 
 		return
 	}
 
-	// Successful Token Response
-	// http://openid.net/specs/openid-connect-core-1_0.html#TokenResponse
-	response := &payload.TokenSuccess{}
-	if accessTokenString != "" {
-		response.AccessToken = accessTokenString
-		response.TokenType = oidc.TokenTypeBearer
-		response.ExpiresIn = int64(p.accessTokenDuration.Seconds())
-	}
-	if idTokenString != "" {
-		response.IDToken = idTokenString
-	}
-	if refreshTokenString != "" {
-		response.RefreshToken = refreshTokenString
+	// Pushed Authorization Response
+	// https://tools.ietf.org/html/rfc9126#section-2.2
+	response := &payload.PushedAuthorizationResponse{
+		RequestURI: requestURI,
+		ExpiresIn:  int64(time.Until(record.ExpiresAt).Seconds()),
 	}
 
-	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	err = utils.WriteJSON(rw, http.StatusCreated, response, "")
 	if err != nil {
-		p.logger.WithError(err).Errorln("token request failed writing response")
+		p.logger.WithError(err).Errorln("pushed authorization request failed writing response")
 	}
 }
 
@@ -569,10 +1430,17 @@ func (p *Provider) UserInfoHandler(rw http.ResponseWriter, req *http.Request) {
 	// Parse and validate UserInfo request
 	// https://openid.net/specs/openid-connect-core-1_0.html#UserInfoRequest
 
+	if hasDPoPProof(req) {
+		p.setDPoPNonce(rw)
+	}
 	claims, err := p.GetAccessTokenClaimsFromRequest(req)
 	if err != nil {
 		p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request unauthorized")
-		konnectoidc.WriteWWWAuthenticateError(rw, http.StatusUnauthorized, err)
+		if hasDPoPProof(req) {
+			konnectoidc.WriteWWWAuthenticateErrorWithScheme(rw, http.StatusUnauthorized, konnectoidc.TokenTypeDPoP, err)
+		} else {
+			konnectoidc.WriteWWWAuthenticateError(rw, http.StatusUnauthorized, err)
+		}
 		return
 	}
 
@@ -580,7 +1448,7 @@ func (p *Provider) UserInfoHandler(rw http.ResponseWriter, req *http.Request) {
 	var found bool
 	var requestedClaimsMap []*payload.ClaimsRequestMap
 
-	userID, sessionRef := p.getUserIDAndSessionRefFromClaims(&claims.StandardClaims, claims.IdentityClaims)
+	userID, sessionRef := p.getUserIDAndSessionRefFromClaims(claims.AuthorizedClientID(), claims.IdentityClaims)
 
 	ctx := konnect.NewClaimsContext(req.Context(), claims)
 
@@ -616,7 +1484,7 @@ done:
 		return
 	}
 
-	publicSubject, err := p.PublicSubjectFromAuth(auth)
+	publicSubject, err := p.PublicSubjectFromAuth(req.Context(), auth, claims.AuthorizedClientID())
 	if err != nil {
 		p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to create subject")
 		p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
@@ -694,28 +1562,52 @@ done:
 		}
 	}
 
-	// Support returning signed user info if the registered client requested it
-	// as specified in https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse and
+	// Support returning signed and or encrypted user info if the registered
+	// client requested it as specified in https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse and
 	// https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
-	registration, _ := p.clients.Get(req.Context(), claims.Audience)
-	if registration != nil {
+	registration, _ := p.clients.Get(req.Context(), claims.AuthorizedClientID())
+	if registration != nil && (registration.RawUserInfoSignedResponseAlg != "" || registration.RawUserInfoEncryptedResponseAlg != "") {
+		var tokenString string
+		// Set extra claims.
+		responseAsMap[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
+		responseAsMap[oidc.AudienceClaim] = registration.ID
+
 		if registration.RawUserInfoSignedResponseAlg != "" {
 			// Get alg.
 			alg := jwt.GetSigningMethod(registration.RawUserInfoSignedResponseAlg)
-			// Set extra claims.
-			responseAsMap[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
-			responseAsMap[oidc.AudienceClaim] = registration.ID
-			tokenString, err := p.makeJWT(req.Context(), alg, jwt.MapClaims(responseAsMap))
+			if alg == nil {
+				err = fmt.Errorf("unknown userinfo_signed_response_alg")
+			} else {
+				tokenString, err = p.makeJWT(req.Context(), alg, jwt.MapClaims(responseAsMap))
+			}
 			if err != nil {
 				p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to encode jwt")
 				p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
 				return
 			}
+		}
 
-			rw.Header().Set("Content-Type", "application/jwt")
-			rw.Write([]byte(tokenString))
-			return
+		if registration.RawUserInfoEncryptedResponseAlg != "" {
+			// Encrypt the signed JWT, or the plain claims if not signed.
+			var payload []byte
+			if tokenString != "" {
+				payload = []byte(tokenString)
+			} else {
+				payload, err = json.Marshal(responseAsMap)
+			}
+			if err == nil {
+				tokenString, err = p.encryptJWE(registration, registration.RawUserInfoEncryptedResponseAlg, registration.RawUserInfoEncryptedResponseEnc, payload, registration.RawUserInfoSignedResponseAlg != "")
+			}
+			if err != nil {
+				p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to encrypt response")
+				p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+				return
+			}
 		}
+
+		rw.Header().Set("Content-Type", "application/jwt")
+		rw.Write([]byte(tokenString))
+		return
 	}
 
 	err = utils.WriteJSON(rw, http.StatusOK, responseAsMap, "")
@@ -731,6 +1623,7 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 	var err error
 	var session *payload.Session
 	var currentIdentityManager identity.Manager
+	var frontChannelLogoutURIs []*url.URL
 
 	addResponseHeaders(rw.Header())
 
@@ -742,7 +1635,7 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	esr, err := payload.DecodeEndSessionRequest(req, p.metadata)
+	esr, err := payload.DecodeEndSessionRequest(req, p.metadata.WellKnown)
 	if err != nil {
 		p.logger.WithError(err).Errorln("endsession request invalid request data")
 		p.ErrorPage(rw, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
@@ -755,6 +1648,10 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 	if err != nil {
 		goto done
 	}
+	if esr.IDTokenHint != nil {
+		// Compare subjects as presented to the client of the ID token hint.
+		esr.SetPublicSubjectFunc(p.publicSubjectFunc(req.Context(), esr.IDTokenHint.Claims.(*konnectoidc.IDTokenClaims).Audience))
+	}
 
 	// Get our session.
 	session, err = p.getSession(req)
@@ -769,6 +1666,16 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 
 	// Authorization unauthenticates end user.
 	err = currentIdentityManager.EndSession(req.Context(), rw, req, esr)
+	switch err.(type) {
+	case nil, *identity.RedirectError:
+		// Notify clients of the ended session.
+		if session != nil {
+			if record, found := p.sessionManager.Pop(session.ID); found {
+				p.backChannelLogout(req.Context(), record)
+				frontChannelLogoutURIs = p.frontChannelLogoutURIs(req.Context(), record)
+			}
+		}
+	}
 	if err != nil {
 		goto done
 	}
@@ -779,7 +1686,12 @@ done:
 		case *payload.AuthenticationBadRequest:
 			p.ErrorPage(rw, http.StatusBadRequest, err.Error(), err.(*payload.AuthenticationBadRequest).Description())
 		case *identity.RedirectError:
-			p.Found(rw, err.(*identity.RedirectError).RedirectURI(), nil, false)
+			redirectURI := err.(*identity.RedirectError).RedirectURI()
+			if len(frontChannelLogoutURIs) > 0 {
+				p.FrontChannelLogoutPage(rw, frontChannelLogoutURIs, redirectURI.String())
+			} else {
+				p.Found(rw, redirectURI, nil, false)
+			}
 		case *identity.IsHandledError:
 			// do nothing
 		case *konnectoidc.OAuth2Error:
@@ -802,7 +1714,20 @@ done:
 		State: esr.State,
 	}
 
-	if esr.PostLogoutRedirectURI == nil || esr.PostLogoutRedirectURI.String() == "" {
+	if len(frontChannelLogoutURIs) > 0 {
+		// Render front-channel logout page which continues to the post logout
+		// redirect URI afterwards, if any.
+		var continueURI string
+		if esr.PostLogoutRedirectURI != nil && esr.PostLogoutRedirectURI.String() != "" {
+			continueURI, err = utils.RedirectURL(esr.PostLogoutRedirectURI, response, false)
+			if err != nil {
+				p.logger.WithError(err).Errorln("endsession request failed to create redirect uri")
+				p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+				return
+			}
+		}
+		p.FrontChannelLogoutPage(rw, frontChannelLogoutURIs, continueURI)
+	} else if esr.PostLogoutRedirectURI == nil || esr.PostLogoutRedirectURI.String() == "" {
 		err = utils.WriteJSON(rw, http.StatusOK, response, "")
 		if err != nil {
 			p.logger.WithError(err).Errorln("endsession request failed writing response")
@@ -838,9 +1763,19 @@ func (p *Provider) CheckSessionIframeHandler(rw http.ResponseWriter, req *http.R
 // with OpenID Connect Registration 1.0 as specified at
 // https://openid.net/specs/openid-connect-registration-1_0.html#ClientRegistration
 func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		// Registered clients manage their registration at their registration
+		// client URI, which is the registration endpoint with client_id.
+		p.ClientConfigurationHandler(rw, req)
+		return
+	}
+
 	req.Body = http.MaxBytesReader(rw, req.Body, registrationSizeLimit)
 	addResponseHeaders(rw.Header())
 
+	var registrationAccessToken string
+
 	crr, err := payload.DecodeClientRegistrationRequest(req)
 	if err != nil {
 		p.logger.WithError(err).Errorln("client registration request failed to decode request data")
@@ -850,6 +1785,7 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 	}
 
 	var cr *clients.ClientRegistration
+	var registration *clients.ClientRegistration
 
 	// Validate request method
 	switch req.Method {
@@ -871,11 +1807,30 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 	if err != nil {
 		goto done
 	}
+	err = p.validateClientSubjectType(req.Context(), cr)
+	if err != nil {
+		goto done
+	}
+	err = p.validateClientTLSClientAuth(cr)
+	if err != nil {
+		goto done
+	}
 	// Set client to dynamic. This creates the id and client secret.
 	err = cr.SetDynamic(req.Context(), p.clients.StatelessCreator)
 	if err != nil {
 		goto done
 	}
+	// The registration access token is bound to the registration as it is
+	// looked up later, which has the derived and not the clear text secret.
+	registration, _ = p.clients.Get(req.Context(), cr.ID)
+	if registration == nil {
+		err = fmt.Errorf("failed to look up registered client")
+		goto done
+	}
+	registrationAccessToken, err = p.makeRegistrationAccessToken(req.Context(), registration)
+	if err != nil {
+		goto done
+	}
 
 done:
 	if err != nil {
@@ -908,6 +1863,9 @@ done:
 		ClientIDIssuedAt:      cr.IDIssuedAt,
 		ClientSecretExpiresAt: cr.SecretExpiresAt,
 
+		RegistrationAccessToken: registrationAccessToken,
+		RegistrationClientURI:   p.makeRegistrationClientURI(cr.ID),
+
 		ClientRegistrationRequest: *crr,
 	}
 
@@ -916,3 +1874,154 @@ done:
 		p.logger.WithError(err).Errorln("client registration request failed writing response")
 	}
 }
+
+// ClientConfigurationHandler implements the HTTP client configuration endpoint
+// for OAuth 2.0 Dynamic Client Registration Management as specified at
+// https://tools.ietf.org/html/rfc7592#section-2
+func (p *Provider) ClientConfigurationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var cr *clients.ClientRegistration
+	var crr *payload.ClientRegistrationRequest
+	var update *clients.ClientRegistration
+	var clientSecret string
+	var registrationAccessToken string
+
+	req.Body = http.MaxBytesReader(rw, req.Body, registrationSizeLimit)
+	addResponseHeaders(rw.Header())
+
+	clientID := req.URL.Query().Get("client_id")
+
+	// Authenticate with registration access token as specified at
+	// https://tools.ietf.org/html/rfc7592#section-2
+	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != oidc.TokenTypeBearer {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "registration access token required")
+		goto done
+	}
+	cr, err = p.validateRegistrationAccessToken(req.Context(), clientID, auth[1])
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, err.Error())
+		goto done
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		// Client read request as specified at https://tools.ietf.org/html/rfc7592#section-2.1
+		crr, err = payload.NewClientRegistrationRequest(cr)
+		if err != nil {
+			goto done
+		}
+
+	case http.MethodPut:
+		// Client update request as specified at https://tools.ietf.org/html/rfc7592#section-2.2
+		crr, err = payload.DecodeClientRegistrationRequest(req)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+			goto done
+		}
+		if crr.ClientID != cr.ID {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "client_id mismatch")
+			goto done
+		}
+		err = crr.Validate()
+		if err != nil {
+			goto done
+		}
+
+		update, err = crr.ClientRegistration()
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, err.Error())
+			goto done
+		}
+		err = p.validateClientSubjectType(req.Context(), update)
+		if err != nil {
+			goto done
+		}
+		err = p.validateClientTLSClientAuth(update)
+		if err != nil {
+			goto done
+		}
+		clientSecret, err = cr.UpdateDynamic(update, crr.ClientSecret)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+			goto done
+		}
+		err = p.clients.Update(req.Context(), update)
+		if err != nil {
+			goto done
+		}
+		cr = update
+
+	case http.MethodDelete:
+		// Client delete request as specified at https://tools.ietf.org/html/rfc7592#section-2.3
+		// Outstanding registration access tokens and refresh tokens of the
+		// client are rejected from now on, since both require the client to
+		// be registered.
+		err = p.clients.Delete(req.Context(), cr)
+		if err != nil {
+			goto done
+		}
+
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with GET, PUT or DELETE")
+		goto done
+	}
+
+	if req.Method != http.MethodDelete {
+		registrationAccessToken, err = p.makeRegistrationAccessToken(req.Context(), cr)
+		if err != nil {
+			goto done
+		}
+	}
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			status := http.StatusBadRequest
+			if konnectoidc.IsErrorWithID(err, oidc.ErrorCodeOAuth2InvalidToken) {
+				// Unauthorized as specified at https://tools.ietf.org/html/rfc6750#section-3.1
+				status = http.StatusUnauthorized
+				rw.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=\"%s\"", oidc.ErrorCodeOAuth2InvalidToken))
+			}
+			err = utils.WriteJSON(rw, status, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("client configuration request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("client configuration request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	if req.Method == http.MethodDelete {
+		p.logger.WithField("client_id", cr.ID).Debugln("deleted dynamic client")
+
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := &payload.ClientRegistrationResponse{
+		ClientID:     cr.ID,
+		ClientSecret: clientSecret,
+
+		ClientIDIssuedAt:      cr.IDIssuedAt,
+		ClientSecretExpiresAt: cr.SecretExpiresAt,
+
+		RegistrationAccessToken: registrationAccessToken,
+		RegistrationClientURI:   p.makeRegistrationClientURI(cr.ID),
+
+		ClientRegistrationRequest: *crr,
+	}
+	// Never echo back the client credentials of the request.
+	response.ClientRegistrationRequest.ClientID = ""
+	response.ClientRegistrationRequest.ClientSecret = ""
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("client configuration request failed writing response")
+	}
+}
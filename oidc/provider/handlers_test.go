@@ -18,14 +18,27 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/dgrijalva/jwt-go"
 	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/oidc/device"
 )
 
 func TestWellKnownHandler(t *testing.T) {
@@ -60,7 +73,7 @@ func TestWellKnownHandler(t *testing.T) {
 		t.Errorf("Content-Type response header was incorrect, got %s, want application/json; encoding=utf-8", rr.Header().Get("Content-Type"))
 	}
 
-	wellKnown := &oidc.WellKnown{}
+	wellKnown := &konnectoidc.WellKnown{}
 	if err := json.Unmarshal(body, wellKnown); err != nil {
 		t.Fatal(err)
 	}
@@ -85,6 +98,18 @@ func TestWellKnownHandler(t *testing.T) {
 		t.Errorf("JwksURI was incorrect, got %s, want %s", wellKnown.JwksURI, provider.makeIssURL(config.JwksPath))
 	}
 
+	if wellKnown.IntrospectionEndpoint != provider.makeIssURL(config.IntrospectionPath) {
+		t.Errorf("IntrospectionEndpoint was incorrect, got %s, want %s", wellKnown.IntrospectionEndpoint, provider.makeIssURL(config.IntrospectionPath))
+	}
+
+	if wellKnown.DeviceAuthorizationEndpoint != provider.makeIssURL(config.DeviceAuthorizationPath) {
+		t.Errorf("DeviceAuthorizationEndpoint was incorrect, got %s, want %s", wellKnown.DeviceAuthorizationEndpoint, provider.makeIssURL(config.DeviceAuthorizationPath))
+	}
+
+	if wellKnown.PushedAuthorizationRequestEndpoint != provider.makeIssURL(config.PushedAuthorizationRequestPath) {
+		t.Errorf("PushedAuthorizationRequestEndpoint was incorrect, got %s, want %s", wellKnown.PushedAuthorizationRequestEndpoint, provider.makeIssURL(config.PushedAuthorizationRequestPath))
+	}
+
 	// TODO(longsleep): Not only check that value is not empty, check values too.
 	if len(wellKnown.ScopesSupported) == 0 {
 		t.Errorf("ScopesSupported must not be empty")
@@ -106,3 +131,983 @@ func TestWellKnownHandler(t *testing.T) {
 		t.Errorf("IDTokenSigningAlgValuesSupported must not be empty")
 	}
 }
+
+func TestTokenExchangeTargetMustBeAllowed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	registration, _ := provider.clients.Get(ctx, testClientID)
+	registration.AllowedResources = []string{"https://api.example.com"}
+
+	subjectToken, err := provider.makeAccessToken(ctx, testClientID, nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		audience string
+		resource string
+		status   int
+	}{
+		{"", "", http.StatusOK},
+		{"https://api.example.com", "", http.StatusOK},
+		{"", "https://api.example.com", http.StatusOK},
+		{"https://other.example.com", "", http.StatusBadRequest},
+		{"", "https://other.example.com", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		values := url.Values{
+			"grant_type":         []string{konnectoidc.GrantTypeTokenExchange},
+			"subject_token":      []string{subjectToken},
+			"subject_token_type": []string{konnectoidc.TokenTypeIdentifierAccessToken},
+			"client_id":          []string{testClientID},
+			"client_secret":      []string{testClientSecret},
+		}
+		if test.audience != "" {
+			values.Set("audience", test.audience)
+		}
+		if test.resource != "" {
+			values.Set("resource", test.resource)
+		}
+
+		rr, response := postTokenRequest(router, values)
+		if rr.Code != test.status {
+			t.Errorf("audience %q resource %q: got status %v want %v: %s", test.audience, test.resource, rr.Code, test.status, rr.Body.String())
+			continue
+		}
+		if test.status != http.StatusOK && response["error"] != konnectoidc.ErrorCodeOAuth2InvalidTarget {
+			t.Errorf("audience %q resource %q: got error %v want %v", test.audience, test.resource, response["error"], konnectoidc.ErrorCodeOAuth2InvalidTarget)
+		}
+	}
+}
+
+func TestTokenExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	registration, _ := provider.clients.Get(ctx, testClientID)
+	registration.AllowedResources = []string{"https://api.example.com"}
+	key := registerTestPrivateKeyJWTClient(t, provider, "keyclient", "")
+
+	subjectToken, err := provider.makeAccessToken(ctx, "client1", nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subjectClaims, _ := provider.parseAccessToken(subjectToken)
+	delegatedToken, err := provider.makeAccessToken(ctx, "client1", nil, newTestAuthRecord(provider), &konnect.ActorClaims{Subject: "service1", ClientID: "service1"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actorToken, err := provider.makeAccessToken(ctx, "client2", nil, identity.NewAuthRecord(nil, "client2", nil, nil, nil), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedToken, err := provider.makeAccessToken(ctx, "client1", nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = provider.revokeToken(ctx, revokedToken, "", "client1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		values   url.Values
+		status   int
+		error    string
+		scopes   []string
+		audience string
+		actor    []string
+	}{
+		{"subject token", url.Values{}, http.StatusOK, "", []string{"offline_access", "openid"}, testClientID, []string{testClientID}},
+		{"narrowed scope", url.Values{"scope": {"openid"}}, http.StatusOK, "", []string{"openid"}, testClientID, []string{testClientID}},
+		{"broader scope", url.Values{"scope": {"openid profile"}}, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidScope, nil, "", nil},
+		{"narrowed audience", url.Values{"audience": {"https://api.example.com"}}, http.StatusOK, "", nil, "https://api.example.com", []string{testClientID}},
+		{"actor token", url.Values{"actor_token": {actorToken}, "actor_token_type": {konnectoidc.TokenTypeIdentifierAccessToken}}, http.StatusOK, "", nil, testClientID, []string{"client2"}},
+		{"nested actor", url.Values{"subject_token": {delegatedToken}, "actor_token": {actorToken}, "actor_token_type": {konnectoidc.TokenTypeIdentifierAccessToken}}, http.StatusOK, "", nil, testClientID, []string{"client2", "service1"}},
+		{"invalid subject token", url.Values{"subject_token": {"invalid"}}, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidGrant, nil, "", nil},
+		{"revoked subject token", url.Values{"subject_token": {revokedToken}}, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidGrant, nil, "", nil},
+		{"unsupported subject_token_type", url.Values{"subject_token_type": {"urn:example:unsupported"}}, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidRequest, nil, "", nil},
+		{"private_key_jwt without secret", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {makeTestPrivateKeyJWTAssertion(t, provider, "keyclient", key, "jti-1")}}, http.StatusOK, "", nil, "keyclient", []string{"keyclient"}},
+	}
+	for _, test := range tests {
+		values := url.Values{
+			"grant_type":         []string{konnectoidc.GrantTypeTokenExchange},
+			"subject_token":      []string{subjectToken},
+			"subject_token_type": []string{konnectoidc.TokenTypeIdentifierAccessToken},
+		}
+		for key, value := range test.values {
+			values[key] = value
+		}
+		if values.Get("client_assertion") == "" {
+			values.Set("client_id", testClientID)
+			values.Set("client_secret", testClientSecret)
+		}
+
+		rr, response := postTokenRequest(router, values)
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+			continue
+		}
+		if test.status != http.StatusOK {
+			if response["error"] != test.error {
+				t.Errorf("%s: got error %v want %v", test.name, response["error"], test.error)
+			}
+			continue
+		}
+
+		accessToken, _ := response["access_token"].(string)
+		claims, err := provider.parseAccessToken(accessToken)
+		if err != nil {
+			t.Errorf("%s: invalid access token: %v", test.name, err)
+			continue
+		}
+		if claims.Subject != subjectClaims.Subject {
+			t.Errorf("%s: got sub %v want %v", test.name, claims.Subject, subjectClaims.Subject)
+		}
+		if test.scopes != nil {
+			sort.Strings(claims.AuthorizedScopesList)
+			if strings.Join(claims.AuthorizedScopesList, " ") != strings.Join(test.scopes, " ") {
+				t.Errorf("%s: got scopes %v want %v", test.name, claims.AuthorizedScopesList, test.scopes)
+			}
+		}
+		if len(claims.Audience) != 1 || !claims.Audience.Contains(test.audience) {
+			t.Errorf("%s: got aud %v want %v", test.name, claims.Audience, test.audience)
+		}
+		actors := []string{}
+		for actor := claims.Actor; actor != nil; actor = actor.Actor {
+			actors = append(actors, actor.Subject)
+		}
+		if strings.Join(actors, " ") != strings.Join(test.actor, " ") {
+			t.Errorf("%s: got act chain %v want %v", test.name, actors, test.actor)
+		}
+	}
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	registration, _ := provider.clients.Get(ctx, testClientID)
+	registration.AllowedScopes = []string{"api.read", "api.write"}
+	registration.AllowedResources = []string{"https://api.example.com"}
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "publicclient",
+		RedirectURIs: []string{"https://public.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := registerTestPrivateKeyJWTClient(t, provider, "keyclient", "")
+
+	tests := []struct {
+		name     string
+		values   url.Values
+		status   int
+		error    string
+		scopes   []string
+		audience string
+	}{
+		{"all allowed scopes", url.Values{}, http.StatusOK, "", []string{"api.read", "api.write"}, ""},
+		{"requested scope", url.Values{"scope": {"api.read"}}, http.StatusOK, "", []string{"api.read"}, ""},
+		{"scope not allowed", url.Values{"scope": {"api.read admin"}}, http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2InvalidScope, nil, ""},
+		{"allowed resource", url.Values{"resource": {"https://api.example.com"}}, http.StatusOK, "", []string{"api.read", "api.write"}, "https://api.example.com"},
+		{"resource not allowed", url.Values{"resource": {"https://other.example.com"}}, http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2InvalidTarget, nil, ""},
+		{"public client", url.Values{"client_id": {"publicclient"}}, http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2UnauthorizedClient, nil, ""},
+		{"private_key_jwt without secret", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {makeTestPrivateKeyJWTAssertion(t, provider, "keyclient", key, "jti-1")}}, http.StatusOK, "", nil, ""},
+	}
+	for _, test := range tests {
+		values := url.Values{
+			"grant_type": []string{konnectoidc.GrantTypeClientCredentials},
+		}
+		for key, value := range test.values {
+			values[key] = value
+		}
+		if values.Get("client_id") == "" && values.Get("client_assertion") == "" {
+			values.Set("client_id", testClientID)
+			values.Set("client_secret", testClientSecret)
+		}
+
+		rr, response := postTokenRequest(router, values)
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+			continue
+		}
+		if test.status != http.StatusOK {
+			if response["error"] != test.error {
+				t.Errorf("%s: got error %v want %v", test.name, response["error"], test.error)
+			}
+			continue
+		}
+		if _, ok := response["refresh_token"]; ok {
+			t.Errorf("%s: client_credentials grant must not issue a refresh token", test.name)
+		}
+
+		accessToken, _ := response["access_token"].(string)
+		claims, err := provider.parseAccessToken(accessToken)
+		if err != nil {
+			t.Errorf("%s: invalid access token: %v", test.name, err)
+			continue
+		}
+		if claims.Subject != claims.AuthorizedClientID() {
+			t.Errorf("%s: got sub %v want client %v", test.name, claims.Subject, claims.AuthorizedClientID())
+		}
+		if test.scopes != nil {
+			sort.Strings(claims.AuthorizedScopesList)
+			if strings.Join(claims.AuthorizedScopesList, " ") != strings.Join(test.scopes, " ") {
+				t.Errorf("%s: got scopes %v want %v", test.name, claims.AuthorizedScopesList, test.scopes)
+			}
+		}
+		if test.audience == "" {
+			test.audience = claims.AuthorizedClientID()
+		}
+		if !claims.Audience.Contains(test.audience) {
+			t.Errorf("%s: got aud %v want %v", test.name, claims.Audience, test.audience)
+		}
+	}
+}
+
+func TestConfidentialEndpointsWithoutCORS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, _, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	tests := []struct {
+		path string
+		cors bool
+	}{
+		{config.WellKnownPath, true},
+		{config.IntrospectionPath, false},
+		{config.RevocationPath, false},
+		{config.DeviceAuthorizationPath, false},
+		{config.PushedAuthorizationRequestPath, false},
+	}
+	for _, test := range tests {
+		method := http.MethodPost
+		if test.cors {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, test.path, nil)
+		req.Header.Set("Origin", "https://other.example.com")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if cors := rr.Header().Get("Access-Control-Allow-Origin") != ""; cors != test.cors {
+			t.Errorf("%s: got CORS %v want %v", test.path, cors, test.cors)
+		}
+	}
+}
+
+func TestIntrospectionClientAuthentication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "publicclient",
+		RedirectURIs: []string{"https://public.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration, _ := provider.clients.Get(ctx, testClientID)
+	accessToken, err := provider.makeAccessToken(ctx, testClientID, nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		registered string
+		values     url.Values
+		basic      bool
+		status     int
+	}{
+		{"client_secret_basic", "", url.Values{}, true, http.StatusOK},
+		{"client_secret_post", "", url.Values{"client_id": {testClientID}, "client_secret": {testClientSecret}}, false, http.StatusOK},
+		{"wrong secret", "", url.Values{"client_id": {testClientID}, "client_secret": {"wrong"}}, false, http.StatusUnauthorized},
+		{"client_secret_jwt", "", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {"jti-1"}}, false, http.StatusOK},
+		{"client_secret_jwt replay", "", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {"jti-1"}}, false, http.StatusUnauthorized},
+		{"registered method mismatch", konnectoidc.AuthMethodPrivateKeyJWT, url.Values{"client_id": {testClientID}, "client_secret": {testClientSecret}}, false, http.StatusUnauthorized},
+		{"public client", "", url.Values{"client_id": {"publicclient"}}, false, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		registration.RawTokenEndpointAuthMethod = test.registered
+
+		values := url.Values{}
+		for key, value := range test.values {
+			values[key] = value
+		}
+		if jti := values.Get("client_assertion"); jti != "" {
+			values.Set("client_assertion", makeTestClientAssertion(t, provider, jti))
+		}
+		values.Set("token", accessToken)
+		req := httptest.NewRequest(http.MethodPost, config.IntrospectionPath, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.basic {
+			req.SetBasicAuth(testClientID, testClientSecret)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+			continue
+		}
+		if test.status == http.StatusOK {
+			response := make(map[string]interface{})
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if response["active"] != true {
+				t.Errorf("%s: token not active: %v", test.name, response)
+			}
+		}
+	}
+}
+
+func TestRevocationClientAuthentication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	key := registerTestPrivateKeyJWTClient(t, provider, "keyclient", "keysecret")
+
+	tests := []struct {
+		name    string
+		values  url.Values
+		status  int
+		revoked bool
+	}{
+		{"method mismatch", url.Values{"client_id": {"keyclient"}, "client_secret": {"keysecret"}}, http.StatusUnauthorized, false},
+		{"private_key_jwt", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {makeTestPrivateKeyJWTAssertion(t, provider, "keyclient", key, "jti-1")}}, http.StatusOK, true},
+	}
+	for _, test := range tests {
+		tokenString, claims := makeTestRefreshToken(ctx, t, provider, "keyclient")
+
+		values := url.Values{}
+		for key, value := range test.values {
+			values[key] = value
+		}
+		values.Set("token", tokenString)
+		req := httptest.NewRequest(http.MethodPost, config.RevocationPath, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+		}
+		if revoked := provider.isRefreshTokenRevoked(claims); revoked != test.revoked {
+			t.Errorf("%s: got revoked %v want %v", test.name, revoked, test.revoked)
+		}
+	}
+}
+
+func TestDeviceAuthorizationClientAuthentication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "publicclient",
+		RedirectURIs: []string{"https://public.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration, _ := provider.clients.Get(ctx, testClientID)
+
+	tests := []struct {
+		name       string
+		registered string
+		values     url.Values
+		status     int
+	}{
+		{"public client", "", url.Values{"client_id": {"publicclient"}}, http.StatusOK},
+		{"client_secret_post", "", url.Values{"client_id": {testClientID}, "client_secret": {testClientSecret}}, http.StatusOK},
+		{"client_secret_jwt", "", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {"jti-1"}}, http.StatusOK},
+		{"client_secret_jwt replay", "", url.Values{"client_assertion_type": {konnectoidc.ClientAssertionTypeJWTBearer}, "client_assertion": {"jti-1"}}, http.StatusUnauthorized},
+		{"registered method mismatch", konnectoidc.AuthMethodPrivateKeyJWT, url.Values{"client_id": {testClientID}, "client_secret": {testClientSecret}}, http.StatusUnauthorized},
+		{"confidential client without secret", "", url.Values{"client_id": {testClientID}}, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		registration.RawTokenEndpointAuthMethod = test.registered
+
+		values := url.Values{}
+		for key, value := range test.values {
+			values[key] = value
+		}
+		if jti := values.Get("client_assertion"); jti != "" {
+			values.Set("client_assertion", makeTestClientAssertion(t, provider, jti))
+		}
+		values.Set("scope", "openid")
+		req := httptest.NewRequest(http.MethodPost, config.DeviceAuthorizationPath, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+			continue
+		}
+		if test.status == http.StatusOK {
+			response := make(map[string]interface{})
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if response["device_code"] == nil {
+				t.Errorf("%s: missing device_code: %v", test.name, response)
+			}
+		}
+	}
+}
+
+func TestDeviceCodeGrant(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "deviceclient",
+		RedirectURIs: []string{"https://device.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func() (string, *device.Record) {
+		values := url.Values{"client_id": {"deviceclient"}, "scope": {"openid"}}
+		req := httptest.NewRequest(http.MethodPost, config.DeviceAuthorizationPath, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		response := make(map[string]interface{})
+		json.Unmarshal(rr.Body.Bytes(), &response)
+
+		deviceCode, _ := response["device_code"].(string)
+		userCode, _ := response["user_code"].(string)
+		record, found := provider.deviceManager.Lookup(userCode)
+		if !found {
+			t.Fatalf("device authorization request failed: %s", rr.Body.String())
+		}
+		return deviceCode, record
+	}
+	poll := func(deviceCode string) (int, map[string]interface{}) {
+		rr, response := postTokenRequest(router, url.Values{
+			"grant_type":  []string{konnectoidc.GrantTypeDeviceCode},
+			"device_code": []string{deviceCode},
+			"client_id":   []string{"deviceclient"},
+		})
+		return rr.Code, response
+	}
+
+	tests := []struct {
+		name   string
+		decide func(record *device.Record) error
+		status int
+		error  string
+	}{
+		{"approved", func(record *device.Record) error {
+			return provider.deviceManager.Approve(record.UserCode, identity.NewAuthRecord(provider.identityManager, "unittestuser", map[string]bool{oidc.ScopeOpenID: true}, nil, nil))
+		}, http.StatusOK, ""},
+		{"denied", func(record *device.Record) error {
+			return provider.deviceManager.Deny(record.UserCode)
+		}, http.StatusBadRequest, oidc.ErrorCodeOAuth2AccessDenied},
+	}
+	for _, test := range tests {
+		deviceCode, record := authorize()
+
+		if status, response := poll(deviceCode); status != http.StatusBadRequest || response["error"] != konnectoidc.ErrorCodeOAuth2AuthorizationPending {
+			t.Errorf("%s: pending poll got %v %v", test.name, status, response["error"])
+		}
+		if status, response := poll(deviceCode); status != http.StatusBadRequest || response["error"] != konnectoidc.ErrorCodeOAuth2SlowDown {
+			t.Errorf("%s: early poll got %v %v", test.name, status, response["error"])
+		}
+		// Allow polling without waiting for the interval.
+		record.Interval = 0
+
+		if err = test.decide(record); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		status, response := poll(deviceCode)
+		if status != test.status || (test.error != "" && response["error"] != test.error) {
+			t.Errorf("%s: got %v %v want %v %v", test.name, status, response["error"], test.status, test.error)
+		}
+		if test.status == http.StatusOK && response["access_token"] == nil {
+			t.Errorf("%s: missing access_token: %v", test.name, response)
+		}
+		if status, response = poll(deviceCode); status != http.StatusBadRequest || response["error"] != oidc.ErrorCodeOAuth2InvalidGrant {
+			t.Errorf("%s: poll after completion got %v %v", test.name, status, response["error"])
+		}
+	}
+}
+
+func pushTestAuthorizationRequest(router http.Handler, config *Config, values url.Values, configure func(req *http.Request)) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, config.PushedAuthorizationRequestPath, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if configure != nil {
+		configure(req)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	response := make(map[string]interface{})
+	json.Unmarshal(rr.Body.Bytes(), &response)
+
+	return rr, response
+}
+
+func TestPushedAuthorizationRequestURIOneTimeUse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, _, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	rr, response := pushTestAuthorizationRequest(router, config, url.Values{
+		"client_id":     {testClientID},
+		"client_secret": {testClientSecret},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"redirect_uri":  {"https://client.example.com/cb"},
+	}, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("push failed with status %v: %s", rr.Code, rr.Body.String())
+	}
+	requestURI, _ := response["request_uri"].(string)
+
+	authorize := func(requestURI string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"client_id":   {testClientID},
+			"request_uri": {requestURI},
+		}
+		req := httptest.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+query.Encode(), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr = authorize(requestURI); rr.Code == http.StatusBadRequest {
+		t.Fatalf("first use of request_uri failed: %s", rr.Body.String())
+	}
+	if rr = authorize(requestURI); rr.Code != http.StatusBadRequest {
+		t.Errorf("second use of request_uri got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPushedAuthorizationRequestTLSClientAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	ca, caKey := makeTestCertificate(t, "Test CA", nil, nil)
+	certificate, _ := makeTestCertificate(t, "mtls.example.com", ca, caKey)
+	config.Config.TLSConfig = &tls.Config{
+		ClientCAs: x509.NewCertPool(),
+	}
+	config.Config.TLSConfig.ClientCAs.AddCert(ca)
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                         "mtlsclient",
+		RedirectURIs:               []string{"https://mtls.example.com/cb"},
+		RawTokenEndpointAuthMethod: konnectoidc.AuthMethodTLSClientAuth,
+		TLSClientAuthSANDNS:        "mtls.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+		status      int
+	}{
+		{"with certificate", certificate, http.StatusCreated},
+		{"without certificate", nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		rr, _ := pushTestAuthorizationRequest(router, config, url.Values{
+			"client_id":     {"mtlsclient"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"redirect_uri":  {"https://mtls.example.com/cb"},
+		}, func(req *http.Request) {
+			if test.certificate != nil {
+				req.TLS = &tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{test.certificate},
+				}
+			}
+		})
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+		}
+	}
+}
+
+func TestWellKnownSignedMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, signMetadata := range []bool{false, true} {
+		provider.signMetadata = signMetadata
+		provider.metadata.SignedMetadata = ""
+		if err := provider.InitializeMetadata(); err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, config.WellKnownPath, nil)
+		rr := httptest.NewRecorder()
+		provider.ServeHTTP(rr, req)
+
+		wellKnown := &konnectoidc.WellKnown{}
+		if err := json.Unmarshal(rr.Body.Bytes(), wellKnown); err != nil {
+			t.Fatal(err)
+		}
+		if !signMetadata {
+			if wellKnown.SignedMetadata != "" {
+				t.Errorf("unexpected signed_metadata")
+			}
+			continue
+		}
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(wellKnown.SignedMetadata, claims, provider.validateJWT)
+		if err != nil {
+			t.Fatalf("invalid signed_metadata: %v", err)
+		}
+		if claims["iss"] != config.IssuerIdentifier {
+			t.Errorf("signed_metadata iss got %v want %v", claims["iss"], config.IssuerIdentifier)
+		}
+		if claims["token_endpoint"] != wellKnown.TokenEndpoint {
+			t.Errorf("signed_metadata token_endpoint got %v want %v", claims["token_endpoint"], wellKnown.TokenEndpoint)
+		}
+	}
+}
+
+func sendTestClientConfigurationRequest(router http.Handler, method string, uri string, registrationAccessToken string, body map[string]interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var req *http.Request
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		req = httptest.NewRequest(method, uri, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, uri, nil)
+	}
+	if registrationAccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+registrationAccessToken)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	response := make(map[string]interface{})
+	json.Unmarshal(rr.Body.Bytes(), &response)
+
+	return rr, response
+}
+
+func TestClientConfigurationHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	register := func(name string) map[string]interface{} {
+		rr, response := sendTestClientConfigurationRequest(router, http.MethodPost, config.RegistrationPath, "", map[string]interface{}{
+			"client_name":   name,
+			"redirect_uris": []string{"https://" + name + ".example.com/cb"},
+		})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("registration of %s failed with status %v: %s", name, rr.Code, rr.Body.String())
+		}
+		return response
+	}
+	client := register("client")
+	other := register("other")
+
+	clientID, _ := client["client_id"].(string)
+	clientURI, _ := client["registration_client_uri"].(string)
+	registrationAccessToken, _ := client["registration_access_token"].(string)
+	otherRegistrationAccessToken, _ := other["registration_access_token"].(string)
+	refreshToken, _ := makeTestRefreshToken(ctx, t, provider, clientID)
+
+	// Read.
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "invalid", http.StatusUnauthorized},
+		{"token of other client", otherRegistrationAccessToken, http.StatusUnauthorized},
+		{"registration access token", registrationAccessToken, http.StatusOK},
+	}
+	for _, test := range tests {
+		rr, response := sendTestClientConfigurationRequest(router, http.MethodGet, clientURI, test.token, nil)
+		if rr.Code != test.status {
+			t.Errorf("GET %s: got status %v want %v: %s", test.name, rr.Code, test.status, rr.Body.String())
+			continue
+		}
+		if test.status == http.StatusOK && response["client_name"] != "client" {
+			t.Errorf("GET %s: got client_name %v want client", test.name, response["client_name"])
+		}
+	}
+
+	// Update.
+	update := map[string]interface{}{
+		"client_id":     clientID,
+		"client_name":   "updated",
+		"redirect_uris": []string{"https://client.example.com/cb"},
+	}
+	rr, _ := sendTestClientConfigurationRequest(router, http.MethodPut, clientURI, otherRegistrationAccessToken, update)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("PUT with token of other client: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	rr, response := sendTestClientConfigurationRequest(router, http.MethodPut, clientURI, registrationAccessToken, map[string]interface{}{
+		"client_id":      clientID,
+		"redirect_uris":  []string{"https://client.example.com/cb"},
+		"grant_types":    []string{oidc.GrantTypeAuthorizationCode},
+		"response_types": []string{oidc.ResponseTypeIDToken},
+	})
+	if rr.Code != http.StatusBadRequest || response["error"] != oidc.ErrorCodeOIDCInvalidClientMetadata {
+		t.Errorf("PUT with invalid metadata: got status %v error %v want %v", rr.Code, response["error"], oidc.ErrorCodeOIDCInvalidClientMetadata)
+	}
+	rr, response = sendTestClientConfigurationRequest(router, http.MethodPut, clientURI, registrationAccessToken, update)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if response["client_name"] != "updated" {
+		t.Errorf("PUT: got client_name %v want updated", response["client_name"])
+	}
+	registrationAccessToken, _ = response["registration_access_token"].(string)
+	clientSecret, _ := response["client_secret"].(string)
+
+	// Delete.
+	rr, _ = sendTestClientConfigurationRequest(router, http.MethodDelete, clientURI, otherRegistrationAccessToken, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE with token of other client: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	rr, _ = sendTestClientConfigurationRequest(router, http.MethodDelete, clientURI, registrationAccessToken, nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: got status %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body.String())
+	}
+
+	// Outstanding tokens of the deleted client must be rejected.
+	rr, _ = sendTestClientConfigurationRequest(router, http.MethodGet, clientURI, registrationAccessToken, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("GET after DELETE: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	rr, _ = postTokenRequest(router, url.Values{
+		"grant_type":    []string{oidc.GrantTypeRefreshToken},
+		"refresh_token": []string{refreshToken},
+		"client_id":     []string{clientID},
+		"client_secret": []string{clientSecret},
+	})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after DELETE: got status %v want %v: %s", rr.Code, http.StatusUnauthorized, rr.Body.String())
+	}
+	if response := provider.introspectToken(ctx, refreshToken, konnectoidc.TokenTypeHintRefreshToken); response.Active {
+		t.Errorf("refresh token of deleted client must not be active")
+	}
+}
+
+func TestAuthorizeJWTResponseModes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	// Successful authorize responses set an encrypted session cookie.
+	if err := provider.encryptionManager.SetKey(bytes.Repeat([]byte{0x42}, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trusted clients do not need consent.
+	provider.clients.Register(&clients.ClientRegistration{
+		ID:           "jarmclient",
+		Secret:       "jarmsecret",
+		Trusted:      true,
+		RedirectURIs: []string{"https://jarm.example.com/cb"},
+	})
+	provider.clients.Register(&clients.ClientRegistration{
+		ID:           "jarmalgclient",
+		Secret:       "jarmsecret",
+		Trusted:      true,
+		RedirectURIs: []string{"https://jarm.example.com/cb"},
+
+		RawAuthorizationSignedResponseAlg: jwt.SigningMethodRS256.Alg(),
+	})
+
+	modes := make(map[string]bool)
+	for _, mode := range provider.metadata.ResponseModesSupported {
+		modes[mode] = true
+	}
+	for _, mode := range []string{konnectoidc.ResponseModeJWT, konnectoidc.ResponseModeQueryJWT, konnectoidc.ResponseModeFragmentJWT, konnectoidc.ResponseModeFormPostJWT} {
+		if !modes[mode] {
+			t.Errorf("response mode %v is not advertised", mode)
+		}
+	}
+	if len(provider.metadata.AuthorizationSigningAlgValuesSupported) == 0 {
+		t.Errorf("AuthorizationSigningAlgValuesSupported must not be empty")
+	}
+
+	authorize := func(clientID string, redirectURI string, responseType string, responseMode string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"client_id":     {clientID},
+			"redirect_uri":  {redirectURI},
+			"response_type": {responseType},
+			"response_mode": {responseMode},
+			"scope":         {"openid"},
+			"state":         {"test-state"},
+			"nonce":         {"test-nonce"},
+		}
+		req := httptest.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+query.Encode(), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	parseResponse := func(response string, alg string, audience string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(response, claims, func(token *jwt.Token) (interface{}, error) {
+			return rsaPrivateKey.Public(), nil
+		})
+		if err != nil {
+			t.Fatalf("failed to parse response JWT: %v", err)
+		}
+		if token.Method.Alg() != alg {
+			t.Errorf("response JWT alg got %v want %v", token.Method.Alg(), alg)
+		}
+		if claims[oidc.IssuerIdentifierClaim] != config.IssuerIdentifier {
+			t.Errorf("response JWT iss got %v want %v", claims[oidc.IssuerIdentifierClaim], config.IssuerIdentifier)
+		}
+		if claims[oidc.AudienceClaim] != audience {
+			t.Errorf("response JWT aud got %v want %v", claims[oidc.AudienceClaim], audience)
+		}
+		if _, ok := claims[oidc.ExpirationClaim]; !ok {
+			t.Errorf("response JWT has no exp claim")
+		}
+		if claims["state"] != "test-state" {
+			t.Errorf("response JWT state got %v want %v", claims["state"], "test-state")
+		}
+		return claims
+	}
+
+	defaultAlg := provider.signingMethodDefault.Alg()
+
+	for _, test := range []struct {
+		name         string
+		clientID     string
+		redirectURI  string
+		responseType string
+		responseMode string
+		alg          string
+		fragment     bool
+		formPost     bool
+	}{
+		{"query.jwt", "jarmclient", "https://jarm.example.com/cb", oidc.ResponseTypeCode, konnectoidc.ResponseModeQueryJWT, defaultAlg, false, false},
+		{"jwt with code flow", "jarmclient", "https://jarm.example.com/cb", oidc.ResponseTypeCode, konnectoidc.ResponseModeJWT, defaultAlg, false, false},
+		{"jwt with implicit flow", "jarmclient", "https://jarm.example.com/cb", oidc.ResponseTypeIDToken, konnectoidc.ResponseModeJWT, defaultAlg, true, false},
+		{"fragment.jwt", "jarmclient", "https://jarm.example.com/cb", oidc.ResponseTypeCode, konnectoidc.ResponseModeFragmentJWT, defaultAlg, true, false},
+		{"form_post.jwt", "jarmclient", "https://jarm.example.com/cb", oidc.ResponseTypeCode, konnectoidc.ResponseModeFormPostJWT, defaultAlg, false, true},
+		{"client authorization_signed_response_alg", "jarmalgclient", "https://jarm.example.com/cb", oidc.ResponseTypeCode, konnectoidc.ResponseModeQueryJWT, jwt.SigningMethodRS256.Alg(), false, false},
+	} {
+		rr := authorize(test.clientID, test.redirectURI, test.responseType, test.responseMode)
+
+		var response string
+		var values url.Values
+		if test.formPost {
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s: got status %v want %v: %s", test.name, rr.Code, http.StatusOK, rr.Body.String())
+			}
+			body := rr.Body.String()
+			if !strings.Contains(body, `action="`+test.redirectURI+`"`) {
+				t.Errorf("%s: form does not post to the redirect URI: %s", test.name, body)
+			}
+			marker := `name="response" value="`
+			idx := strings.Index(body, marker)
+			if idx < 0 {
+				t.Fatalf("%s: form has no response value: %s", test.name, body)
+			}
+			response = body[idx+len(marker):]
+			response = response[:strings.Index(response, `"`)]
+		} else {
+			if rr.Code != http.StatusFound {
+				t.Fatalf("%s: got status %v want %v: %s", test.name, rr.Code, http.StatusFound, rr.Body.String())
+			}
+			location, err := url.Parse(rr.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("%s: invalid location: %v", test.name, err)
+			}
+			if test.fragment {
+				if location.RawQuery != "" {
+					t.Errorf("%s: response must not be in the query: %v", test.name, location)
+				}
+				values, _ = url.ParseQuery(location.Fragment)
+			} else {
+				if location.Fragment != "" {
+					t.Errorf("%s: response must not be in the fragment: %v", test.name, location)
+				}
+				values = location.Query()
+			}
+			if len(values) != 1 {
+				t.Errorf("%s: response params must only hold the response JWT, got %v", test.name, values)
+			}
+			response = values.Get("response")
+		}
+
+		claims := parseResponse(response, test.alg, test.clientID)
+		switch test.responseType {
+		case oidc.ResponseTypeCode:
+			if code, _ := claims["code"].(string); code == "" {
+				t.Errorf("%s: response JWT has no code", test.name)
+			}
+		case oidc.ResponseTypeIDToken:
+			if idToken, _ := claims["id_token"].(string); idToken == "" {
+				t.Errorf("%s: response JWT has no id_token", test.name)
+			}
+		}
+	}
+
+	// Errors are delivered in the response JWT as well.
+	rr := authorize("jarmclient", "https://jarm.example.com/cb", "unsupported", konnectoidc.ResponseModeQueryJWT)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("error: got status %v want %v: %s", rr.Code, http.StatusFound, rr.Body.String())
+	}
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	claims := parseResponse(location.Query().Get("response"), defaultAlg, "jarmclient")
+	if claims["error"] == nil {
+		t.Errorf("error: response JWT has no error claim: %v", claims)
+	}
+
+	// Tokens must not be sent in the query.
+	rr = authorize("jarmclient", "https://jarm.example.com/cb", oidc.ResponseTypeIDToken, konnectoidc.ResponseModeQueryJWT)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("query.jwt with implicit flow: got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
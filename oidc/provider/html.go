@@ -185,3 +185,73 @@ c.u(b.B());c.u(n.substr(0,64-(d.f[1]+8&63)));c.c(d.f[0]<<3|d.f[0]>>>28);c.c(d.f[
 </body>
 </html>
 `))
+
+var formPostTemplate = template.Must(template.New("form-post.html").Parse(`
+<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Submit this form</title>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+{{- range $key, $values := .Values}}{{range $values}}
+<input type="hidden" name="{{$key}}" value="{{.}}">
+{{- end}}{{end}}
+<noscript>
+  <button type="submit">Continue</button>
+</noscript>
+</form>
+<script type="text/javascript" nonce={{.Nonce}}>
+// This implements OAuth 2.0 Form Post Response Mode as specified in
+// https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+document.forms[0].submit();
+</script>
+</body>
+</html>
+`))
+
+var frontChannelLogoutTemplate = template.Must(template.New("frontchannel-logout.html").Parse(`
+<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Signing out</title>
+</head>
+<body>
+{{- range .LogoutURIs}}
+<iframe hidden src="{{.}}"></iframe>
+{{- end}}
+{{- if .ContinueURI}}
+<noscript>
+  <a href="{{.ContinueURI}}">Continue</a>
+</noscript>
+{{- else}}
+<p>You have been signed out.</p>
+{{- end}}
+<script type="text/javascript" nonce={{.Nonce}}>
+// This implements OpenID Connect Front-Channel Logout 1.0 OP logout as
+// specified in https://openid.net/specs/openid-connect-frontchannel-1_0.html#OPLogout
+(function() {
+	var continueURI = {{.ContinueURI}};
+	if (!continueURI) {
+		return;
+	}
+
+	var done = false;
+	function next() {
+		if (done) {
+			return;
+		}
+		done = true;
+		window.location.replace(continueURI);
+	}
+
+	// Continue when all logout frames are loaded, or after a timeout.
+	window.addEventListener('load', next, false);
+	window.setTimeout(next, 5000);
+})();
+</script>
+</body>
+</html>
+`))
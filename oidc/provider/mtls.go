@@ -0,0 +1,182 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	"stash.kopano.io/kc/konnect/utils"
+)
+
+// getClientCertificates returns the TLS client certificate chain of the
+// provided request. The certificates are taken from the TLS connection or
+// from the configured client certificate header if the request was sent by a
+// trusted proxy. Returns nil, if the request has no client certificate.
+func (p *Provider) getClientCertificates(req *http.Request) []*x509.Certificate {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		return req.TLS.PeerCertificates
+	}
+
+	header := p.Config.Config.TLSClientCertHeader
+	if header == "" {
+		return nil
+	}
+	value := req.Header.Get(header)
+	if value == "" {
+		return nil
+	}
+	if trusted, _ := utils.IsRequestFromTrustedSource(req, p.Config.Config.TrustedProxyIPs, p.Config.Config.TrustedProxyNets); !trusted {
+		p.logger.WithField("remote", req.RemoteAddr).Warnln("ignoring TLS client certificate header from untrusted source")
+		return nil
+	}
+
+	// NOTE(longsleep): Proxies send the PEM URL encoded, like the
+	// $ssl_client_escaped_cert variable of nginx.
+	pemString, err := url.PathUnescape(value)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to decode TLS client certificate header")
+		return nil
+	}
+	var certificates []*x509.Certificate
+	var block *pem.Block
+	rest := []byte(pemString)
+	for {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, parseErr := x509.ParseCertificate(block.Bytes)
+		if parseErr != nil {
+			p.logger.WithError(parseErr).Debugln("failed to parse TLS client certificate from header")
+			return nil
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates
+}
+
+// getClientCAs returns the configured certificate pool to validate TLS client
+// certificates of tls_client_auth clients. Returns nil, if none is configured.
+func (p *Provider) getClientCAs() *x509.CertPool {
+	if p.Config.Config.TLSConfig == nil {
+		return nil
+	}
+
+	return p.Config.Config.TLSConfig.ClientCAs
+}
+
+// validateClientTLSClientAuth validates the mutual TLS related metadata of
+// the provided client registration.
+func (p *Provider) validateClientTLSClientAuth(registration *clients.ClientRegistration) error {
+	if registration.RawTokenEndpointAuthMethod == konnectoidc.AuthMethodTLSClientAuth && p.getClientCAs() == nil {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "tls_client_auth requires a configured TLS client CA")
+	}
+
+	return nil
+}
+
+// validateClientCertificates validates the provided TLS client certificate
+// chain for the client with the provided clientID as specified at
+// https://tools.ietf.org/html/rfc8705#section-2 and returns the client
+// authentication method which was used. An empty method is returned without
+// error if the client is not registered for mutual TLS authentication.
+func (p *Provider) validateClientCertificates(ctx context.Context, clientID string, certificates []*x509.Certificate) (string, error) {
+	if clientID == "" {
+		return "", nil
+	}
+	registration, _ := p.clients.Get(ctx, clientID)
+	if registration == nil {
+		return "", fmt.Errorf("unknown client")
+	}
+
+	switch registration.RawTokenEndpointAuthMethod {
+	case konnectoidc.AuthMethodTLSClientAuth:
+		// Never fall back to the system roots, since any publicly trusted
+		// certificate would then be accepted.
+		roots := p.getClientCAs()
+		if roots == nil {
+			return "", fmt.Errorf("no TLS client CA configured")
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		for _, certificate := range certificates[1:] {
+			opts.Intermediates.AddCert(certificate)
+		}
+		if _, err := certificates[0].Verify(opts); err != nil {
+			return "", fmt.Errorf("client certificate is not trusted: %v", err)
+		}
+		if !registration.MatchTLSClientCertificate(certificates[0]) {
+			return "", fmt.Errorf("client certificate does not match client registration")
+		}
+
+	case konnectoidc.AuthMethodSelfSignedTLSClientAuth:
+		if !registration.MatchSelfSignedTLSClientCertificate(certificates[0]) {
+			return "", fmt.Errorf("client certificate does not match client registration keys")
+		}
+
+	default:
+		return "", nil
+	}
+
+	return registration.RawTokenEndpointAuthMethod, nil
+}
+
+// makeCertificateThumbprint returns the x5t#S256 thumbprint of the provided
+// certificate as specified at https://tools.ietf.org/html/rfc8705#section-3.1
+func makeCertificateThumbprint(certificate *x509.Certificate) string {
+	thumbprint := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:])
+}
+
+// validateCertificateConfirmation validates that the TLS client certificate
+// of the provided request matches the certificate the provided access token
+// claims are bound to.
+func (p *Provider) validateCertificateConfirmation(req *http.Request, claims *konnect.AccessTokenClaims) error {
+	if claims.Confirmation == nil || claims.Confirmation.X5TS256 == "" {
+		return nil
+	}
+
+	certificates := p.getClientCertificates(req)
+	if len(certificates) == 0 {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "certificate bound access token requires TLS client certificate")
+	}
+	if makeCertificateThumbprint(certificates[0]) != claims.Confirmation.X5TS256 {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "TLS client certificate does not match access token")
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+)
+
+func makeTestCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.DNSNames = []string{commonName}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate, key
+}
+
+func TestValidateClientCertificatesRequiresClientCA(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, cfg := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	ca, caKey := makeTestCertificate(t, "Test CA", nil, nil)
+	otherCA, otherCAKey := makeTestCertificate(t, "Other CA", nil, nil)
+	certificate, _ := makeTestCertificate(t, "mtls.example.com", ca, caKey)
+	otherCertificate, _ := makeTestCertificate(t, "mtls.example.com", otherCA, otherCAKey)
+
+	registration := &clients.ClientRegistration{
+		ID:                         "mtlsclient",
+		RedirectURIs:               []string{"https://mtls.example.com/cb"},
+		RawTokenEndpointAuthMethod: konnectoidc.AuthMethodTLSClientAuth,
+		TLSClientAuthSANDNS:        "mtls.example.com",
+	}
+	if err := provider.clients.Register(registration); err != nil {
+		t.Fatal(err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	tests := []struct {
+		name        string
+		clientCAs   *x509.CertPool
+		certificate *x509.Certificate
+		valid       bool
+	}{
+		{"no client CA", nil, certificate, false},
+		{"trusted CA", clientCAs, certificate, true},
+		{"untrusted CA", clientCAs, otherCertificate, false},
+	}
+	for _, test := range tests {
+		cfg.Config.TLSConfig = &tls.Config{
+			ClientCAs: test.clientCAs,
+		}
+		authMethod, err := provider.validateClientCertificates(ctx, registration.ID, []*x509.Certificate{test.certificate})
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got valid %v want %v: %v", test.name, valid, test.valid, err)
+		}
+		if test.valid && authMethod != konnectoidc.AuthMethodTLSClientAuth {
+			t.Errorf("%s: got auth method %q want %q", test.name, authMethod, konnectoidc.AuthMethodTLSClientAuth)
+		}
+		if validErr := provider.validateClientTLSClientAuth(registration); (validErr == nil) != (test.clientCAs != nil) {
+			t.Errorf("%s: unexpected registration validation result: %v", test.name, validErr)
+		}
+	}
+}
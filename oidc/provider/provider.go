@@ -29,10 +29,12 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-querystring/query"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ed25519"
 	"stash.kopano.io/kgol/oidc-go"
+	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect"
 	"stash.kopano.io/kc/konnect/identity"
@@ -41,16 +43,38 @@ import (
 	"stash.kopano.io/kc/konnect/managers"
 	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 	"stash.kopano.io/kc/konnect/oidc/code"
+	"stash.kopano.io/kc/konnect/oidc/device"
+	"stash.kopano.io/kc/konnect/oidc/par"
+	"stash.kopano.io/kc/konnect/oidc/refresh"
+	"stash.kopano.io/kc/konnect/oidc/revocation"
+	"stash.kopano.io/kc/konnect/oidc/session"
 	"stash.kopano.io/kc/konnect/signing"
 	"stash.kopano.io/kc/konnect/utils"
 )
 
+var (
+	// tokenCORS allows browser based clients to send DPoP proofs to the token
+	// endpoint and to read the DPoP nonces returned by it.
+	tokenCORS = cors.New(cors.Options{
+		AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", konnectoidc.DPoPHeader},
+		ExposedHeaders: []string{konnectoidc.DPoPNonceHeader},
+	})
+	// userInfoCORS allows all like cors.AllowAll, but additionally lets browser
+	// based clients read DPoP nonces and authentication errors.
+	userInfoCORS = cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodHead, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{konnectoidc.DPoPNonceHeader, "WWW-Authenticate"},
+	})
+)
+
 // Provider defines an OIDC provider with the handlers for the OIDC endpoints.
 type Provider struct {
 	Config *Config
 
 	issuerIdentifier string
-	metadata         *oidc.WellKnown
+	metadata         *konnectoidc.WellKnown
 
 	wellKnownPath          string
 	jwksPath               string
@@ -60,12 +84,27 @@ type Provider struct {
 	endSessionPath         string
 	checkSessionIframePath string
 	registrationPath       string
+	introspectionPath      string
+	revocationPath         string
+
+	deviceAuthorizationPath string
+	deviceVerificationURI   string
+
+	pushedAuthorizationRequestPath string
+
+	authorizationServerMetadataPaths map[string]bool
 
 	identityManager   identity.Manager
 	guestManager      identity.Manager
 	codeManager       code.Manager
+	revocationManager revocation.Manager
+	deviceManager     device.Manager
+	parManager        par.Manager
+	sessionManager    session.Manager
+	refreshManager    refresh.Manager
 	encryptionManager *identityManagers.EncryptionManager
 	clients           *clients.Registry
+	replayCache       *replayCache
 
 	signingKeys          map[jwt.SigningMethod]*SigningKey
 	signingMethodDefault jwt.SigningMethod
@@ -80,6 +119,11 @@ type Provider struct {
 	accessTokenDuration  time.Duration
 	idTokenDuration      time.Duration
 	refreshTokenDuration time.Duration
+	refreshTokenRotation bool
+	accessTokenProfile   string
+	signMetadata         bool
+
+	httpClient *http.Client
 
 	logger logrus.FieldLogger
 }
@@ -89,6 +133,8 @@ func NewProvider(c *Config) (*Provider, error) {
 	p := &Provider{
 		Config: c,
 
+		authorizationServerMetadataPaths: make(map[string]bool),
+
 		issuerIdentifier:       c.IssuerIdentifier,
 		wellKnownPath:          c.WellKnownPath,
 		jwksPath:               c.JwksPath,
@@ -98,10 +144,19 @@ func NewProvider(c *Config) (*Provider, error) {
 		endSessionPath:         c.EndSessionPath,
 		checkSessionIframePath: c.CheckSessionIframePath,
 		registrationPath:       c.RegistrationPath,
+		introspectionPath:      c.IntrospectionPath,
+		revocationPath:         c.RevocationPath,
+
+		deviceAuthorizationPath: c.DeviceAuthorizationPath,
+		deviceVerificationURI:   c.DeviceVerificationURI,
+
+		pushedAuthorizationRequestPath: c.PushedAuthorizationRequestPath,
 
 		signingKeys:    make(map[jwt.SigningMethod]*SigningKey),
 		validationKeys: make(map[string]crypto.PublicKey),
 
+		replayCache: newReplayCache(),
+
 		browserStateCookiePath: c.BrowserStateCookiePath,
 		browserStateCookieName: c.BrowserStateCookieName,
 
@@ -111,10 +166,22 @@ func NewProvider(c *Config) (*Provider, error) {
 		accessTokenDuration:  c.AccessTokenDuration,
 		idTokenDuration:      c.IDTokenDuration,
 		refreshTokenDuration: c.RefreshTokenDuration,
+		refreshTokenRotation: c.RefreshTokenRotation,
+		accessTokenProfile:   c.AccessTokenProfile,
+		signMetadata:         c.SignMetadata,
+
+		httpClient: &http.Client{
+			Transport: c.Config.HTTPTransport,
+			Timeout:   backChannelLogoutTimeout,
+		},
 
 		logger: c.Config.Logger,
 	}
 
+	for _, path := range c.AuthorizationServerMetadataPaths {
+		p.authorizationServerMetadataPaths[path] = true
+	}
+
 	return p, nil
 }
 
@@ -122,6 +189,11 @@ func NewProvider(c *Config) (*Provider, error) {
 func (p *Provider) RegisterManagers(mgrs *managers.Managers) error {
 	p.identityManager = mgrs.Must("identity").(identity.Manager)
 	p.codeManager = mgrs.Must("code").(code.Manager)
+	p.revocationManager = mgrs.Must("revocation").(revocation.Manager)
+	p.deviceManager = mgrs.Must("device").(device.Manager)
+	p.parManager = mgrs.Must("par").(par.Manager)
+	p.sessionManager = mgrs.Must("session").(session.Manager)
+	p.refreshManager = mgrs.Must("refresh").(refresh.Manager)
 	p.encryptionManager = mgrs.Must("encryption").(*identityManagers.EncryptionManager)
 	p.clients = mgrs.Must("clients").(*clients.Registry)
 
@@ -151,6 +223,9 @@ func (p *Provider) RegisterManagers(mgrs *managers.Managers) error {
 	}
 	p.identityManager.OnSetLogon(onSetLogon)
 	p.identityManager.OnUnsetLogon(onUnsetLogon)
+	if identityManager, ok := p.identityManager.(identity.ManagerWithLogonSessions); ok {
+		identityManager.OnRevokeLogonSession(p.endLogonSession)
+	}
 
 	// Add guest manager if any can be found.
 	if guestManager, _ := mgrs.Get("guest"); guestManager != nil {
@@ -179,6 +254,16 @@ func (p *Provider) makeIssURL(path string) string {
 	return fmt.Sprintf("%s%s", u.String(), path)
 }
 
+// makeRegistrationClientURI returns the registration client URI of the client
+// with the provided client ID as specified at
+// https://tools.ietf.org/html/rfc7592#section-3.
+func (p *Provider) makeRegistrationClientURI(clientID string) string {
+	query := url.Values{}
+	query.Set("client_id", clientID)
+
+	return p.makeIssURL(p.registrationPath) + "?" + query.Encode()
+}
+
 // SetSigningMethod sets the provided signing method as default signing method
 // of the associated provider.
 func (p *Provider) SetSigningMethod(signingMethod jwt.SigningMethod) error {
@@ -361,7 +446,7 @@ func (p *Provider) getValidationKey(id string) (crypto.PublicKey, bool) {
 // this once all other settings at the provider have been done.
 func (p *Provider) InitializeMetadata() error {
 	// Create well-known document.
-	p.metadata = &oidc.WellKnown{
+	p.metadata = &konnectoidc.WellKnown{WellKnown: &oidc.WellKnown{
 		Issuer:                p.issuerIdentifier,
 		AuthorizationEndpoint: p.makeIssURL(p.authorizationPath),
 		TokenEndpoint:         p.makeIssURL(p.tokenPath),
@@ -389,16 +474,46 @@ func (p *Provider) InitializeMetadata() error {
 			oidc.AudienceClaim,
 			oidc.ExpirationClaim,
 			oidc.IssuedAtClaim,
+			konnectoidc.ACRClaim,
+			konnectoidc.AMRClaim,
 		}, p.identityManager.ClaimsSupported(nil)...)),
 		RequestParameterSupported:    true,
 		RequestURIParameterSupported: false,
-	}
+	}}
 
 	p.metadata.IDTokenSigningAlgValuesSupported = make([]string, 0)
 	for alg := range p.signingKeys {
 		p.metadata.IDTokenSigningAlgValuesSupported = append(p.metadata.IDTokenSigningAlgValuesSupported, alg.Alg())
 	}
 	p.metadata.UserInfoSigningAlgValuesSupported = p.metadata.IDTokenSigningAlgValuesSupported
+	p.metadata.AuthorizationSigningAlgValuesSupported = p.metadata.IDTokenSigningAlgValuesSupported
+	p.metadata.BackChannelLogoutSupported = true
+	p.metadata.BackChannelLogoutSessionSupported = true
+	p.metadata.FrontChannelLogoutSupported = true
+	p.metadata.FrontChannelLogoutSessionSupported = true
+	p.metadata.UserInfoEncryptionAlgValuesSupported = konnectoidc.EncryptionAlgValuesSupported
+	p.metadata.UserInfoEncryptionEncValuesSupported = konnectoidc.EncryptionEncValuesSupported
+	p.metadata.DPoPSigningAlgValuesSupported = []string{
+		jwt.SigningMethodES256.Alg(),
+		jwt.SigningMethodES384.Alg(),
+		jwt.SigningMethodES512.Alg(),
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodRS384.Alg(),
+		jwt.SigningMethodRS512.Alg(),
+		jwt.SigningMethodPS256.Alg(),
+		jwt.SigningMethodPS384.Alg(),
+		jwt.SigningMethodPS512.Alg(),
+		signing.SigningMethodEdDSA.Alg(),
+	}
+	p.metadata.ResponseModesSupported = []string{
+		oidc.ResponseModeQuery,
+		oidc.ResponseModeFragment,
+		konnectoidc.ResponseModeFormPost,
+		konnectoidc.ResponseModeJWT,
+		konnectoidc.ResponseModeQueryJWT,
+		konnectoidc.ResponseModeFragmentJWT,
+		konnectoidc.ResponseModeFormPostJWT,
+	}
 	p.metadata.RequestObjectSigningAlgValuesSupported = []string{
 		jwt.SigningMethodES256.Alg(),
 		jwt.SigningMethodES384.Alg(),
@@ -412,11 +527,89 @@ func (p *Provider) InitializeMetadata() error {
 		jwt.SigningMethodNone.Alg(),
 		signing.SigningMethodEdDSA.Alg(),
 	}
+	if p.clients.PairwiseSubjectsSupported() {
+		p.metadata.SubjectTypesSupported = append(p.metadata.SubjectTypesSupported, oidc.SubjectIDPairwise)
+	}
+	// Client authentication with client_secret_jwt is not advertised, since it
+	// is only possible for configured clients with a clear text secret.
 	p.metadata.TokenEndpointAuthMethodsSupported = []string{
 		oidc.AuthMethodClientSecretBasic,
+		konnectoidc.AuthMethodClientSecretPost,
+		konnectoidc.AuthMethodPrivateKeyJWT,
 		oidc.AuthMethodNone,
 	}
-	p.metadata.TokenEndpointAuthSigningAlgValuesSupported = p.metadata.IDTokenSigningAlgValuesSupported
+	if p.Config.Config.TLSListenAddr != "" || p.Config.Config.TLSClientCertHeader != "" {
+		// Mutual TLS is only possible when client certificates can reach us,
+		// and PKI based tls_client_auth additionally requires a client CA.
+		if p.getClientCAs() != nil {
+			p.metadata.TokenEndpointAuthMethodsSupported = append(p.metadata.TokenEndpointAuthMethodsSupported,
+				konnectoidc.AuthMethodTLSClientAuth,
+			)
+		}
+		p.metadata.TokenEndpointAuthMethodsSupported = append(p.metadata.TokenEndpointAuthMethodsSupported,
+			konnectoidc.AuthMethodSelfSignedTLSClientAuth,
+		)
+		p.metadata.TLSClientCertificateBoundAccessTokens = true
+	}
+	p.metadata.TokenEndpointAuthSigningAlgValuesSupported = []string{
+		jwt.SigningMethodES256.Alg(),
+		jwt.SigningMethodES384.Alg(),
+		jwt.SigningMethodES512.Alg(),
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodRS384.Alg(),
+		jwt.SigningMethodRS512.Alg(),
+		jwt.SigningMethodPS256.Alg(),
+		jwt.SigningMethodPS384.Alg(),
+		jwt.SigningMethodPS512.Alg(),
+		signing.SigningMethodEdDSA.Alg(),
+	}
+	p.metadata.GrantTypesSupported = []string{
+		oidc.GrantTypeAuthorizationCode,
+		oidc.GrantTypeImplicit,
+		oidc.GrantTypeRefreshToken,
+		konnectoidc.GrantTypeClientCredentials,
+		konnectoidc.GrantTypeTokenExchange,
+	}
+
+	if p.introspectionPath != "" {
+		p.metadata.IntrospectionEndpoint = p.makeIssURL(p.introspectionPath)
+		// Clients authenticate like at the token endpoint, but must not be
+		// public clients.
+		p.metadata.IntrospectionEndpointAuthMethodsSupported = []string{}
+		for _, authMethod := range p.metadata.TokenEndpointAuthMethodsSupported {
+			if authMethod != oidc.AuthMethodNone {
+				p.metadata.IntrospectionEndpointAuthMethodsSupported = append(p.metadata.IntrospectionEndpointAuthMethodsSupported, authMethod)
+			}
+		}
+	}
+	if p.revocationPath != "" {
+		p.metadata.RevocationEndpoint = p.makeIssURL(p.revocationPath)
+		// Clients authenticate like at the token endpoint.
+		p.metadata.RevocationEndpointAuthMethodsSupported = p.metadata.TokenEndpointAuthMethodsSupported
+	}
+	if p.deviceAuthorizationPath != "" {
+		p.metadata.DeviceAuthorizationEndpoint = p.makeIssURL(p.deviceAuthorizationPath)
+		p.metadata.GrantTypesSupported = append(p.metadata.GrantTypesSupported, konnectoidc.GrantTypeDeviceCode)
+	}
+	if p.pushedAuthorizationRequestPath != "" {
+		p.metadata.PushedAuthorizationRequestEndpoint = p.makeIssURL(p.pushedAuthorizationRequestPath)
+	}
+	p.metadata.CodeChallengeMethodsSupported = []string{
+		oidc.S256CodeChallengeMethod,
+	}
+	p.metadata.ACRValuesSupported = []string{
+		konnectoidc.ACRValueNone,
+		konnectoidc.ACRValueSingleFactor,
+	}
+
+	// Sign all metadata values as specified at https://tools.ietf.org/html/rfc8414#section-2.1.
+	if p.signMetadata {
+		signedMetadata, err := p.makeSignedMetadata(p.metadata)
+		if err != nil {
+			return fmt.Errorf("failed to sign metadata: %v", err)
+		}
+		p.metadata.SignedMetadata = signedMetadata
+	}
 
 	return nil
 }
@@ -426,21 +619,31 @@ func (p *Provider) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	switch path := req.URL.Path; {
 	case path == p.wellKnownPath:
 		cors.Default().ServeHTTP(rw, req, p.WellKnownHandler)
+	case p.authorizationServerMetadataPaths[path]:
+		cors.Default().ServeHTTP(rw, req, p.WellKnownHandler)
 	case path == p.jwksPath:
 		cors.Default().ServeHTTP(rw, req, p.JwksHandler)
 	case path == p.authorizationPath:
 		p.AuthorizeHandler(rw, req)
 	case path == p.tokenPath:
-		cors.Default().ServeHTTP(rw, req, p.TokenHandler)
+		tokenCORS.ServeHTTP(rw, req, p.TokenHandler)
 	case path == p.userInfoPath:
 		// TODO(longsleep): Use more strict CORS.
-		cors.AllowAll().ServeHTTP(rw, req, p.UserInfoHandler)
+		userInfoCORS.ServeHTTP(rw, req, p.UserInfoHandler)
 	case path == p.endSessionPath:
 		p.EndSessionHandler(rw, req)
 	case path == p.checkSessionIframePath:
 		p.CheckSessionIframeHandler(rw, req)
 	case path == p.registrationPath:
 		p.RegistrationHandler(rw, req)
+	case path == p.introspectionPath:
+		p.IntrospectionHandler(rw, req)
+	case path == p.revocationPath:
+		p.RevocationHandler(rw, req)
+	case path == p.deviceAuthorizationPath:
+		p.DeviceAuthorizationHandler(rw, req)
+	case path == p.pushedAuthorizationRequestPath:
+		p.PushedAuthorizationRequestHandler(rw, req)
 	default:
 		http.NotFound(rw, req)
 	}
@@ -462,6 +665,39 @@ func (p *Provider) Found(rw http.ResponseWriter, uri *url.URL, params interface{
 	}
 }
 
+// FormPost writes a HTML page to the provided http.ResponseWriter which
+// auto-submits the provided params to the provided uri with a HTTP POST.
+func (p *Provider) FormPost(rw http.ResponseWriter, uri *url.URL, params interface{}) {
+	values, err := query.Values(params)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to encode form post values")
+		p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	nonce := rndm.GenerateRandomString(32)
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("X-XSS-Protection", "1; mode=block")
+	rw.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; script-src 'nonce-%s'", nonce))
+
+	data := struct {
+		Action string
+		Values url.Values
+		Nonce  string
+	}{
+		Action: uri.String(),
+		Values: values,
+		Nonce:  nonce,
+	}
+	err = formPostTemplate.Execute(rw, data)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to write to response")
+	}
+}
+
 // LoginRequiredPage writes a HTTP 30 to the provided ResponseWrite with the
 // URL of the provided request (set to the scheme and host of issuer) as
 // continue parameter.
@@ -492,20 +728,27 @@ func (p *Provider) GetAccessTokenClaimsFromRequest(req *http.Request) (*konnect.
 
 	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
 	switch auth[0] {
-	case oidc.TokenTypeBearer:
+	case oidc.TokenTypeBearer, konnectoidc.TokenTypeDPoP:
 		if len(auth) != 2 {
-			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "Invalid Bearer authorization header format")
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, fmt.Sprintf("Invalid %s authorization header format", auth[0]))
 			break
 		}
-		claims = &konnect.AccessTokenClaims{}
-		_, err = jwt.ParseWithClaims(auth[1], claims, func(token *jwt.Token) (interface{}, error) {
-			// Validator for incoming access tokens, looks up key.
-			return p.validateJWT(token)
-		})
+		claims, err = p.parseAccessToken(auth[1])
 		if err != nil {
 			// Wrap as OAuth2 error.
 			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, err.Error())
+			break
+		}
+		if p.revocationManager.IsRevoked(claims.Id) {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "token has been revoked")
+			break
+		}
+		// Ensure sender constrained access tokens are used by their sender.
+		err = p.validateDPoPConfirmation(req, auth[0], auth[1], claims)
+		if err != nil {
+			break
 		}
+		err = p.validateCertificateConfirmation(req, claims)
 
 	default:
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "Bearer authorization required")
@@ -26,6 +26,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -36,6 +37,12 @@ import (
 	"stash.kopano.io/kc/konnect/identity/clients"
 	identityManagers "stash.kopano.io/kc/konnect/identity/managers"
 	codeManagers "stash.kopano.io/kc/konnect/oidc/code/managers"
+	consentManagers "stash.kopano.io/kc/konnect/oidc/consent/managers"
+	deviceManagers "stash.kopano.io/kc/konnect/oidc/device/managers"
+	parManagers "stash.kopano.io/kc/konnect/oidc/par/managers"
+	refreshManagers "stash.kopano.io/kc/konnect/oidc/refresh/managers"
+	revocationManagers "stash.kopano.io/kc/konnect/oidc/revocation/managers"
+	sessionManagers "stash.kopano.io/kc/konnect/oidc/session/managers"
 )
 
 var logger = &logrus.Logger{
@@ -56,6 +63,11 @@ iL15eI5KhPbmAaTZBrhZ1l9MkpCrwGTjD4zOPUqD9A==
 
 var rsaPrivateKey crypto.Signer
 
+const (
+	testClientID     = "testclient"
+	testClientSecret = "testsecret"
+)
+
 func init() {
 	block, _ := pem.Decode(rsaPrivateKeyBytes)
 	rsaPrivateKey, _ = x509.ParsePKCS1PrivateKey(block.Bytes)
@@ -68,9 +80,25 @@ func NewTestProvider(ctx context.Context, t *testing.T) (*httptest.Server, *Prov
 		"unittestuser",
 	))
 	mgrs.Set("code", codeManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("revocation", revocationManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("device", deviceManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("par", parManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("session", sessionManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("refresh", refreshManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("consent", consentManagers.NewMemoryMapManager(ctx))
 	encryptionManager, _ := identityManagers.NewEncryptionManager(nil)
 	mgrs.Set("encryption", encryptionManager)
-	mgrs.Set("clients", &clients.Registry{})
+	clientRegistry, _ := clients.NewRegistry(ctx, nil, "", logger)
+	clientRegistry.Register(&clients.ClientRegistration{
+		ID:           testClientID,
+		Secret:       testClientSecret,
+		RedirectURIs: []string{"https://client.example.com/cb"},
+	})
+	mgrs.Set("clients", clientRegistry)
+	err := mgrs.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	cfg := &Config{
 		Config: &config.Config{
@@ -83,6 +111,18 @@ func NewTestProvider(ctx context.Context, t *testing.T) (*httptest.Server, *Prov
 		AuthorizationPath: "/konnect/v1/authorize",
 		TokenPath:         "/konnect/v1/token",
 		UserInfoPath:      "/konnect/v1/userinfo",
+		IntrospectionPath: "/konnect/v1/token/introspect",
+		RevocationPath:    "/konnect/v1/token/revoke",
+		RegistrationPath:  "/konnect/v1/register",
+
+		DeviceAuthorizationPath: "/konnect/v1/device",
+		DeviceVerificationURI:   "http://localhost:8777/signin/v1/device",
+
+		PushedAuthorizationRequestPath: "/konnect/v1/par",
+
+		AccessTokenDuration:  10 * time.Minute,
+		IDTokenDuration:      time.Hour,
+		RefreshTokenDuration: time.Hour,
 	}
 
 	p, err := NewProvider(cfg)
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+)
+
+const replayCachePurgeInterval = 5 * time.Minute
+
+// replayCache remembers the identifiers of one time use values like DPoP
+// proofs and client assertions until they are no longer accepted anyway, to
+// detect their replay. Its state is kept in memory only and expired entries
+// are purged lazily. The replayCache's methods are safe to call from multiple
+// Go routines.
+type replayCache struct {
+	table cmap.ConcurrentMap
+
+	mutex       sync.Mutex
+	nextPurgeAt time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{
+		table: cmap.New(),
+
+		nextPurgeAt: time.Now().Add(replayCachePurgeInterval),
+	}
+}
+
+// Use records the provided id until the provided expiration time and returns
+// true, if it has not been recorded before. Returns false, if the provided id
+// was already used and has not expired.
+func (rc *replayCache) Use(id string, expiresAt time.Time) bool {
+	now := time.Now()
+	rc.purgeExpired(now)
+
+	used := false
+	rc.table.Upsert(id, expiresAt, func(exist bool, valueInMap interface{}, newValue interface{}) interface{} {
+		if exist && valueInMap.(time.Time).After(now) {
+			used = true
+			return valueInMap
+		}
+		return newValue
+	})
+
+	return !used
+}
+
+func (rc *replayCache) purgeExpired(now time.Time) {
+	rc.mutex.Lock()
+	if now.Before(rc.nextPurgeAt) {
+		rc.mutex.Unlock()
+		return
+	}
+	rc.nextPurgeAt = now.Add(replayCachePurgeInterval)
+	rc.mutex.Unlock()
+
+	var expired []string
+	for entry := range rc.table.IterBuffered() {
+		if !entry.Val.(time.Time).After(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, id := range expired {
+		rc.table.Remove(id)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayCacheUse(t *testing.T) {
+	rc := newReplayCache()
+
+	tests := []struct {
+		id        string
+		expiresAt time.Time
+		ok        bool
+	}{
+		{"a", time.Now().Add(time.Minute), true},
+		{"a", time.Now().Add(time.Minute), false},
+		{"b", time.Now().Add(time.Minute), true},
+		{"expired", time.Now().Add(-time.Minute), true},
+		{"expired", time.Now().Add(time.Minute), true},
+		{"expired", time.Now().Add(time.Minute), false},
+	}
+	for idx, test := range tests {
+		if ok := rc.Use(test.id, test.expiresAt); ok != test.ok {
+			t.Errorf("%d: use of %q got %v want %v", idx, test.id, ok, test.ok)
+		}
+	}
+
+	// Force purge, only the expired entry is removed.
+	rc.Use("c", time.Now().Add(-time.Minute))
+	rc.nextPurgeAt = time.Now()
+	rc.purgeExpired(time.Now())
+	if count := rc.table.Count(); count != 3 {
+		t.Errorf("purge left %d entries, want 3", count)
+	}
+}
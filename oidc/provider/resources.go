@@ -0,0 +1,61 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"fmt"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+)
+
+// validateClientResources returns error if one of the provided resources is
+// not allowed for the provided client registration.
+func validateClientResources(registration *clients.ClientRegistration, resources []string) error {
+	for _, resource := range resources {
+		if registration == nil || !registration.IsAllowedResource(resource) {
+			return fmt.Errorf("resource not allowed for client: %s", resource)
+		}
+	}
+
+	return nil
+}
+
+// selectResources returns the requested resources if all of them have been
+// authorized before, or all authorized resources if none were requested. This
+// allows clients to narrow the audience of access tokens as specified at
+// https://tools.ietf.org/html/rfc8707#section-2.2.
+func selectResources(requested []string, authorized []string) ([]string, error) {
+	if len(requested) == 0 {
+		return authorized, nil
+	}
+
+	for _, resource := range requested {
+		found := false
+		for _, authorizedResource := range authorized {
+			if resource == authorizedResource {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("resource has not been authorized: %s", resource)
+		}
+	}
+
+	return requested, nil
+}
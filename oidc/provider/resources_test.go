@@ -0,0 +1,76 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"stash.kopano.io/kc/konnect/identity/clients"
+)
+
+func TestValidateClientResources(t *testing.T) {
+	registration := &clients.ClientRegistration{
+		AllowedResources: []string{"https://api1.example.com", "https://api2.example.com"},
+	}
+
+	tests := []struct {
+		registration *clients.ClientRegistration
+		resources    []string
+		valid        bool
+	}{
+		{registration, nil, true},
+		{registration, []string{"https://api1.example.com"}, true},
+		{registration, []string{"https://api1.example.com", "https://api2.example.com"}, true},
+		{registration, []string{"https://api1.example.com", "https://other.example.com"}, false},
+		{&clients.ClientRegistration{}, []string{"https://api1.example.com"}, false},
+		{nil, nil, true},
+		{nil, []string{"https://api1.example.com"}, false},
+	}
+	for idx, test := range tests {
+		err := validateClientResources(test.registration, test.resources)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%d: got valid %v want %v: %v", idx, valid, test.valid, err)
+		}
+	}
+}
+
+func TestSelectResources(t *testing.T) {
+	authorized := []string{"https://api1.example.com", "https://api2.example.com"}
+
+	tests := []struct {
+		requested []string
+		selected  []string
+		valid     bool
+	}{
+		{nil, authorized, true},
+		{[]string{"https://api2.example.com"}, []string{"https://api2.example.com"}, true},
+		{[]string{"https://other.example.com"}, nil, false},
+		{[]string{"https://api1.example.com", "https://other.example.com"}, nil, false},
+	}
+	for idx, test := range tests {
+		selected, err := selectResources(test.requested, authorized)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%d: got valid %v want %v: %v", idx, valid, test.valid, err)
+			continue
+		}
+		if strings.Join(selected, " ") != strings.Join(test.selected, " ") {
+			t.Errorf("%d: got %v want %v", idx, selected, test.selected)
+		}
+	}
+}
@@ -111,8 +111,8 @@ func (p *Provider) unserializeSession(value string) (*payload.Session, error) {
 	return &session, nil
 }
 
-func (p *Provider) getUserIDAndSessionRefFromClaims(claims *jwt.StandardClaims, identityClaims jwt.MapClaims) (string, *string) {
-	if claims == nil || identityClaims == nil {
+func (p *Provider) getUserIDAndSessionRefFromClaims(clientID string, identityClaims jwt.MapClaims) (string, *string) {
+	if identityClaims == nil {
 		return "", nil
 	}
 
@@ -128,5 +128,5 @@ func (p *Provider) getUserIDAndSessionRefFromClaims(claims *jwt.StandardClaims,
 	// NOTE(longsleep): Return the userID from claims and generate a session ref
 	// for it. Session refs use the userClaim if available and set by the
 	// underlaying backend.
-	return userIDClaim, identity.GetSessionRef(p.identityManager.Name(), claims.Audience, userClaim)
+	return userIDClaim, identity.GetSessionRef(p.identityManager.Name(), clientID, userClaim)
 }
@@ -18,19 +18,28 @@
 package provider
 
 import (
+	"context"
 	"errors"
 
+	"stash.kopano.io/kgol/oidc-go"
+
 	"stash.kopano.io/kc/konnect"
 	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
+
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 )
 
 // PublicSubjectFromAuth creates the provideds auth Subject value with the
-// accociated provider. This subject can be used as URL safe value to uniquely
-// identify the provided auth user with remote systems.
-func (p *Provider) PublicSubjectFromAuth(auth identity.AuthRecord) (string, error) {
+// accociated provider for the client identified by the provided client ID.
+// This subject can be used as URL safe value to uniquely identify the provided
+// auth user with remote systems. Clients registered with the pairwise subject
+// type receive a subject which is unique for their sector.
+func (p *Provider) PublicSubjectFromAuth(ctx context.Context, auth identity.AuthRecord, clientID string) (string, error) {
 	authorizedScopes := auth.AuthorizedScopes()
-	if ok, _ := authorizedScopes[konnect.ScopeRawSubject]; ok {
-		// Return raw subject as is when with ScopeRawSubject.
+	if ok, _ := authorizedScopes[konnect.ScopeRawSubject]; ok && !p.isPairwiseClient(ctx, clientID) {
+		// Return raw subject as is when with ScopeRawSubject. Pairwise clients
+		// never receive the raw subject.
 		user := auth.User()
 		if user == nil {
 			return "", errors.New("no user")
@@ -39,5 +48,50 @@ func (p *Provider) PublicSubjectFromAuth(auth identity.AuthRecord) (string, erro
 		return user.Raw(), nil
 	}
 
-	return auth.Subject(), nil
+	return p.clients.PublicSubject(ctx, clientID, auth.Subject())
+}
+
+// accessTokenSubject returns the sub claim value for access tokens issued to
+// the client identified by the provided client ID, so pairwise clients never
+// see the global subject. Tokens without user, like those of the client
+// credentials grant, have the client as subject which is kept as is.
+func (p *Provider) accessTokenSubject(ctx context.Context, clientID string, auth identity.AuthRecord) (string, error) {
+	if auth.Manager() == nil {
+		return auth.Subject(), nil
+	}
+
+	return p.clients.PublicSubject(ctx, clientID, auth.Subject())
+}
+
+// publicSubjectFunc returns a function which maps subjects to the subjects as
+// presented to the client identified by the provided client ID.
+func (p *Provider) publicSubjectFunc(ctx context.Context, clientID string) func(string) (string, error) {
+	return func(sub string) (string, error) {
+		return p.clients.PublicSubject(ctx, clientID, sub)
+	}
+}
+
+// isPairwiseClient returns true if the client identified by the provided
+// client ID is registered with the pairwise subject type.
+func (p *Provider) isPairwiseClient(ctx context.Context, clientID string) bool {
+	registration, _ := p.clients.Get(ctx, clientID)
+	return registration != nil && registration.SubjectType == oidc.SubjectIDPairwise
+}
+
+// validateClientSubjectType validates the subject type related metadata of
+// the provided client registration.
+func (p *Provider) validateClientSubjectType(ctx context.Context, registration *clients.ClientRegistration) error {
+	if registration.SubjectType == oidc.SubjectIDPairwise {
+		if !p.clients.PairwiseSubjectsSupported() {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, clients.ErrPairwiseSubjectsNotSupported.Error())
+		}
+		if _, err := registration.SectorIdentifier(); err != nil {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, err.Error())
+		}
+	}
+	if err := registration.ValidateSectorIdentifierURI(ctx); err != nil {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, err.Error())
+	}
+
+	return nil
 }
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"stash.kopano.io/kgol/oidc-go"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+)
+
+func TestPublicSubjectFromAuthWithRawSubjectScope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "pairwiseclient",
+		SubjectType:  oidc.SubjectIDPairwise,
+		RedirectURIs: []string{"https://pairwise.example.com/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = provider.clients.SetPairwiseSubjectSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := identity.NewAuthRecord(provider.identityManager, "unittestuser", map[string]bool{"openid": true, konnect.ScopeRawSubject: true}, nil, nil)
+	auth.SetUser(&testUser{id: "unittestuser"})
+
+	tests := []struct {
+		clientID string
+		raw      bool
+	}{
+		{testClientID, true},
+		{"pairwiseclient", false},
+	}
+	for _, test := range tests {
+		sub, err := provider.PublicSubjectFromAuth(ctx, auth, test.clientID)
+		if err != nil {
+			t.Fatalf("%s: %v", test.clientID, err)
+		}
+		if (sub == "unittestuser") != test.raw {
+			t.Errorf("%s: got subject %q, want raw %v", test.clientID, sub, test.raw)
+		}
+	}
+}
+
+func TestPairwiseSubjectTypeRequiresSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	registration := &clients.ClientRegistration{
+		SubjectType:  oidc.SubjectIDPairwise,
+		RedirectURIs: []string{"https://pairwise.example.com/cb"},
+	}
+	if err := provider.validateClientSubjectType(ctx, registration); err == nil {
+		t.Error("pairwise client registration accepted without pairwise subject secret")
+	}
+	for _, subjectType := range provider.metadata.SubjectTypesSupported {
+		if subjectType == oidc.SubjectIDPairwise {
+			t.Error("pairwise subject type advertised without pairwise subject secret")
+		}
+	}
+
+	err := provider.clients.SetPairwiseSubjectSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.validateClientSubjectType(ctx, registration); err != nil {
+		t.Errorf("pairwise client registration refused with pairwise subject secret: %v", err)
+	}
+}
+
+func TestPairwiseSubjectInAccessTokens(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, profile := range []string{"", konnectoidc.AccessTokenProfileJWT} {
+		err := provider.clients.Register(&clients.ClientRegistration{
+			ID:                 "pairwiseclient" + profile,
+			SubjectType:        oidc.SubjectIDPairwise,
+			RedirectURIs:       []string{"https://pairwise.example.com/cb"},
+			AccessTokenProfile: profile,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := provider.clients.SetPairwiseSubjectSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := newTestAuthRecord(provider)
+	pairwiseSubject, err := provider.clients.PublicSubject(ctx, "pairwiseclient", auth.Subject())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pairwiseSubject == auth.Subject() {
+		t.Fatal("pairwise subject must differ from global subject")
+	}
+
+	tests := []struct {
+		clientID string
+		sub      string
+	}{
+		{testClientID, auth.Subject()},
+		{"pairwiseclient", pairwiseSubject},
+		{"pairwiseclient" + konnectoidc.AccessTokenProfileJWT, pairwiseSubject},
+	}
+	for _, test := range tests {
+		accessToken, err := provider.makeAccessToken(ctx, test.clientID, nil, auth, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.clientID, err)
+		}
+		claims, err := provider.parseAccessToken(accessToken)
+		if err != nil {
+			t.Fatalf("%s: %v", test.clientID, err)
+		}
+		if claims.Subject != test.sub {
+			t.Errorf("%s: got access token sub %v want %v", test.clientID, claims.Subject, test.sub)
+		}
+		if response := provider.introspectToken(ctx, accessToken, ""); response.Subject != test.sub {
+			t.Errorf("%s: got introspected access token sub %v want %v", test.clientID, response.Subject, test.sub)
+		}
+
+		refreshToken, _ := makeTestRefreshToken(ctx, t, provider, test.clientID)
+		if response := provider.introspectToken(ctx, refreshToken, konnectoidc.TokenTypeHintRefreshToken); response.Subject != test.sub {
+			t.Errorf("%s: got introspected refresh token sub %v want %v", test.clientID, response.Subject, test.sub)
+		}
+	}
+}
@@ -19,46 +19,83 @@ package provider
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-querystring/query"
+	"gopkg.in/square/go-jose.v2"
 	"stash.kopano.io/kgol/oidc-go"
 	"stash.kopano.io/kgol/rndm"
 
 	"stash.kopano.io/kc/konnect"
 	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
 	konnectoidc "stash.kopano.io/kc/konnect/oidc"
 	"stash.kopano.io/kc/konnect/oidc/payload"
 	"stash.kopano.io/kc/konnect/utils"
 )
 
+const (
+	authorizeResponseJWTDuration = 10 * time.Minute
+)
+
 // MakeAccessToken implements the oidc.AccessTokenProvider interface.
 func (p *Provider) MakeAccessToken(ctx context.Context, audience string, auth identity.AuthRecord) (string, error) {
-	return p.makeAccessToken(ctx, audience, auth, nil)
+	return p.makeAccessToken(ctx, audience, nil, auth, nil, nil, nil)
 }
 
-func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth identity.AuthRecord, signingMethod jwt.SigningMethod) (string, error) {
+// makeAccessToken creates an access token for the client with the provided
+// clientID. The audience of the token are the provided resources or the
+// client if no resources are given. The sub claim follows the subject type of
+// the client, while the kc.identity claim keeps the internal identity which is
+// required to resolve the user for userinfo and token exchange.
+func (p *Provider) makeAccessToken(ctx context.Context, clientID string, resources []string, auth identity.AuthRecord, actor *konnect.ActorClaims, confirmation *konnect.ConfirmationClaims, signingMethod jwt.SigningMethod) (string, error) {
 	sk, ok := p.getSigningKey(signingMethod)
 	if !ok {
 		return "", fmt.Errorf("no signing key")
 	}
 
+	subject, err := p.accessTokenSubject(ctx, clientID, auth)
+	if err != nil {
+		return "", err
+	}
+
 	authorizedScopes := auth.AuthorizedScopes()
 	authorizedScopesList := makeArrayFromBoolMap(authorizedScopes)
 
+	audience := payload.AudienceList(resources)
+	if len(audience) == 0 {
+		audience = payload.AudienceList{clientID}
+	}
+
+	profile := p.accessTokenProfile
+	if registration, _ := p.clients.Get(ctx, clientID); registration != nil && registration.AccessTokenProfile != "" {
+		profile = registration.AccessTokenProfile
+	}
+	if profile == konnectoidc.AccessTokenProfileJWT {
+		return p.makeJWTAccessToken(ctx, sk, clientID, subject, audience, authorizedScopesList, auth, actor, confirmation)
+	}
+
 	accessTokenClaims := konnect.AccessTokenClaims{
+		Audience:                audience,
+		ClientID:                clientID,
 		IsAccessToken:           true,
 		AuthorizedScopesList:    authorizedScopesList,
 		AuthorizedClaimsRequest: auth.AuthorizedClaims(),
 		StandardClaims: jwt.StandardClaims{
 			Issuer:    p.issuerIdentifier,
-			Subject:   auth.Subject(),
-			Audience:  audience,
+			Subject:   subject,
 			ExpiresAt: time.Now().Add(p.accessTokenDuration).Unix(),
 			IssuedAt:  time.Now().Unix(),
 			Id:        rndm.GenerateRandomString(24),
 		},
+		Actor:        actor,
+		Confirmation: confirmation,
 	}
 
 	user := auth.User()
@@ -75,13 +112,57 @@ func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth id
 	return accessToken.SignedString(sk.PrivateKey)
 }
 
+// makeJWTAccessToken creates an access token with the JWT profile as specified
+// at https://tools.ietf.org/html/rfc9068.
+func (p *Provider) makeJWTAccessToken(ctx context.Context, sk *SigningKey, clientID string, subject string, audience payload.AudienceList, authorizedScopesList []string, auth identity.AuthRecord, actor *konnect.ActorClaims, confirmation *konnect.ConfirmationClaims) (string, error) {
+	sort.Strings(authorizedScopesList)
+
+	accessTokenClaims := konnect.JWTAccessTokenClaims{
+		Audience:                audience,
+		ClientID:                clientID,
+		Scope:                   strings.Join(authorizedScopesList, " "),
+		AuthorizedClaimsRequest: auth.AuthorizedClaims(),
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    p.issuerIdentifier,
+			Subject:   subject,
+			ExpiresAt: time.Now().Add(p.accessTokenDuration).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        rndm.GenerateRandomString(24),
+		},
+		Actor:        actor,
+		Confirmation: confirmation,
+	}
+
+	if loggedOn, authTime := auth.LoggedOn(); loggedOn && !authTime.IsZero() {
+		accessTokenClaims.AuthTime = authTime.Unix()
+	}
+	if amr := auth.AuthenticationMethods(); len(amr) > 0 {
+		accessTokenClaims.ACR = identity.ACRFromAMR(amr)
+		accessTokenClaims.AMR = amr
+	}
+
+	user := auth.User()
+	if user != nil {
+		if userWithClaims, ok := user.(identity.UserWithClaims); ok {
+			accessTokenClaims.IdentityClaims = userWithClaims.Claims()
+		}
+		accessTokenClaims.IdentityProvider = auth.Manager().Name()
+	}
+
+	accessToken := jwt.NewWithClaims(sk.SigningMethod, accessTokenClaims)
+	accessToken.Header[oidc.JWTHeaderKeyID] = sk.ID
+	accessToken.Header["typ"] = konnectoidc.AccessTokenJWTType
+
+	return accessToken.SignedString(sk.PrivateKey)
+}
+
 func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRequest, auth identity.AuthRecord, session *payload.Session, accessTokenString string, codeString string, signingMethod jwt.SigningMethod) (string, error) {
 	sk, ok := p.getSigningKey(signingMethod)
 	if !ok {
 		return "", fmt.Errorf("no signing key")
 	}
 
-	publicSubject, err := p.PublicSubjectFromAuth(auth)
+	publicSubject, err := p.PublicSubjectFromAuth(ctx, auth, ar.ClientID)
 	if err != nil {
 		return "", err
 	}
@@ -108,6 +189,9 @@ func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRe
 	// generated.
 	authorizedClaimsRequest := auth.AuthorizedClaims()
 
+	// Remember authentication methods, as auth might get replaced below.
+	amr := auth.AuthenticationMethods()
+
 	withAccessToken := accessTokenString != ""
 	withCode := codeString != ""
 	withAuthTime := ar.MaxAge > 0
@@ -198,6 +282,12 @@ func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRe
 		}
 	}
 
+	if requestedACR, _ := ar.RequestedACRValues(); len(amr) > 0 || len(requestedACR) > 0 {
+		// Add authentication context class and methods.
+		idTokenClaims.ACR, _ = identity.MatchACR(identity.ACRFromAMR(amr), requestedACR)
+		idTokenClaims.AMR = amr
+	}
+
 	// Support extra non-standard claims in ID token.
 	var finalIDTokenClaims jwt.Claims = idTokenClaims
 	if !withAccessToken {
@@ -228,12 +318,7 @@ func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRe
 	return idToken.SignedString(sk.PrivateKey)
 }
 
-func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth identity.AuthRecord, signingMethod jwt.SigningMethod) (string, error) {
-	sk, ok := p.getSigningKey(signingMethod)
-	if !ok {
-		return "", fmt.Errorf("no signing key")
-	}
-
+func (p *Provider) makeRefreshToken(ctx context.Context, audience string, resources []string, auth identity.AuthRecord, confirmation *konnect.ConfirmationClaims, signingMethod jwt.SigningMethod) (string, error) {
 	approvedScopesList := []string{}
 	approvedScopes := make(map[string]bool)
 	for scope, granted := range auth.AuthorizedScopes() {
@@ -243,7 +328,7 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		}
 	}
 
-	ref, err := auth.Manager().ApproveScopes(ctx, auth.Subject(), audience, approvedScopes)
+	consentRef, err := auth.Manager().ApproveScopes(ctx, auth.Subject(), audience, approvedScopes)
 	if err != nil {
 		return "", err
 	}
@@ -252,7 +337,11 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		IsRefreshToken:        true,
 		ApprovedScopesList:    approvedScopesList,
 		ApprovedClaimsRequest: auth.AuthorizedClaims(),
-		Ref:                   ref,
+		Ref:                   rndm.GenerateRandomString(32),
+		ConsentRef:            consentRef,
+		LogonSessionID:        logonSessionIDFromAuth(auth),
+		ResourcesList:         resources,
+		Confirmation:          confirmation,
 		StandardClaims: jwt.StandardClaims{
 			Issuer:    p.issuerIdentifier,
 			Subject:   auth.Subject(),
@@ -271,12 +360,118 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		refreshTokenClaims.IdentityProvider = auth.Manager().Name()
 	}
 
+	return p.signRefreshToken(ctx, refreshTokenClaims, signingMethod)
+}
+
+// rotateRefreshToken creates a new refresh token for the same grant as the
+// provided refresh token claims. The new refresh token keeps the ref, family,
+// scopes and identity of the provided claims.
+func (p *Provider) rotateRefreshToken(ctx context.Context, claims *konnect.RefreshTokenClaims, signingMethod jwt.SigningMethod) (string, error) {
+	refreshTokenClaims := *claims
+	refreshTokenClaims.ExpiresAt = time.Now().Add(p.refreshTokenDuration).Unix()
+	refreshTokenClaims.IssuedAt = time.Now().Unix()
+	refreshTokenClaims.Id = rndm.GenerateRandomString(24)
+
+	return p.signRefreshToken(ctx, &refreshTokenClaims, signingMethod)
+}
+
+func (p *Provider) signRefreshToken(ctx context.Context, refreshTokenClaims *konnect.RefreshTokenClaims, signingMethod jwt.SigningMethod) (string, error) {
+	sk, ok := p.getSigningKey(signingMethod)
+	if !ok {
+		return "", fmt.Errorf("no signing key")
+	}
+
+	if p.refreshTokenRotation {
+		// Start a new family for the grant when the token has none yet and
+		// remember the token as the only valid refresh token of its family.
+		if refreshTokenClaims.FamilyID == "" {
+			refreshTokenClaims.FamilyID = rndm.GenerateRandomString(32)
+		}
+		err := p.refreshManager.Set(refreshTokenClaims.FamilyID, refreshTokenClaims.Id, time.Unix(refreshTokenClaims.ExpiresAt, 0))
+		if err != nil {
+			return "", err
+		}
+	}
+
 	refreshToken := jwt.NewWithClaims(sk.SigningMethod, refreshTokenClaims)
 	refreshToken.Header[oidc.JWTHeaderKeyID] = sk.ID
 
 	return refreshToken.SignedString(sk.PrivateKey)
 }
 
+// makeAuthorizeResponseJWT creates a signed authorize response JWT holding
+// the provided response params as specified at
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.1
+func (p *Provider) makeAuthorizeResponseJWT(ctx context.Context, ar *payload.AuthenticationRequest, params interface{}) (string, error) {
+	values, err := query.Values(params)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	for key, value := range values {
+		if len(value) > 0 && value[0] != "" {
+			claims[key] = value[0]
+		}
+	}
+	claims[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
+	claims[oidc.AudienceClaim] = ar.ClientID
+	claims[oidc.ExpirationClaim] = time.Now().Add(authorizeResponseJWTDuration).Unix()
+
+	var signingMethod jwt.SigningMethod
+	registration, _ := p.clients.Get(ctx, ar.ClientID)
+	if registration != nil && registration.RawAuthorizationSignedResponseAlg != "" {
+		signingMethod = jwt.GetSigningMethod(registration.RawAuthorizationSignedResponseAlg)
+		if signingMethod == nil {
+			return "", fmt.Errorf("unknown authorization_signed_response_alg")
+		}
+	}
+
+	return p.makeJWT(ctx, signingMethod, claims)
+}
+
+// makeRegistrationAccessToken creates a registration access token for the
+// provided dynamic client registration as specified at
+// https://tools.ietf.org/html/rfc7592#section-3. The token is bound to the
+// client secret and expires together with the client.
+func (p *Provider) makeRegistrationAccessToken(ctx context.Context, registration *clients.ClientRegistration) (string, error) {
+	claims := &konnect.RegistrationAccessTokenClaims{
+		IsRegistrationAccessToken: true,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    p.issuerIdentifier,
+			Subject:   registration.Secret,
+			ExpiresAt: registration.SecretExpiresAt,
+			IssuedAt:  time.Now().Unix(),
+			Id:        rndm.GenerateRandomString(24),
+		},
+	}
+
+	return p.makeJWT(ctx, nil, claims)
+}
+
+// validateRegistrationAccessToken validates the provided registration access
+// token and returns the registration of the dynamic client with the provided
+// client ID if the token was issued for it.
+func (p *Provider) validateRegistrationAccessToken(ctx context.Context, clientID string, tokenString string) (*clients.ClientRegistration, error) {
+	claims := &konnect.RegistrationAccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return p.validateJWT(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	registration, ok := p.clients.Get(ctx, clientID)
+	if !ok || !registration.Dynamic {
+		return nil, fmt.Errorf("unknown client")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Subject), []byte(registration.Secret)) != 1 {
+		return nil, fmt.Errorf("registration access token not issued for client")
+	}
+
+	return registration, nil
+}
+
 func (p *Provider) makeJWT(ctx context.Context, signingMethod jwt.SigningMethod, claims jwt.Claims) (string, error) {
 	sk, ok := p.getSigningKey(signingMethod)
 	if !ok {
@@ -289,6 +484,47 @@ func (p *Provider) makeJWT(ctx context.Context, signingMethod jwt.SigningMethod,
 	return token.SignedString(sk.PrivateKey)
 }
 
+// encryptJWE encrypts the provided payload to the encryption key of the
+// provided client registration with the provided JWE algorithms and returns
+// it in compact serialization. If nested is true, the payload is marked as
+// signed JWT as specified at https://tools.ietf.org/html/rfc7519#section-5.2.
+func (p *Provider) encryptJWE(registration *clients.ClientRegistration, alg string, enc string, payload []byte, nested bool) (string, error) {
+	if !konnectoidc.IsSupportedEncryptionAlg(alg) {
+		return "", fmt.Errorf("unsupported encryption alg")
+	}
+	if enc == "" {
+		enc = konnectoidc.EncryptionEncDefault
+	}
+	if !konnectoidc.IsSupportedEncryptionEnc(enc) {
+		return "", fmt.Errorf("unsupported encryption enc")
+	}
+
+	kid, key, err := registration.EncryptionKey(alg)
+	if err != nil {
+		return "", err
+	}
+
+	options := &jose.EncrypterOptions{}
+	if nested {
+		options = options.WithContentType("JWT")
+	}
+	encrypter, err := jose.NewEncrypter(jose.ContentEncryption(enc), jose.Recipient{
+		Algorithm: jose.KeyAlgorithm(alg),
+		Key:       key,
+		KeyID:     kid,
+	}, options)
+	if err != nil {
+		return "", err
+	}
+
+	jwe, err := encrypter.Encrypt(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return jwe.CompactSerialize()
+}
+
 func (p *Provider) validateJWT(token *jwt.Token) (interface{}, error) {
 	rawAlg, ok := token.Header[oidc.JWTHeaderAlg]
 	if !ok {
@@ -319,3 +555,204 @@ func (p *Provider) validateJWT(token *jwt.Token) (interface{}, error) {
 	}
 	return key, nil
 }
+
+// introspectToken validates the provided token string and returns the
+// introspection data for it. Tokens which cannot be validated are returned as
+// not active.
+func (p *Provider) introspectToken(ctx context.Context, tokenString string, tokenTypeHint string) *payload.IntrospectionResponse {
+	var response *payload.IntrospectionResponse
+
+	switch tokenTypeHint {
+	case konnectoidc.TokenTypeHintRefreshToken:
+		response = p.introspectRefreshToken(ctx, tokenString)
+		if response == nil {
+			response = p.introspectAccessToken(tokenString)
+		}
+	default:
+		// Unknown hints are ignored, see https://tools.ietf.org/html/rfc7662#section-2.1
+		response = p.introspectAccessToken(tokenString)
+		if response == nil {
+			response = p.introspectRefreshToken(ctx, tokenString)
+		}
+	}
+
+	if response == nil {
+		return &payload.IntrospectionResponse{
+			Active: false,
+		}
+	}
+
+	return response
+}
+
+func (p *Provider) introspectAccessToken(tokenString string) *payload.IntrospectionResponse {
+	claims, err := p.parseAccessToken(tokenString)
+	if err != nil || p.revocationManager.IsRevoked(claims.Id) {
+		return nil
+	}
+
+	scope := claims.Scope
+	if scope == "" {
+		scope = strings.Join(claims.AuthorizedScopesList, " ")
+	}
+
+	return &payload.IntrospectionResponse{
+		Active: true,
+
+		Scope:     scope,
+		ClientID:  claims.AuthorizedClientID(),
+		TokenType: oidc.TokenTypeBearer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.Id,
+
+		IdentityClaims:   claims.IdentityClaims,
+		IdentityProvider: claims.IdentityProvider,
+	}
+}
+
+func (p *Provider) introspectRefreshToken(ctx context.Context, tokenString string) *payload.IntrospectionResponse {
+	claims, err := p.parseRefreshToken(tokenString)
+	if err != nil || p.isRefreshTokenRevoked(claims) {
+		return nil
+	}
+	// Refresh tokens can only be used as long as their client is registered.
+	if _, ok := p.clients.Get(ctx, claims.Audience); !ok {
+		return nil
+	}
+
+	// Refresh tokens keep the global subject since it is needed to refresh,
+	// so map it to the subject as presented to the client.
+	subject, err := p.clients.PublicSubject(ctx, claims.Audience, claims.Subject)
+	if err != nil {
+		return nil
+	}
+
+	return &payload.IntrospectionResponse{
+		Active: true,
+
+		Scope:     strings.Join(claims.ApprovedScopesList, " "),
+		ClientID:  claims.Audience,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Subject:   subject,
+		Audience:  payload.AudienceList{claims.Audience},
+		Issuer:    claims.Issuer,
+		ID:        claims.Id,
+
+		IdentityClaims:   claims.IdentityClaims,
+		IdentityProvider: claims.IdentityProvider,
+	}
+}
+
+// revokeToken validates the provided token string and adds its identifiers to
+// the accociated revocation manager when it was issued to the provided client.
+// Tokens which cannot be validated are ignored as specified at
+// https://tools.ietf.org/html/rfc7009#section-2.2
+//
+// Revoking a refresh token invalidates all refresh tokens of its grant, but
+// not the access tokens which were issued with them. Those stay valid until
+// they expire and must be revoked on their own, which is allowed as specified
+// at https://tools.ietf.org/html/rfc7009#section-2.1.
+func (p *Provider) revokeToken(ctx context.Context, tokenString string, tokenTypeHint string, clientID string) error {
+	var ids []string
+	var audience string
+	var expiresAt int64
+
+	accessTokenClaims, accessTokenErr := p.parseAccessToken(tokenString)
+	refreshTokenClaims, refreshTokenErr := p.parseRefreshToken(tokenString)
+	switch {
+	case refreshTokenErr == nil && (tokenTypeHint == konnectoidc.TokenTypeHintRefreshToken || accessTokenErr != nil):
+		// Revoking the ref invalidates all refresh tokens of the same grant.
+		ids = []string{refreshTokenClaims.Id, refreshTokenClaims.Ref}
+		audience = refreshTokenClaims.Audience
+		expiresAt = refreshTokenClaims.ExpiresAt
+	case accessTokenErr == nil:
+		ids = []string{accessTokenClaims.Id}
+		audience = accessTokenClaims.AuthorizedClientID()
+		expiresAt = accessTokenClaims.ExpiresAt
+	default:
+		return nil
+	}
+
+	if audience != clientID {
+		p.logger.WithField("client_id", clientID).Debugln("revocation request for token issued to other client ignored")
+		return nil
+	}
+
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if err := p.revocationManager.Revoke(id, time.Unix(expiresAt, 0)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRefreshTokenRevoked returns true if either the token ID, the ref, the
+// family or the logon session of the provided refresh token claims has been
+// revoked.
+func (p *Provider) isRefreshTokenRevoked(claims *konnect.RefreshTokenClaims) bool {
+	return p.revocationManager.IsRevoked(claims.Id) || p.revocationManager.IsRevoked(claims.Ref) || p.revocationManager.IsRevoked(claims.FamilyID) || p.revocationManager.IsRevoked(claims.LogonSessionID)
+}
+
+// makeSignedMetadata creates a JWT which has the provided metadata values as
+// claims as specified at https://tools.ietf.org/html/rfc8414#section-2.1.
+func (p *Provider) makeSignedMetadata(metadata interface{}) (string, error) {
+	sk, ok := p.getSigningKey(nil)
+	if !ok {
+		return "", fmt.Errorf("no signing key")
+	}
+
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{}
+	err = json.Unmarshal(raw, &claims)
+	if err != nil {
+		return "", err
+	}
+	// The signed metadata must include the issuer.
+	claims[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
+	claims[oidc.IssuedAtClaim] = time.Now().Unix()
+
+	token := jwt.NewWithClaims(sk.SigningMethod, claims)
+	token.Header[oidc.JWTHeaderKeyID] = sk.ID
+
+	return token.SignedString(sk.PrivateKey)
+}
+
+func (p *Provider) parseAccessToken(tokenString string) (*konnect.AccessTokenClaims, error) {
+	claims := &konnect.AccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Access tokens with the JWT profile are identified by their typ.
+		if typ, _ := token.Header["typ"].(string); typ == konnectoidc.AccessTokenJWTType {
+			claims.JWTProfile = true
+		}
+		return p.validateJWT(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) parseRefreshToken(tokenString string) (*konnect.RefreshTokenClaims, error) {
+	claims := &konnect.RefreshTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return p.validateJWT(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
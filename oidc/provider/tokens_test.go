@@ -0,0 +1,379 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"stash.kopano.io/kc/konnect"
+	"stash.kopano.io/kc/konnect/identity"
+	"stash.kopano.io/kc/konnect/identity/clients"
+	konnectoidc "stash.kopano.io/kc/konnect/oidc"
+	refreshManagers "stash.kopano.io/kc/konnect/oidc/refresh/managers"
+)
+
+func newTestAuthRecord(p *Provider) identity.AuthRecord {
+	return identity.NewAuthRecord(p.identityManager, "unittestuser", map[string]bool{"openid": true, "offline_access": true}, nil, nil)
+}
+
+func makeTestRefreshToken(ctx context.Context, t *testing.T, p *Provider, clientID string) (string, *konnect.RefreshTokenClaims) {
+	tokenString, err := p.makeRefreshToken(ctx, clientID, nil, newTestAuthRecord(p), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.parseRefreshToken(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokenString, claims
+}
+
+func TestRevokeRefreshTokenOnlyRevokesItsGrant(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	tokenA, claimsA := makeTestRefreshToken(ctx, t, provider, "client1")
+	_, claimsB := makeTestRefreshToken(ctx, t, provider, "client1")
+
+	if claimsA.ConsentRef == "" || claimsA.ConsentRef != claimsB.ConsentRef {
+		t.Fatalf("grants of the same consent must share the consent ref, got %v and %v", claimsA.ConsentRef, claimsB.ConsentRef)
+	}
+	if claimsA.Ref == claimsB.Ref {
+		t.Fatal("grants must not share the ref")
+	}
+
+	tests := []struct {
+		name     string
+		clientID string
+		revokedA bool
+	}{
+		{"other client", "client2", false},
+		{"issued client", "client1", true},
+	}
+	for _, test := range tests {
+		err := provider.revokeToken(ctx, tokenA, konnectoidc.TokenTypeHintRefreshToken, test.clientID)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if revoked := provider.isRefreshTokenRevoked(claimsA); revoked != test.revokedA {
+			t.Errorf("%s: revoked token got %v want %v", test.name, revoked, test.revokedA)
+		}
+		if provider.isRefreshTokenRevoked(claimsB) {
+			t.Errorf("%s: token of other grant was revoked", test.name)
+		}
+	}
+}
+
+type testUser struct {
+	id             string
+	logonSessionID string
+}
+
+func (u *testUser) Subject() string {
+	return u.id
+}
+
+func (u *testUser) LogonSessionID() string {
+	return u.logonSessionID
+}
+
+func (u *testUser) Raw() string {
+	return u.id
+}
+
+func (u *testUser) Claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		konnect.IdentifiedUserIDClaim: u.id,
+	}
+}
+
+func postTokenRequest(router http.Handler, values url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, "/konnect/v1/token", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	response := make(map[string]interface{})
+	json.Unmarshal(rr.Body.Bytes(), &response)
+
+	return rr, response
+}
+
+func refreshTokenValues(refreshToken string) url.Values {
+	return url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{refreshToken},
+		"client_id":     []string{testClientID},
+		"client_secret": []string{testClientSecret},
+	}
+}
+
+func makeTestUserRefreshToken(ctx context.Context, t *testing.T, p *Provider) string {
+	auth := newTestAuthRecord(p)
+	auth.SetUser(&testUser{id: "unittestuser"})
+	tokenString, err := p.makeRefreshToken(ctx, testClientID, nil, auth, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokenString
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+	provider.refreshTokenRotation = true
+
+	// Two grants of the same user and client, eg. on different devices.
+	deviceA := makeTestUserRefreshToken(ctx, t, provider)
+	deviceB := makeTestUserRefreshToken(ctx, t, provider)
+
+	rr, response := postTokenRequest(router, refreshTokenValues(deviceA))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("refresh failed: %v %v", rr.Code, response)
+	}
+	rotatedA, _ := response["refresh_token"].(string)
+	if rotatedA == "" || rotatedA == deviceA {
+		t.Fatalf("refresh did not rotate the refresh token: %v", response)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"other grant", deviceB, http.StatusOK},
+		{"reused token", deviceA, http.StatusBadRequest},
+		{"rotated token of reused family", rotatedA, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		rr, response := postTokenRequest(router, refreshTokenValues(test.token))
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %v", test.name, rr.Code, test.status, response)
+		}
+	}
+}
+
+func TestRefreshTokenRotationRejectsUnknownFamily(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	// Issued before rotation was enabled, starts a new family.
+	withoutFamily := makeTestUserRefreshToken(ctx, t, provider)
+
+	provider.refreshTokenRotation = true
+	withFamily := makeTestUserRefreshToken(ctx, t, provider)
+
+	// Forget all families, as after a restart with the memory store.
+	provider.refreshManager = refreshManagers.NewMemoryMapManager(ctx)
+
+	rr, response := postTokenRequest(router, refreshTokenValues(withoutFamily))
+	if rr.Code != http.StatusOK {
+		t.Errorf("refresh token without family got status %v: %v", rr.Code, response)
+	}
+	rr, response = postTokenRequest(router, refreshTokenValues(withFamily))
+	if rr.Code != http.StatusBadRequest || response["error"] != "invalid_grant" {
+		t.Errorf("refresh token of unknown family got status %v: %v", rr.Code, response)
+	}
+}
+
+func TestRefreshTokenOfRevokedLogonSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, router, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	makeToken := func(logonSessionID string) string {
+		auth := newTestAuthRecord(provider)
+		auth.SetUser(&testUser{id: "unittestuser", logonSessionID: logonSessionID})
+		tokenString, err := provider.makeRefreshToken(ctx, testClientID, nil, auth, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenString
+	}
+
+	tokenA := makeToken("logonsession-a")
+	tokenB := makeToken("logonsession-b")
+	withoutLogonSession := makeToken("")
+
+	// The identifier records revoked logon sessions with the shared revocation
+	// manager.
+	err := provider.revocationManager.Revoke("logonsession-a", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"revoked logon session", tokenA, http.StatusBadRequest},
+		{"other logon session", tokenB, http.StatusOK},
+		{"without logon session", withoutLogonSession, http.StatusOK},
+	}
+	for _, test := range tests {
+		rr, response := postTokenRequest(router, refreshTokenValues(test.token))
+		if rr.Code != test.status {
+			t.Errorf("%s: got status %v want %v: %v", test.name, rr.Code, test.status, response)
+		}
+	}
+}
+
+func TestJWTAccessTokenProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                 "jwtclient",
+		RedirectURIs:       []string{"https://jwt.example.com/cb"},
+		AccessTokenProfile: konnectoidc.AccessTokenProfileJWT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken, err := provider.makeAccessToken(ctx, "jwtclient", nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := token.Header["typ"]; typ != konnectoidc.AccessTokenJWTType {
+		t.Errorf("got typ %v want %v", typ, konnectoidc.AccessTokenJWTType)
+	}
+	rawClaims := token.Claims.(jwt.MapClaims)
+	for _, claim := range []string{"iss", "exp", "aud", "sub", "client_id", "iat", "jti", "scope"} {
+		if _, ok := rawClaims[claim]; !ok {
+			t.Errorf("required claim %s missing", claim)
+		}
+	}
+	if _, ok := rawClaims["kc.isAccessToken"]; ok {
+		t.Errorf("JWT profile access token must not have the kc.isAccessToken claim")
+	}
+}
+
+func TestGetAccessTokenClaimsFromRequestProfiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                 "jwtclient",
+		RedirectURIs:       []string{"https://jwt.example.com/cb"},
+		AccessTokenProfile: konnectoidc.AccessTokenProfileJWT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	konnectToken, err := provider.makeAccessToken(ctx, testClientID, nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtToken, err := provider.makeAccessToken(ctx, "jwtclient", nil, newTestAuthRecord(provider), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, _ := provider.getSigningKey(nil)
+	makeToken := func(typ string, without string) string {
+		claims := jwt.MapClaims{
+			"iss":       provider.issuerIdentifier,
+			"sub":       "unittestuser",
+			"exp":       time.Now().Add(time.Minute).Unix(),
+			"aud":       "jwtclient",
+			"client_id": "jwtclient",
+			"iat":       time.Now().Unix(),
+			"jti":       "jti-1",
+		}
+		delete(claims, without)
+		token := jwt.NewWithClaims(sk.SigningMethod, claims)
+		token.Header["kid"] = sk.ID
+		if typ != "" {
+			token.Header["typ"] = typ
+		}
+		tokenString, signErr := token.SignedString(sk.PrivateKey)
+		if signErr != nil {
+			t.Fatal(signErr)
+		}
+		return tokenString
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		clientID string
+	}{
+		{"konnect profile", konnectToken, testClientID},
+		{"jwt profile", jwtToken, "jwtclient"},
+		{"jwt profile with all claims", makeToken(konnectoidc.AccessTokenJWTType, ""), "jwtclient"},
+		{"jwt profile without client_id", makeToken(konnectoidc.AccessTokenJWTType, "client_id"), ""},
+		{"jwt profile without aud", makeToken(konnectoidc.AccessTokenJWTType, "aud"), ""},
+		{"jwt profile without iat", makeToken(konnectoidc.AccessTokenJWTType, "iat"), ""},
+		{"jwt profile without jti", makeToken(konnectoidc.AccessTokenJWTType, "jti"), ""},
+		{"jwt without typ", makeToken("", ""), ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/konnect/v1/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+
+		claims, err := provider.GetAccessTokenClaimsFromRequest(req)
+		if test.clientID == "" {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if clientID := claims.AuthorizedClientID(); clientID != test.clientID {
+			t.Errorf("%s: got client %v want %v", test.name, clientID, test.clientID)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package refresh
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors returned by refresh token family managers when rotating.
+var (
+	ErrReused   = errors.New("refresh token reused")
+	ErrNotFound = errors.New("not found")
+)
+
+// Record bundles the data stored in a refresh token family manager. A family
+// is identified by the family ID of its refresh tokens and tracks the ID of
+// the single refresh token of the family which is currently valid.
+type Record struct {
+	FamilyID string `json:"family_id"`
+	Current  string `json:"current"`
+
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Manager is a interface defining a refresh token family manager.
+type Manager interface {
+	Set(familyID string, id string, expiresAt time.Time) error
+	Rotate(familyID string, id string) error
+}
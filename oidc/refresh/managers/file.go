@@ -0,0 +1,128 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kc/konnect/oidc/refresh"
+	"stash.kopano.io/kc/konnect/utils"
+)
+
+// fileManager provides a refresh token family manager which keeps its state
+// in memory and persists it to a JSON file whenever a new current token is
+// set, so refresh token families survive restarts. The fileManager's methods
+// are safe to call from multiple Go routines.
+type fileManager struct {
+	*memoryMapManager
+
+	fn     string
+	mutex  sync.Mutex
+	logger logrus.FieldLogger
+}
+
+// NewFileManager creates a new file backed refresh token family Manager using
+// the provided file name. Existing families are loaded from the file if it
+// exists.
+func NewFileManager(ctx context.Context, fn string, logger logrus.FieldLogger) (refresh.Manager, error) {
+	rm := &fileManager{
+		memoryMapManager: newMemoryMapManager(),
+
+		fn:     fn,
+		logger: logger,
+	}
+
+	err := rm.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if rm.purgeExpired() > 0 {
+					if saveErr := rm.save(); saveErr != nil {
+						rm.logger.WithError(saveErr).Errorln("failed to save refresh token family file after purge")
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return rm, nil
+}
+
+func (rm *fileManager) load() error {
+	var records []*refresh.Record
+	if _, err := utils.ReadJSONFile(rm.fn, &records); err != nil {
+		return fmt.Errorf("failed to load refresh token family file: %v", err)
+	}
+
+	now := time.Now()
+	for _, record := range records {
+		if record.FamilyID == "" || record.ExpiresAt.Before(now) {
+			continue
+		}
+		rm.table.Set(record.FamilyID, record)
+	}
+
+	return nil
+}
+
+func (rm *fileManager) save() error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	records := make([]*refresh.Record, 0, rm.table.Count())
+	rm.memoryMapManager.mutex.Lock()
+	for entry := range rm.table.IterBuffered() {
+		record := *entry.Val.(*refresh.Record)
+		records = append(records, &record)
+	}
+	rm.memoryMapManager.mutex.Unlock()
+
+	return utils.WriteJSONFile(rm.fn, records)
+}
+
+// Set sets the current token of the family in the accociated manager's table
+// and persists the result to the accociated file. Rotations are not persisted
+// on their own, since every successful rotation is followed by a Set.
+func (rm *fileManager) Set(familyID string, id string, expiresAt time.Time) error {
+	err := rm.memoryMapManager.Set(familyID, id, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	err = rm.save()
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token family file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kc/konnect/oidc/refresh"
+)
+
+var logger = &logrus.Logger{
+	Out:       ioutil.Discard,
+	Formatter: &logrus.TextFormatter{DisableColors: true},
+}
+
+func TestMemoryMapManagerRotate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rm := NewMemoryMapManager(ctx)
+	expiresAt := time.Now().Add(time.Hour)
+	rm.Set("family1", "token1", expiresAt)
+	rm.Set("family2", "token1", expiresAt)
+
+	tests := []struct {
+		name     string
+		familyID string
+		id       string
+		err      error
+	}{
+		{"current token", "family1", "token1", nil},
+		{"used token", "family1", "token1", refresh.ErrReused},
+		{"family removed after reuse", "family1", "token1", refresh.ErrNotFound},
+		{"unknown family", "family3", "token1", refresh.ErrNotFound},
+		{"other token", "family2", "token2", refresh.ErrReused},
+	}
+	for _, test := range tests {
+		if err := rm.Rotate(test.familyID, test.id); err != test.err {
+			t.Errorf("%s: got %v want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestFileManagerPersists(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "konnect-refresh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "refresh.json")
+
+	rm, err := NewFileManager(ctx, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rm.Set("family1", "token1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rm.Set("expired", "token1", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileManager(ctx, fn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloaded.Rotate("family1", "token1"); err != nil {
+		t.Errorf("family not restored from file: %v", err)
+	}
+	if err = reloaded.Rotate("expired", "token1"); err != refresh.ErrNotFound {
+		t.Errorf("expired family restored from file: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+
+	"stash.kopano.io/kc/konnect/oidc/refresh"
+)
+
+// Manager provides the api and state to track refresh token families. The
+// manager's methods are safe to call from multiple Go routines.
+type memoryMapManager struct {
+	table cmap.ConcurrentMap
+	mutex sync.Mutex
+}
+
+// NewMemoryMapManager creates a new refresh token family Manager.
+func NewMemoryMapManager(ctx context.Context) refresh.Manager {
+	rm := newMemoryMapManager()
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+
+		}
+	}()
+
+	return rm
+}
+
+func newMemoryMapManager() *memoryMapManager {
+	return &memoryMapManager{
+		table: cmap.New(),
+	}
+}
+
+func (rm *memoryMapManager) purgeExpired() int {
+	var expired []string
+	now := time.Now()
+	var record *refresh.Record
+	rm.mutex.Lock()
+	for entry := range rm.table.IterBuffered() {
+		record = entry.Val.(*refresh.Record)
+		if record.ExpiresAt.Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, familyID := range expired {
+		rm.table.Remove(familyID)
+	}
+	rm.mutex.Unlock()
+
+	return len(expired)
+}
+
+// Set sets the refresh token with the provided ID as the current token of the
+// family with the provided family ID, creating the family if it does not
+// exist.
+func (rm *memoryMapManager) Set(familyID string, id string, expiresAt time.Time) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.table.Set(familyID, &refresh.Record{
+		FamilyID:  familyID,
+		Current:   id,
+		ExpiresAt: expiresAt,
+	})
+
+	return nil
+}
+
+// Rotate marks the refresh token with the provided ID as used in the family
+// with the provided family ID. It returns refresh.ErrReused and removes the
+// family if the provided ID is not the current token of the family. If the
+// family is not known, refresh.ErrNotFound is returned.
+func (rm *memoryMapManager) Rotate(familyID string, id string) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	stored, found := rm.table.Get(familyID)
+	if !found {
+		return refresh.ErrNotFound
+	}
+	record := stored.(*refresh.Record)
+	if record.Current == "" || record.Current != id {
+		rm.table.Remove(familyID)
+		return refresh.ErrReused
+	}
+
+	// Nothing is current until the next token of the family is set.
+	record.Current = ""
+
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kc/konnect/oidc/revocation"
+	"stash.kopano.io/kc/konnect/utils"
+)
+
+// fileManager provides a revocation manager which keeps its state in memory
+// and persists it to a JSON file on every change, so revocations survive
+// restarts. The fileManager's methods are safe to call from multiple Go
+// routines.
+type fileManager struct {
+	*memoryMapManager
+
+	fn     string
+	mutex  sync.Mutex
+	logger logrus.FieldLogger
+}
+
+// NewFileManager creates a new file backed revocation Manager using the
+// provided file name. Existing revocations are loaded from the file if it
+// exists.
+func NewFileManager(ctx context.Context, fn string, logger logrus.FieldLogger) (revocation.Manager, error) {
+	rm := &fileManager{
+		memoryMapManager: newMemoryMapManager(),
+
+		fn:     fn,
+		logger: logger,
+	}
+
+	err := rm.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if rm.purgeExpired() > 0 {
+					if saveErr := rm.save(); saveErr != nil {
+						rm.logger.WithError(saveErr).Errorln("failed to save revocation file after purge")
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return rm, nil
+}
+
+func (rm *fileManager) load() error {
+	entries := make(map[string]int64)
+	if _, err := utils.ReadJSONFile(rm.fn, &entries); err != nil {
+		return fmt.Errorf("failed to load revocation file: %v", err)
+	}
+
+	now := time.Now()
+	for id, exp := range entries {
+		expiresAt := time.Unix(exp, 0)
+		if expiresAt.Before(now) {
+			continue
+		}
+		rm.table.Set(id, expiresAt)
+	}
+
+	return nil
+}
+
+func (rm *fileManager) save() error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	entries := make(map[string]int64)
+	for entry := range rm.table.IterBuffered() {
+		entries[entry.Key] = entry.Val.(time.Time).Unix()
+	}
+
+	return utils.WriteJSONFile(rm.fn, entries)
+}
+
+// Revoke adds the provided id to the accociated manager's table and persists
+// the result to the accociated file.
+func (rm *fileManager) Revoke(id string, expiresAt time.Time) error {
+	err := rm.memoryMapManager.Revoke(id, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	err = rm.save()
+	if err != nil {
+		return fmt.Errorf("failed to save revocation file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+
+	"stash.kopano.io/kc/konnect/oidc/revocation"
+)
+
+// memoryMapManager provides a revocation manager which keeps its state in
+// memory. The memoryMapManager's methods are safe to call from multiple Go
+// routines.
+type memoryMapManager struct {
+	table cmap.ConcurrentMap
+}
+
+// NewMemoryMapManager creates a new in-memory revocation Manager.
+func NewMemoryMapManager(ctx context.Context) revocation.Manager {
+	rm := newMemoryMapManager()
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return rm
+}
+
+func newMemoryMapManager() *memoryMapManager {
+	return &memoryMapManager{
+		table: cmap.New(),
+	}
+}
+
+func (rm *memoryMapManager) purgeExpired() int {
+	var expired []string
+	now := time.Now()
+	for entry := range rm.table.IterBuffered() {
+		if entry.Val.(time.Time).Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, id := range expired {
+		rm.table.Remove(id)
+	}
+
+	return len(expired)
+}
+
+// Revoke adds the provided id to the accociated manager's table. The entry is
+// kept until the provided expiration time has passed.
+func (rm *memoryMapManager) Revoke(id string, expiresAt time.Time) error {
+	rm.table.Upsert(id, expiresAt, func(exists bool, valueInMap interface{}, newValue interface{}) interface{} {
+		if exists && valueInMap.(time.Time).After(newValue.(time.Time)) {
+			return valueInMap
+		}
+		return newValue
+	})
+
+	return nil
+}
+
+// IsRevoked returns true if the provided id is found in the accociated
+// manager's table and not expired.
+func (rm *memoryMapManager) IsRevoked(id string) bool {
+	if id == "" {
+		return false
+	}
+	stored, found := rm.table.Get(id)
+	if !found {
+		return false
+	}
+
+	return stored.(time.Time).After(time.Now())
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package session
+
+import (
+	"time"
+)
+
+// Record bundles the data stored in a session manager. It tracks the clients
+// which received tokens for a session together with the subject which was
+// used for each client, and the logon sessions of the identity manager which
+// were used in the session.
+type Record struct {
+	ID              string
+	Clients         map[string]string
+	LogonSessionIDs map[string]bool
+
+	ExpiresAt time.Time
+}
+
+// Manager is a interface defining a session manager.
+type Manager interface {
+	Add(sessionID string, logonSessionID string, clientID string, sub string) error
+	Pop(sessionID string) (*Record, bool)
+	PopLogonSession(logonSessionID string) (*Record, bool)
+}
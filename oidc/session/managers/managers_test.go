@@ -0,0 +1,68 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPopLogonSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sm := NewMemoryMapManager(ctx)
+	for _, add := range []struct {
+		sessionID, logonSessionID, clientID string
+	}{
+		{"session1", "logon1", "client1"},
+		{"session1", "logon2", "client2"},
+		{"session2", "logon3", "client1"},
+		{"session3", "", "client1"},
+	} {
+		if err := sm.Add(add.sessionID, add.logonSessionID, add.clientID, "sub"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		logonSessionID string
+		sessionID      string
+		clients        int
+	}{
+		{"logon2", "session1", 2},
+		{"logon1", "", 0},
+		{"logon3", "session2", 1},
+		{"unknown", "", 0},
+		{"", "", 0},
+	}
+	for _, test := range tests {
+		record, found := sm.PopLogonSession(test.logonSessionID)
+		if found != (test.sessionID != "") {
+			t.Errorf("%q: got found %v, want session %q", test.logonSessionID, found, test.sessionID)
+			continue
+		}
+		if found && (record.ID != test.sessionID || len(record.Clients) != test.clients) {
+			t.Errorf("%q: got session %q with %d clients, want %q with %d", test.logonSessionID, record.ID, len(record.Clients), test.sessionID, test.clients)
+		}
+	}
+
+	if _, found := sm.Pop("session3"); !found {
+		t.Error("session without logon session not found")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+
+	"stash.kopano.io/kc/konnect/oidc/session"
+)
+
+const (
+	sessionIdleDuration = 30 * 24 * time.Hour
+)
+
+// Manager provides the api and state to track the clients of sessions. The
+// manager's methods are safe to call from multiple Go routines.
+type memoryMapManager struct {
+	table         cmap.ConcurrentMap
+	logonSessions map[string]string
+	mutex         sync.Mutex
+}
+
+// NewMemoryMapManager creates a new session Manager.
+func NewMemoryMapManager(ctx context.Context) session.Manager {
+	sm := &memoryMapManager{
+		table:         cmap.New(),
+		logonSessions: make(map[string]string),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+
+		}
+	}()
+
+	return sm
+}
+
+func (sm *memoryMapManager) purgeExpired() {
+	var expired []string
+	now := time.Now()
+	var record *session.Record
+	sm.mutex.Lock()
+	for entry := range sm.table.IterBuffered() {
+		record = entry.Val.(*session.Record)
+		if record.ExpiresAt.Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, sessionID := range expired {
+		sm.pop(sessionID)
+	}
+	sm.mutex.Unlock()
+}
+
+// Add adds the provided client with the provided subject to the session with
+// the provided session ID, creating the session record if it does not exist.
+// If the provided logon session ID is not empty, the session can also be
+// found by it.
+func (sm *memoryMapManager) Add(sessionID string, logonSessionID string, clientID string, sub string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	var record *session.Record
+	if stored, found := sm.table.Get(sessionID); found {
+		record = stored.(*session.Record)
+	} else {
+		record = &session.Record{
+			ID:              sessionID,
+			Clients:         make(map[string]string),
+			LogonSessionIDs: make(map[string]bool),
+		}
+		sm.table.Set(sessionID, record)
+	}
+	record.Clients[clientID] = sub
+	if logonSessionID != "" {
+		record.LogonSessionIDs[logonSessionID] = true
+		sm.logonSessions[logonSessionID] = sessionID
+	}
+	record.ExpiresAt = time.Now().Add(sessionIdleDuration)
+
+	return nil
+}
+
+// Pop looks up the provided session ID in the accociated manager's table and
+// removes it. If found, it returns the session record plus true. When not
+// found, it returns nil plus false.
+func (sm *memoryMapManager) Pop(sessionID string) (*session.Record, bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.pop(sessionID)
+}
+
+// PopLogonSession looks up the session in which the provided logon session ID
+// was used and removes it. If found, it returns the session record plus true.
+// When not found, it returns nil plus false.
+func (sm *memoryMapManager) PopLogonSession(logonSessionID string) (*session.Record, bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sessionID, found := sm.logonSessions[logonSessionID]
+	if !found {
+		return nil, false
+	}
+
+	return sm.pop(sessionID)
+}
+
+func (sm *memoryMapManager) pop(sessionID string) (*session.Record, bool) {
+	stored, found := sm.table.Pop(sessionID)
+	if !found {
+		return nil, false
+	}
+
+	record := stored.(*session.Record)
+	for logonSessionID := range record.LogonSessionIDs {
+		if sm.logonSessions[logonSessionID] == sessionID {
+			delete(sm.logonSessions, logonSessionID)
+		}
+	}
+
+	return record, true
+}
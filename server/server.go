@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -36,8 +37,9 @@ import (
 type Server struct {
 	Config *Config
 
-	listenAddr string
-	logger     logrus.FieldLogger
+	listenAddr    string
+	tlsListenAddr string
+	logger        logrus.FieldLogger
 
 	requestLog bool
 }
@@ -47,8 +49,9 @@ func NewServer(c *Config) (*Server, error) {
 	s := &Server{
 		Config: c,
 
-		listenAddr: c.Config.ListenAddr,
-		logger:     c.Config.Logger,
+		listenAddr:    c.Config.ListenAddr,
+		tlsListenAddr: c.Config.TLSListenAddr,
+		logger:        c.Config.Logger,
 
 		requestLog: os.Getenv("KOPANO_DEBUG_SERVER_REQUEST_LOG") == "1",
 	}
@@ -126,7 +129,8 @@ func (s *Server) Serve(ctx context.Context) error {
 
 	// HTTP listener.
 	srv := &http.Server{
-		Handler: s.AddContext(serveCtx, router),
+		Handler:   s.AddContext(serveCtx, router),
+		TLSConfig: s.Config.Config.TLSConfig,
 	}
 
 	logger.WithField("listenAddr", s.listenAddr).Infoln("starting http listener")
@@ -134,15 +138,44 @@ func (s *Server) Serve(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+
+	// Optional HTTPS listener, required for mutual TLS.
+	var tlsListener net.Listener
+	if s.tlsListenAddr != "" {
+		logger.WithField("listenAddr", s.tlsListenAddr).Infoln("starting https listener")
+		tlsListener, err = net.Listen("tcp", s.tlsListenAddr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
 	logger.Infoln("ready to handle requests")
 
+	var listenersWg sync.WaitGroup
+	listenersWg.Add(1)
 	go func() {
+		defer listenersWg.Done()
 		serveErr := srv.Serve(listener)
 		if serveErr != nil {
 			errCh <- serveErr
 		}
 
 		logger.Debugln("http listener stopped")
+	}()
+	if tlsListener != nil {
+		listenersWg.Add(1)
+		go func() {
+			defer listenersWg.Done()
+			serveErr := srv.ServeTLS(tlsListener, "", "")
+			if serveErr != nil {
+				errCh <- serveErr
+			}
+
+			logger.Debugln("https listener stopped")
+		}()
+	}
+	go func() {
+		listenersWg.Wait()
 		close(exitCh)
 	}()
 
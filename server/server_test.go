@@ -33,7 +33,13 @@ import (
 	identityManagers "stash.kopano.io/kc/konnect/identity/managers"
 	"stash.kopano.io/kc/konnect/managers"
 	codeManagers "stash.kopano.io/kc/konnect/oidc/code/managers"
+	consentManagers "stash.kopano.io/kc/konnect/oidc/consent/managers"
+	deviceManagers "stash.kopano.io/kc/konnect/oidc/device/managers"
+	parManagers "stash.kopano.io/kc/konnect/oidc/par/managers"
 	"stash.kopano.io/kc/konnect/oidc/provider"
+	refreshManagers "stash.kopano.io/kc/konnect/oidc/refresh/managers"
+	revocationManagers "stash.kopano.io/kc/konnect/oidc/revocation/managers"
+	sessionManagers "stash.kopano.io/kc/konnect/oidc/session/managers"
 )
 
 var logger = &logrus.Logger{
@@ -49,6 +55,12 @@ func newTestServer(ctx context.Context, t *testing.T) (*httptest.Server, *Server
 		"unittestuser",
 	))
 	mgrs.Set("code", codeManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("revocation", revocationManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("device", deviceManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("par", parManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("session", sessionManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("refresh", refreshManagers.NewMemoryMapManager(ctx))
+	mgrs.Set("consent", consentManagers.NewMemoryMapManager(ctx))
 	encryptionManager, _ := identityManagers.NewEncryptionManager(nil)
 	mgrs.Set("encryption", encryptionManager)
 	mgrs.Set("clients", &clients.Registry{})
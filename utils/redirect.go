@@ -32,12 +32,31 @@ import (
 // asFragment is true, the provided params are added as URL fragment, otherwise
 // they replace the query. If params is nil, the provided uri is taken as is.
 func WriteRedirect(rw http.ResponseWriter, code int, uri *url.URL, params interface{}, asFragment bool) error {
+	uriString, err := RedirectURL(uri, params, asFragment)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Location", uriString)
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	rw.WriteHeader(code)
+
+	return nil
+}
+
+// RedirectURL creates a URL string out of the provided uri and params. If
+// asFragment is true, the provided params are added as URL fragment, otherwise
+// they are added to the query. If params is nil, the provided uri is returned
+// as is.
+func RedirectURL(uri *url.URL, params interface{}, asFragment bool) (string, error) {
 	uriString := uri.String()
 
 	if params != nil {
 		queryString, err := query.Values(params)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		separator := "#"
@@ -54,11 +73,5 @@ func WriteRedirect(rw http.ResponseWriter, code int, uri *url.URL, params interf
 		uriString = fmt.Sprintf("%s%s%s", uriString, separator, queryStringEncoded)
 	}
 
-	rw.Header().Set("Location", uriString)
-	rw.Header().Set("Cache-Control", "no-store")
-	rw.Header().Set("Pragma", "no-cache")
-
-	rw.WriteHeader(code)
-
-	return nil
+	return uriString, nil
 }